@@ -0,0 +1,36 @@
+package core
+
+import (
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+// IsHiddenPath reports whether path is or lies below a hidden path, hidden
+// paths are never listed and only accessible to admins
+func (od *OneDrive) IsHiddenPath(path string) bool {
+	newPath := utils.RegularPath(path)
+	for _, hiddenPath := range od.OneDriveDescription.HiddenPaths {
+		// Microsoft Graph ignores case, so does the hidden path
+		hiddenPath = utils.RegularPath(hiddenPath)
+		if newPath == hiddenPath || hiddenPath != "/" && IsSubPath(newPath, hiddenPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterHiddenChildren returns the children of the folder at path without the
+// hidden ones, a folder inside a hidden path is reached through a volume mount
+// or by an admin and lists all children
+func (od *OneDrive) filterHiddenChildren(path string, children []cache.MicrosoftGraphDriveItemCache) []cache.MicrosoftGraphDriveItemCache {
+	if len(od.OneDriveDescription.HiddenPaths) == 0 || od.IsHiddenPath(path) {
+		return children
+	}
+	newChildren := []cache.MicrosoftGraphDriveItemCache{}
+	for _, child := range children {
+		if !od.IsHiddenPath(path + "/" + child.Name) {
+			newChildren = append(newChildren, child)
+		}
+	}
+	return newChildren
+}
@@ -0,0 +1,92 @@
+package access
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Role is the access level of a user on a drive, a higher role includes all
+// lower ones
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleRead
+	RoleWrite
+	RoleAdmin
+)
+
+// ParseRole parses none, read, write and admin, unknown roles are RoleNone
+func ParseRole(str string) Role {
+	switch str {
+	case "read":
+		return RoleRead
+	case "write":
+		return RoleWrite
+	case "admin":
+		return RoleAdmin
+	}
+	return RoleNone
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleRead:
+		return "read"
+	case RoleWrite:
+		return "write"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// UseRole returns the role of drive in roles, where the drive name * matches
+// all drives without an own entry
+func UseRole(roles map[string]string, drive string) (Role, bool) {
+	if role, ok := roles[drive]; ok {
+		return ParseRole(role), true
+	}
+	if role, ok := roles["*"]; ok {
+		return ParseRole(role), true
+	}
+	return RoleNone, false
+}
+
+// UseUnlockCookieName returns the cookie name of the volume mount target on
+// drive
+func UseUnlockCookieName(drive, target string) string {
+	sum := sha1.Sum([]byte(drive + "\x00" + target))
+	return "onedrive_unlock_" + hex.EncodeToString(sum[:8])
+}
+
+// SignUnlockToken returns a token proving the password of the volume mount
+// target on drive was entered, changing the password invalidates the token
+func SignUnlockToken(secret []byte, drive, target, password string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expires + "." + signUnlockToken(secret, drive, target, password, expires)
+}
+
+// VerifyUnlockToken checks the signature and the expiry of token
+func VerifyUnlockToken(secret []byte, token, drive, target, password string, now time.Time) bool {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(parts[1]), []byte(signUnlockToken(secret, drive, target, password, parts[0])))
+}
+
+func signUnlockToken(secret []byte, drive, target, password, expires string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(drive + "\x00" + target + "\x00" + password + "\x00" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
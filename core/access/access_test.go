@@ -0,0 +1,44 @@
+package access
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUseRole(t *testing.T) {
+	roles := map[string]string{"*": "read", "media": "write", "private": "none"}
+	tests := []struct {
+		drive string
+		want  Role
+	}{
+		{"media", RoleWrite},
+		{"private", RoleNone},
+		{"other", RoleRead},
+	}
+	for _, test := range tests {
+		if role, _ := UseRole(roles, test.drive); role != test.want {
+			t.Errorf("%s: got %s, want %s", test.drive, role, test.want)
+		}
+	}
+	if _, ok := UseRole(map[string]string{}, "media"); ok {
+		t.Errorf("empty roles should NOT match")
+	}
+}
+
+func TestUnlockToken(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1600000000, 0)
+	token := SignUnlockToken(secret, "media", "/private", "password", now.Add(time.Hour))
+	if !VerifyUnlockToken(secret, token, "media", "/private", "password", now) {
+		t.Fatalf("token should be valid")
+	}
+	if VerifyUnlockToken(secret, token, "media", "/private", "password", now.Add(2*time.Hour)) {
+		t.Errorf("expired token should be invalid")
+	}
+	if VerifyUnlockToken(secret, token, "media", "/private", "changed", now) {
+		t.Errorf("token should be invalid after the password changed")
+	}
+	if VerifyUnlockToken(secret, token, "media", "/other", "password", now) {
+		t.Errorf("token should be bound to the target")
+	}
+}
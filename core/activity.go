@@ -0,0 +1,297 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/activity"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+var (
+	ErrActivityCursorInvalid = errors.New("ActivityCursorInvalid")
+	ErrActivityTimeInvalid   = errors.New("ActivityTimeInvalid")
+	ErrActivitySourceInvalid = errors.New("ActivitySourceInvalid")
+)
+
+// ActivityDefaultTop and ActivityMaxTop are the default and the maximum count
+// of activities per page, ActivityGraphMaxPages bounds the pages requested
+// from Microsoft Graph and a drive failing them falls back to the delta
+// stream for ActivityGraphRetryInterval
+var (
+	ActivityDefaultTop         = 50
+	ActivityMaxTop             = 500
+	ActivityGraphMaxPages      = 5
+	ActivityGraphRetryInterval = time.Hour
+)
+
+// ActivityFilter narrows the activities, zero values do NOT filter
+type ActivityFilter struct {
+	Path   string // virtual folder the activities lie below
+	After  time.Time
+	Before time.Time
+	Source string // graph, delta, graph where available by default
+}
+
+// ActivityPayload is a page of activities, the latest first, the next page
+// is requested by the NextCursor until it is empty
+type ActivityPayload struct {
+	Value      []activity.Activity `json:"value"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+}
+
+// activityCursor is the last activity of a page
+type activityCursor struct {
+	Time time.Time `json:"t"`
+	ID   string    `json:"i"`
+	Path string    `json:"p"`
+}
+
+// ParseActivityTime parses an RFC 3339 time or a duration before now, like
+// 24h, an empty string is the zero time
+func ParseActivityTime(str string, now time.Time) (time.Time, error) {
+	if str == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, str); err == nil {
+		return t, nil
+	}
+	duration, err := time.ParseDuration(str)
+	if err != nil || duration < 0 {
+		return time.Time{}, ErrActivityTimeInvalid
+	}
+	return now.Add(-duration), nil
+}
+
+// InitActivityLog loads the activity log of the drive persisted next to the
+// cache file
+func (od *OneDrive) InitActivityLog() error {
+	if od.ActivityLog != nil || od.OneDriveDescription.DriveDescription == nil {
+		return nil
+	}
+	activityLog := activity.NewLog(od.OneDriveDescription.DriveDescription.ID + ".activity.json")
+	if err := activityLog.Load(); err != nil {
+		log.Println("od.InitActivityLog", err)
+	}
+	od.ActivityLog = activityLog
+	return nil
+}
+
+// SyncActivityLog applies the changes of the delta stream since the last sync
+// to the activity log and the tombstones, the first sync only records the
+// state of the items
+func (od *OneDrive) SyncActivityLog() error {
+	if od.ActivityLog == nil {
+		return nil
+	}
+	odd := od.OneDriveDescription
+	str := od.ActivityLog.DeltaLink()
+	baseline := str == ""
+	changed := false
+	defer func() {
+		if changed {
+			od.SaveDriveCacheCollection()
+		}
+	}()
+	for {
+		microsoftGraphDriveItemCollection, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveDelta(&odd, str)
+		if err != nil {
+			// The delta link expired, the next sync starts over
+			if err.Error() == http.StatusText(http.StatusGone) {
+				od.ActivityLog.Reset()
+			}
+			return err
+		}
+		activities := od.ActivityLog.Apply(microsoftGraphDriveItemCollection.Value, baseline, time.Now())
+		if od.applyTombstones(microsoftGraphDriveItemCollection.Value, activities) {
+			changed = true
+		}
+		if microsoftGraphDriveItemCollection.AtODataNextLink != nil {
+			str = *microsoftGraphDriveItemCollection.AtODataNextLink
+			continue
+		}
+		if microsoftGraphDriveItemCollection.AtODataDeltaLink != nil {
+			od.ActivityLog.SetDeltaLink(*microsoftGraphDriveItemCollection.AtODataDeltaLink)
+		}
+		break
+	}
+	return od.ActivityLog.Save()
+}
+
+// GetMicrosoftGraphDriveItemActivities lists the activities of the drives
+// behind the virtual drive mapped to the virtual paths, the latest first, an
+// activity lies below the folder of the filter if its path or old path does
+func (od *OneDrive) GetMicrosoftGraphDriveItemActivities(filter *ActivityFilter, top int, cursor string) (*ActivityPayload, error) {
+	var currentCursor *activityCursor
+	if cursor != "" {
+		bytes, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, ErrActivityCursorInvalid
+		}
+		currentCursor = &activityCursor{}
+		if err := json.Unmarshal(bytes, currentCursor); err != nil {
+			return nil, ErrActivityCursorInvalid
+		}
+	}
+	if filter.Source != "" && filter.Source != "graph" && filter.Source != "delta" {
+		return nil, ErrActivitySourceInvalid
+	}
+	filterPath := utils.RegularPath(filter.Path)
+	activities := []activity.Activity{}
+	for _, source := range od.useSearchSources(filter.Path) {
+		sourceActivities, err := source.od.useActivities(source.path, filter.Source)
+		if err != nil {
+			return nil, err
+		}
+		for _, sourceActivity := range sourceActivities {
+			if !filter.After.IsZero() && sourceActivity.Time.Before(filter.After) {
+				continue
+			}
+			if !filter.Before.IsZero() && !sourceActivity.Time.Before(filter.Before) {
+				continue
+			}
+			oldPath := ""
+			if sourceActivity.OldPath != "" {
+				if oldPaths := od.UseDriveVolumeMountVirtualPaths(source.od, sourceActivity.OldPath); len(oldPaths) > 0 {
+					oldPath = oldPaths[0]
+				}
+			}
+			for _, path := range od.UseDriveVolumeMountVirtualPaths(source.od, sourceActivity.Path) {
+				if !IsSubPath(path, filterPath) && (oldPath == "" || !IsSubPath(oldPath, filterPath)) {
+					continue
+				}
+				newActivity := sourceActivity
+				newActivity.Path = path
+				newActivity.OldPath = oldPath
+				activities = append(activities, newActivity)
+			}
+		}
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		return isActivityBefore(&activities[j], &activities[i])
+	})
+	activityPayload := &ActivityPayload{Value: []activity.Activity{}}
+	top = useActivityTop(top)
+	for i := range activities {
+		if currentCursor != nil && !isActivityBefore(&activities[i], &activity.Activity{Time: currentCursor.Time, ID: currentCursor.ID, Path: currentCursor.Path}) {
+			continue
+		}
+		if len(activityPayload.Value) == top {
+			last := activityPayload.Value[top-1]
+			bytes, err := json.Marshal(activityCursor{last.Time, last.ID, last.Path})
+			if err != nil {
+				return nil, err
+			}
+			activityPayload.NextCursor = base64.RawURLEncoding.EncodeToString(bytes)
+			break
+		}
+		activityPayload.Value = append(activityPayload.Value, activities[i])
+	}
+	return activityPayload, nil
+}
+
+// isActivityBefore orders the activities by time, then by ID and path
+func isActivityBefore(a, b *activity.Activity) bool {
+	if !a.Time.Equal(b.Time) {
+		return a.Time.Before(b.Time)
+	}
+	if a.ID != b.ID {
+		return a.ID < b.ID
+	}
+	return a.Path < b.Path
+}
+
+func useActivityTop(top int) int {
+	if top <= 0 {
+		return ActivityDefaultTop
+	}
+	if top > ActivityMaxTop {
+		return ActivityMaxTop
+	}
+	return top
+}
+
+// useActivities returns the activities at path of the drive itself with the
+// paths relative to the root path, by Microsoft Graph unless it failed lately
+func (od *OneDrive) useActivities(path, source string) ([]activity.Activity, error) {
+	switch source {
+	case "graph":
+		return od.useGraphActivities(path)
+	case "delta":
+		return od.useDeltaActivities(), nil
+	}
+	if time.Now().Unix() >= atomic.LoadInt64(&od.activityGraphRetryAt) {
+		activities, err := od.useGraphActivities(path)
+		if err == nil {
+			return activities, nil
+		}
+		log.Println("od.useActivities", err)
+		atomic.StoreInt64(&od.activityGraphRetryAt, time.Now().Add(ActivityGraphRetryInterval).Unix())
+	}
+	return od.useDeltaActivities(), nil
+}
+
+// useGraphActivities requests the activities of the item at path, the deleted
+// items missing are placed right below path
+func (od *OneDrive) useGraphActivities(path string) ([]activity.Activity, error) {
+	odd := od.OneDriveDescription
+	microsoftGraphItemActivities, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveActivities(&odd, odd.RelativePathToDriveRootPath(path), ActivityGraphMaxPages)
+	if err != nil {
+		return nil, err
+	}
+	activities := []activity.Activity{}
+	parentPaths := map[string]string{}
+	for i := range microsoftGraphItemActivities {
+		microsoftGraphItemActivity := &microsoftGraphItemActivities[i]
+		newActivity := activity.NewActivity(microsoftGraphItemActivity)
+		if newActivity.Action == "" {
+			continue
+		}
+		if microsoftGraphItemActivity.DriveItem != nil {
+			sourcePath, ok := od.useSearchSourcePath(microsoftGraphItemActivity.DriveItem, parentPaths)
+			if !ok {
+				continue
+			}
+			newActivity.Path = sourcePath
+		} else if newActivity.Name != "" {
+			newActivity.Path = joinSubPath(utils.RegularPath(path), newActivity.Name)
+		} else {
+			continue
+		}
+		if rename := microsoftGraphItemActivity.Action.Rename; rename != nil && rename.OldName != "" {
+			newActivity.OldPath = joinSubPath(newActivity.Path[:strings.LastIndex(newActivity.Path, "/")+1], rename.OldName)
+		}
+		activities = append(activities, newActivity)
+	}
+	return activities, nil
+}
+
+// useDeltaActivities returns the activities of the activity log inside the
+// root path
+func (od *OneDrive) useDeltaActivities() []activity.Activity {
+	activities := []activity.Activity{}
+	if od.ActivityLog == nil {
+		return activities
+	}
+	odd := od.OneDriveDescription
+	for _, deltaActivity := range od.ActivityLog.Activities() {
+		if !isSearchDriveRootPath(&odd, deltaActivity.Path) {
+			continue
+		}
+		deltaActivity.Path = odd.DriveRootPathToRelativePath(deltaActivity.Path)
+		if isSearchDriveRootPath(&odd, deltaActivity.OldPath) {
+			deltaActivity.OldPath = odd.DriveRootPathToRelativePath(deltaActivity.OldPath)
+		} else {
+			deltaActivity.OldPath = ""
+		}
+		activities = append(activities, deltaActivity)
+	}
+	return activities
+}
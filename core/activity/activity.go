@@ -0,0 +1,337 @@
+package activity
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// Actions of the activities, as named by the itemActionSet of Microsoft Graph
+const (
+	ActionCreate  = "create"
+	ActionEdit    = "edit"
+	ActionDelete  = "delete"
+	ActionMove    = "move"
+	ActionRename  = "rename"
+	ActionRestore = "restore"
+	ActionShare   = "share"
+	ActionVersion = "version"
+	ActionComment = "comment"
+	ActionMention = "mention"
+)
+
+// LogMaxSize bounds the activities kept for each drive, the oldest are
+// dropped first
+var LogMaxSize = 10000
+
+// pathMaxDepth guards the walk up the parents against cycles
+const pathMaxDepth = 256
+
+// Activity is a change of an item, paths are drive root paths like
+// /drive/root:/path/to
+type Activity struct {
+	ID       string    `json:"id"`
+	Action   string    `json:"action"`
+	ItemID   string    `json:"itemId,omitempty"`
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	OldPath  string    `json:"oldPath,omitempty"` // of moves and renames
+	IsFolder bool      `json:"isFolder"`
+	Size     int64     `json:"size,omitempty"`
+	Actor    string    `json:"actor,omitempty"`
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"` // graph, delta
+}
+
+// Item is the state of an item last reported by the delta stream
+type Item struct {
+	ParentID string `json:"parentId,omitempty"`
+	Name     string `json:"name"`
+	IsFolder bool   `json:"isFolder,omitempty"`
+	IsRoot   bool   `json:"isRoot,omitempty"`
+	CTag     string `json:"cTag,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// Log keeps the state of the items of a drive and the activities found by
+// comparing the changes of the delta stream against it
+type Log struct {
+	Filename string
+
+	mutex      sync.Mutex
+	deltaLink  string
+	items      map[string]*Item
+	activities []Activity // oldest first
+	seq        int64
+}
+
+type logFile struct {
+	DeltaLink  string           `json:"deltaLink,omitempty"`
+	Items      map[string]*Item `json:"items"`
+	Activities []Activity       `json:"activities"`
+	Seq        int64            `json:"seq"`
+}
+
+// NewLog returns an empty log saved to filename
+func NewLog(filename string) *Log {
+	return &Log{
+		Filename: filename,
+		items:    map[string]*Item{},
+	}
+}
+
+// Load reads the log from its file, a missing file is empty
+func (l *Log) Load() error {
+	bytes, err := ioutil.ReadFile(l.Filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	persisted := logFile{}
+	if err := json.Unmarshal(bytes, &persisted); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.deltaLink = persisted.DeltaLink
+	l.items = persisted.Items
+	if l.items == nil {
+		l.items = map[string]*Item{}
+	}
+	l.activities = persisted.Activities
+	l.seq = persisted.Seq
+	log.Println("Loaded activity log of", len(l.activities), "activities from", l.Filename)
+	return nil
+}
+
+// Save writes the log to its file
+func (l *Log) Save() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	bytes, err := json.Marshal(logFile{
+		DeltaLink:  l.deltaLink,
+		Items:      l.items,
+		Activities: l.activities,
+		Seq:        l.seq,
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(l.Filename, bytes, 0644)
+}
+
+// DeltaLink returns the link of the next changes, empty before the first
+// complete sync
+func (l *Log) DeltaLink() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.deltaLink
+}
+
+// SetDeltaLink stores the link of the next changes
+func (l *Log) SetDeltaLink(deltaLink string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.deltaLink = deltaLink
+}
+
+// Reset forgets the state of the items so the next sync starts over as a
+// baseline, the activities are kept
+func (l *Log) Reset() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.deltaLink = ""
+	l.items = map[string]*Item{}
+}
+
+// Apply compares a page of changes of the delta stream against the state of
+// the items and records the activities found at now, a baseline only records
+// the state, which is the case of the first sync
+func (l *Log) Apply(changes []graphapi.MicrosoftGraphDriveItem, baseline bool, now time.Time) []Activity {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	// The old paths are taken before any change of the page applies
+	oldItems := map[string]Item{}
+	oldPaths := map[string]string{}
+	for _, change := range changes {
+		if item, ok := l.items[change.ID]; ok {
+			oldItems[change.ID] = *item
+			oldPaths[change.ID] = l.path(change.ID)
+		}
+	}
+	for _, change := range changes {
+		if change.Deleted != nil {
+			delete(l.items, change.ID)
+			continue
+		}
+		item := &Item{
+			Name:     change.Name,
+			IsFolder: change.Folder != nil,
+			IsRoot:   change.Root != nil,
+			CTag:     change.CTag,
+			Size:     change.Size,
+		}
+		if change.ParentReference != nil {
+			item.ParentID = change.ParentReference.ID
+		}
+		l.items[change.ID] = item
+	}
+	if baseline {
+		return nil
+	}
+	activities := []Activity{}
+	for _, change := range changes {
+		if change.Root != nil {
+			continue
+		}
+		old, known := oldItems[change.ID]
+		activity := Activity{
+			ItemID:   change.ID,
+			Name:     change.Name,
+			IsFolder: change.Folder != nil,
+			Size:     change.Size,
+			Time:     now,
+			Source:   "delta",
+		}
+		if change.LastModifiedDateTime != nil && change.Deleted == nil {
+			activity.Time = *change.LastModifiedDateTime
+		}
+		if change.LastModifiedBy != nil && change.LastModifiedBy.User != nil {
+			activity.Actor = change.LastModifiedBy.User.DisplayName
+		}
+		switch {
+		case change.Deleted != nil:
+			if !known {
+				continue
+			}
+			activity.Action = ActionDelete
+			activity.Name = old.Name
+			activity.IsFolder = old.IsFolder
+			activity.Size = old.Size
+			activity.Path = oldPaths[change.ID]
+		case !known:
+			activity.Action = ActionCreate
+		case change.ParentReference != nil && change.ParentReference.ID != old.ParentID:
+			activity.Action = ActionMove
+			activity.OldPath = oldPaths[change.ID]
+		case change.Name != old.Name:
+			activity.Action = ActionRename
+			activity.OldPath = oldPaths[change.ID]
+		case change.Folder == nil && change.CTag != old.CTag:
+			activity.Action = ActionEdit
+		default:
+			continue
+		}
+		if activity.Path == "" {
+			activity.Path = l.path(change.ID)
+		}
+		if activity.Path == "" {
+			continue
+		}
+		l.seq++
+		activity.ID = "d" + strconv.FormatInt(l.seq, 10)
+		activities = append(activities, activity)
+	}
+	l.activities = append(l.activities, activities...)
+	if over := len(l.activities) - LogMaxSize; over > 0 {
+		l.activities = append([]Activity{}, l.activities[over:]...)
+	}
+	return activities
+}
+
+// path returns the drive root path of the item of id, empty if any of its
+// parents is unknown
+func (l *Log) path(id string) string {
+	path := ""
+	for depth := 0; depth < pathMaxDepth; depth++ {
+		item, ok := l.items[id]
+		if !ok {
+			return ""
+		}
+		if item.IsRoot {
+			return "/drive/root:" + path
+		}
+		path = "/" + item.Name + path
+		id = item.ParentID
+	}
+	return ""
+}
+
+// Activities returns a copy of the activities, the oldest first
+func (l *Log) Activities() []Activity {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]Activity{}, l.activities...)
+}
+
+// Len returns the count of the items known
+func (l *Log) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.items)
+}
+
+// NewActivity converts an activity reported by Microsoft Graph, the path is
+// left to the caller as the drive item may lack it
+func NewActivity(microsoftGraphItemActivity *graphapi.MicrosoftGraphItemActivity) Activity {
+	activity := Activity{
+		ID:     microsoftGraphItemActivity.ID,
+		Source: "graph",
+	}
+	if action := microsoftGraphItemActivity.Action; action != nil {
+		switch {
+		case action.Create != nil:
+			activity.Action = ActionCreate
+		case action.Delete != nil:
+			activity.Action = ActionDelete
+			activity.Name = action.Delete.Name
+			activity.IsFolder = action.Delete.ObjectType == "Folder"
+		case action.Move != nil:
+			activity.Action = ActionMove
+		case action.Rename != nil:
+			activity.Action = ActionRename
+			activity.Name = action.Rename.NewName
+		case action.Restore != nil:
+			activity.Action = ActionRestore
+		case action.Share != nil:
+			activity.Action = ActionShare
+		case action.Version != nil:
+			activity.Action = ActionVersion
+		case action.Comment != nil:
+			activity.Action = ActionComment
+		case action.Mention != nil:
+			activity.Action = ActionMention
+		case action.Edit != nil:
+			activity.Action = ActionEdit
+		}
+	}
+	if actor := microsoftGraphItemActivity.Actor; actor != nil {
+		if actor.User != nil {
+			activity.Actor = actor.User.DisplayName
+		} else if actor.Application != nil {
+			activity.Actor = actor.Application.DisplayName
+		}
+	}
+	if times := microsoftGraphItemActivity.Times; times != nil {
+		if times.RecordedDateTime != nil {
+			activity.Time = *times.RecordedDateTime
+		} else if times.ObservedDateTime != nil {
+			activity.Time = *times.ObservedDateTime
+		}
+	}
+	if driveItem := microsoftGraphItemActivity.DriveItem; driveItem != nil {
+		activity.ItemID = driveItem.ID
+		activity.Name = driveItem.Name
+		activity.IsFolder = driveItem.Folder != nil
+		activity.Size = driveItem.Size
+	}
+	return activity
+}
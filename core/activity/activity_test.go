@@ -0,0 +1,72 @@
+package activity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func newChange(id, parentID, name string, folder bool, cTag string) graphapi.MicrosoftGraphDriveItem {
+	change := graphapi.MicrosoftGraphDriveItem{
+		ID:              id,
+		Name:            name,
+		CTag:            cTag,
+		ParentReference: &graphapi.MicrosoftGraphItemReference{ID: parentID},
+	}
+	if folder {
+		change.Folder = &graphapi.MicrosoftGraphFolder{}
+	}
+	return change
+}
+
+func TestLogApply(t *testing.T) {
+	l := NewLog("")
+	now := time.Now()
+	root := graphapi.MicrosoftGraphDriveItem{ID: "r", Name: "root", Root: &graphapi.MicrosoftGraphRoot{}, Folder: &graphapi.MicrosoftGraphFolder{}}
+	baseline := []graphapi.MicrosoftGraphDriveItem{
+		root,
+		newChange("a", "r", "A", true, "c1"),
+		newChange("b", "r", "B", true, "c1"),
+		newChange("x", "a", "x.txt", false, "c1"),
+	}
+	if activities := l.Apply(baseline, true, now); len(activities) != 0 || l.Len() != 4 {
+		t.Fatalf("got %+v %d", activities, l.Len())
+	}
+
+	// The folder A moves into B and its file is edited within the same page
+	deleted := newChange("b", "r", "", false, "")
+	deleted.Deleted = &graphapi.MicrosoftGraphDeleted{}
+	activities := l.Apply([]graphapi.MicrosoftGraphDriveItem{
+		newChange("a", "b", "A", true, "c2"),
+		newChange("x", "a", "x.txt", false, "c2"),
+		newChange("n", "r", "new.txt", false, "c1"),
+	}, false, now)
+	if len(activities) != 3 {
+		t.Fatalf("got %+v", activities)
+	}
+	if a := activities[0]; a.Action != ActionMove || a.OldPath != "/drive/root:/A" || a.Path != "/drive/root:/B/A" || a.ID != "d1" {
+		t.Errorf("got %+v", a)
+	}
+	if a := activities[1]; a.Action != ActionEdit || a.Path != "/drive/root:/B/A/x.txt" {
+		t.Errorf("got %+v", a)
+	}
+	if a := activities[2]; a.Action != ActionCreate || a.Path != "/drive/root:/new.txt" {
+		t.Errorf("got %+v", a)
+	}
+
+	// The deleted items keep the name and the path they had
+	activities = l.Apply([]graphapi.MicrosoftGraphDriveItem{
+		newChange("n", "r", "renamed.txt", false, "c1"),
+		deleted,
+	}, false, now)
+	if len(activities) != 2 || activities[0].Action != ActionRename || activities[0].OldPath != "/drive/root:/new.txt" {
+		t.Fatalf("got %+v", activities)
+	}
+	if a := activities[1]; a.Action != ActionDelete || a.Name != "B" || !a.IsFolder || a.Path != "/drive/root:/B" {
+		t.Errorf("got %+v", a)
+	}
+	if n := len(l.Activities()); n != 5 {
+		t.Errorf("got %d", n)
+	}
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/activity"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestMicrosoftGraphDriveItemActivities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path + "?" + r.URL.Query().Get("token") {
+		case "/v1.0/me/drive/root/delta?":
+			w.Write([]byte(`{"value":[
+				{"id":"r","name":"root","root":{},"folder":{}},
+				{"id":"a","name":"A","folder":{},"parentReference":{"id":"r"}},
+				{"id":"x","name":"x.txt","file":{},"cTag":"c1","parentReference":{"id":"a"}}
+			],"@odata.deltaLink":"/me/drive/root/delta?token=1"}`))
+		case "/v1.0/me/drive/root/delta?1":
+			w.Write([]byte(`{"value":[
+				{"id":"x","name":"x.txt","file":{},"cTag":"c2","parentReference":{"id":"a"},"lastModifiedDateTime":"2021-01-01T00:00:00Z"},
+				{"id":"y","name":"y.txt","file":{},"cTag":"c1","parentReference":{"id":"r"},"lastModifiedDateTime":"2021-01-02T00:00:00Z"},
+				{"id":"z","name":"z.txt","file":{},"cTag":"c1","parentReference":{"id":"a"},"lastModifiedDateTime":"2021-01-03T00:00:00Z"}
+			],"@odata.deltaLink":"/me/drive/root/delta?token=2"}`))
+		case "/v1.0/me/drive/root/delta?2":
+			w.Write([]byte(`{"value":[
+				{"id":"a","deleted":{"state":"deleted"},"parentReference":{"id":"r"}},
+				{"id":"x","deleted":{"state":"deleted"},"parentReference":{"id":"a"}},
+				{"id":"z","deleted":{"state":"deleted"},"parentReference":{"id":"a"}}
+			],"@odata.deltaLink":"/me/drive/root/delta?token=3"}`))
+		default:
+			// The activities of the personal drives are NOT supported
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "activity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	od := &OneDrive{ActivityLog: activity.NewLog(filepath.Join(dir, "drive.activity.json"))}
+	od.MicrosoftGraphAPI.MicrosoftEndPoints.MicrosoftGraphAPIEndPointURL = server.URL
+	od.MicrosoftGraphAPI.MicrosoftGraphAPIToken = &graphapi.MicrosoftGraphAPIToken{TokenType: "Bearer", AccessToken: "token"}
+
+	for i := 0; i < 2; i++ {
+		if err := od.SyncActivityLog(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	activityPayload, err := od.GetMicrosoftGraphDriveItemActivities(&ActivityFilter{}, 2, "")
+	if err != nil || len(activityPayload.Value) != 2 || activityPayload.NextCursor == "" {
+		t.Fatalf("got %+v %v", activityPayload, err)
+	}
+	if a := activityPayload.Value[0]; a.Path != "/A/z.txt" || a.Action != activity.ActionCreate || a.Source != "delta" {
+		t.Errorf("got %+v", a)
+	}
+	activityPayload, err = od.GetMicrosoftGraphDriveItemActivities(&ActivityFilter{}, 2, activityPayload.NextCursor)
+	if err != nil || len(activityPayload.Value) != 1 || activityPayload.NextCursor != "" {
+		t.Fatalf("got %+v %v", activityPayload, err)
+	}
+	if a := activityPayload.Value[0]; a.Path != "/A/x.txt" || a.Action != activity.ActionEdit {
+		t.Errorf("got %+v", a)
+	}
+
+	after, _ := ParseActivityTime("2021-01-02T00:00:00Z", time.Now())
+	activityPayload, err = od.GetMicrosoftGraphDriveItemActivities(&ActivityFilter{Path: "/A", After: after}, 0, "")
+	if err != nil || len(activityPayload.Value) != 1 || activityPayload.Value[0].Name != "z.txt" {
+		t.Errorf("got %+v %v", activityPayload, err)
+	}
+	if _, err := od.GetMicrosoftGraphDriveItemActivities(&ActivityFilter{Source: "graph"}, 0, ""); err == nil {
+		t.Errorf("got %v", err)
+	}
+
+	// The items deleted along with their folder get no tombstone of their own
+	if err := od.SyncActivityLog(); err != nil {
+		t.Fatal(err)
+	}
+	tombstones := od.ListDriveItemTombstones("/")
+	if len(tombstones) != 1 || tombstones[0].ID != "a" || tombstones[0].Path != "/A" || !tombstones[0].IsFolder {
+		t.Errorf("got %+v", tombstones)
+	}
+	if _, err := od.RestoreDriveItemTombstone("/B", "a"); err != ErrTombstoneNotFound {
+		t.Errorf("got %v", err)
+	}
+}
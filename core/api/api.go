@@ -2,8 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/AirWSW/onedrive/core/cache"
 	"github.com/AirWSW/onedrive/core/description"
@@ -47,6 +51,22 @@ func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDrive(odd *description.OneDr
 	return nil
 }
 
+// GetMicrosoftGraphAPIMeDriveQuota requests the quota of the drive
+func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveQuota(odd *description.OneDriveDescription) (*graphapi.MicrosoftGraphQuota, error) {
+	bytes, err := api.UseMicrosoftGraphAPIGet(odd.UseMicrosoftGraphAPIMeDrivePath("?$select=quota"))
+	if err != nil {
+		return nil, err
+	}
+	microsoftGraphDrive := graphapi.MicrosoftGraphDrive{}
+	if err := json.Unmarshal(bytes, &microsoftGraphDrive); err != nil {
+		return nil, err
+	}
+	if microsoftGraphDrive.Quota == nil {
+		return nil, errors.New("api.GetMicrosoftGraphAPIMeDriveQuota NoQuota")
+	}
+	return microsoftGraphDrive.Quota, nil
+}
+
 func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveItem(odd *description.OneDriveDescription, str string) (*graphapi.MicrosoftGraphDriveItem, error) {
 	reqURL := odd.UseMicrosoftGraphAPIMeDriveItem(str)
 	strURL, err := url.Parse(str)
@@ -91,6 +111,46 @@ func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveChildren(odd *descripti
 	return &microsoftGraphDriveItemCollection, nil
 }
 
+// GetMicrosoftGraphAPIMeDriveSearch searches the folder at drive root path str
+// for query, str may be the next link of a previous page as well, which must
+// be on the Microsoft Graph endpoint
+func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveSearch(odd *description.OneDriveDescription, str, query string, top int) (*graphapi.MicrosoftGraphDriveItemCollection, error) {
+	reqURL := odd.UseMicrosoftGraphAPIMeDriveSearchPath(str, query) + "?$top=" + strconv.Itoa(top)
+	strURL, err := url.Parse(str)
+	if err != nil {
+		return nil, err
+	}
+	if strURL.IsAbs() {
+		if !api.MicrosoftEndPoints.IsMicrosoftGraphAPIEndPointURL(str) {
+			return nil, errors.New("api.GetMicrosoftGraphAPIMeDriveSearch ForeignNextLink " + strURL.Host)
+		}
+		reqURL = str
+	}
+	bytes, err := api.UseMicrosoftGraphAPIGet(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	microsoftGraphDriveItemCollection := graphapi.MicrosoftGraphDriveItemCollection{}
+	if err := json.Unmarshal(bytes, &microsoftGraphDriveItemCollection); err != nil {
+		return nil, err
+	}
+	return &microsoftGraphDriveItemCollection, nil
+}
+
+// GetMicrosoftGraphAPIMeDriveThumbnail returns the thumbnail of size of the
+// item at drive root path str
+func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveThumbnail(odd *description.OneDriveDescription, str, size string) (*graphapi.MicrosoftGraphThumbnail, error) {
+	bytes, err := api.UseMicrosoftGraphAPIGet(odd.UseMicrosoftGraphAPIMeDriveThumbnailPath(str, size))
+	if err != nil {
+		return nil, err
+	}
+	microsoftGraphThumbnail := graphapi.MicrosoftGraphThumbnail{}
+	if err := json.Unmarshal(bytes, &microsoftGraphThumbnail); err != nil {
+		return nil, err
+	}
+	return &microsoftGraphThumbnail, nil
+}
+
 func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveExpandChildren(odd *description.OneDriveDescription, str string) error {
 	bytes, err := api.UseMicrosoftGraphAPIGet(odd.UseMicrosoftGraphAPIMeDriveExpandChildrenPath(str))
 	if err != nil {
@@ -147,6 +207,9 @@ func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveChildrenRequest(odd *de
 			WebURL:                      value.WebURL,
 			AtMicrosoftGraphDownloadURL: value.AtMicrosoftGraphDownloadURL,
 		}
+		if odd.RichMetadata {
+			newMicrosoftGraphDriveItemCache.SetRichMetadata(&value)
+		}
 		microsoftGraphDriveItemCache.Children = append(microsoftGraphDriveItemCache.Children, *newMicrosoftGraphDriveItemCache)
 	}
 
@@ -166,3 +229,279 @@ func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveChildrenRequest(odd *de
 func (api *MicrosoftGraphAPI) UpdateMicrosoftGraphDriveItemCache(odd *description.OneDriveDescription, cacheDescription *cache.CacheDescription) (*cache.MicrosoftGraphDriveItemCache, error) {
 	return api.GetMicrosoftGraphAPIMeDriveChildrenRequest(odd, cacheDescription.Path)
 }
+
+// PostMicrosoftGraphAPIMeDriveFolder creates the folder name in the folder str,
+// conflictBehavior is one of rename, fail and replace
+func (api *MicrosoftGraphAPI) PostMicrosoftGraphAPIMeDriveFolder(odd *description.OneDriveDescription, str, name, conflictBehavior string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	if conflictBehavior == "" {
+		conflictBehavior = "fail"
+	}
+	data, err := json.Marshal(struct {
+		Name                             string                         `json:"name"`
+		Folder                           *graphapi.MicrosoftGraphFolder `json:"folder"`
+		AtMicrosoftGraphConflictBehavior string                         `json:"@microsoft.graph.conflictBehavior"`
+	}{
+		name,
+		&graphapi.MicrosoftGraphFolder{},
+		conflictBehavior,
+	})
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := api.UseMicrosoftGraphAPIPost(odd.UseMicrosoftGraphAPIMeDriveChildren(str), strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalMicrosoftGraphDriveItem(bytes)
+}
+
+// PatchMicrosoftGraphAPIMeDriveItem renames the item str to name and moves it
+// to the folder parentPath, empty arguments are left unchanged
+func (api *MicrosoftGraphAPI) PatchMicrosoftGraphAPIMeDriveItem(odd *description.OneDriveDescription, str, name, parentPath string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	patch := struct {
+		Name            string      `json:"name,omitempty"`
+		ParentReference interface{} `json:"parentReference,omitempty"`
+	}{
+		Name: name,
+	}
+	if parentPath != "" {
+		patch.ParentReference = struct {
+			Path string `json:"path"`
+		}{
+			parentPath,
+		}
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := api.UseMicrosoftGraphAPIPatch(odd.UseMicrosoftGraphAPIMeDriveItem(str), strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalMicrosoftGraphDriveItem(bytes)
+}
+
+// DeleteMicrosoftGraphAPIMeDriveItem moves the item str to the recycle bin
+func (api *MicrosoftGraphAPI) DeleteMicrosoftGraphAPIMeDriveItem(odd *description.OneDriveDescription, str string) error {
+	_, err := api.UseMicrosoftGraphAPIDelete(odd.UseMicrosoftGraphAPIMeDriveItem(str))
+	return err
+}
+
+// PostMicrosoftGraphAPIMeDriveItemRestore restores the deleted item id from the
+// recycle bin, which is only supported by personal drives
+func (api *MicrosoftGraphAPI) PostMicrosoftGraphAPIMeDriveItemRestore(odd *description.OneDriveDescription, id, parentID, name string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	restore := struct {
+		ParentReference interface{} `json:"parentReference,omitempty"`
+		Name            string      `json:"name,omitempty"`
+	}{
+		Name: name,
+	}
+	if parentID != "" {
+		restore.ParentReference = struct {
+			ID string `json:"id"`
+		}{
+			parentID,
+		}
+	}
+	data, err := json.Marshal(restore)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := api.UseMicrosoftGraphAPIPost(odd.UseMicrosoftGraphAPIMeDriveItemIDPath(id)+"/restore", strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalMicrosoftGraphDriveItem(bytes)
+}
+
+// PutMicrosoftGraphAPIMeDriveContent uploads content to the relative path str
+// in a single request, which is limited to 4 MiB
+func (api *MicrosoftGraphAPI) PutMicrosoftGraphAPIMeDriveContent(odd *description.OneDriveDescription, str string, content io.Reader) (*graphapi.MicrosoftGraphDriveItem, error) {
+	bytes, err := api.UseMicrosoftGraphAPIPut(odd.UseMicrosoftGraphAPIMeDriveContentPath(str), content)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalMicrosoftGraphDriveItem(bytes)
+}
+
+// GetMicrosoftGraphAPIMeDrivePermissions lists the permissions of the item at
+// drive root path str, including the inherited ones
+func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDrivePermissions(odd *description.OneDriveDescription, str string) ([]graphapi.MicrosoftGraphPermission, error) {
+	microsoftGraphPermissions := []graphapi.MicrosoftGraphPermission{}
+	reqURL := odd.UseMicrosoftGraphAPIMeDriveActionPath(str, "permissions")
+	for reqURL != "" {
+		bytes, err := api.UseMicrosoftGraphAPIGet(reqURL)
+		if err != nil {
+			return nil, err
+		}
+		microsoftGraphPermissionCollection := graphapi.MicrosoftGraphPermissionCollection{}
+		if err := json.Unmarshal(bytes, &microsoftGraphPermissionCollection); err != nil {
+			return nil, err
+		}
+		microsoftGraphPermissions = append(microsoftGraphPermissions, microsoftGraphPermissionCollection.Value...)
+		reqURL = ""
+		if microsoftGraphPermissionCollection.AtODataNextLink != nil {
+			reqURL = *microsoftGraphPermissionCollection.AtODataNextLink
+		}
+	}
+	return microsoftGraphPermissions, nil
+}
+
+// PostMicrosoftGraphAPIMeDriveCreateLink creates a sharing link of linkType
+// and scope to the item at drive root path str, an existing link of the same
+// type and scope is returned instead, empty arguments are left out
+func (api *MicrosoftGraphAPI) PostMicrosoftGraphAPIMeDriveCreateLink(odd *description.OneDriveDescription, str, linkType, scope, password string, expirationDateTime *time.Time) (*graphapi.MicrosoftGraphPermission, error) {
+	data, err := json.Marshal(struct {
+		Type               string     `json:"type"`
+		Scope              string     `json:"scope,omitempty"`
+		Password           string     `json:"password,omitempty"`
+		ExpirationDateTime *time.Time `json:"expirationDateTime,omitempty"`
+	}{
+		linkType,
+		scope,
+		password,
+		expirationDateTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := api.UseMicrosoftGraphAPIPost(odd.UseMicrosoftGraphAPIMeDriveActionPath(str, "createLink"), strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	microsoftGraphPermission := graphapi.MicrosoftGraphPermission{}
+	if err := json.Unmarshal(bytes, &microsoftGraphPermission); err != nil {
+		return nil, err
+	}
+	return &microsoftGraphPermission, nil
+}
+
+// PostMicrosoftGraphAPIMeDriveInvite grants roles on the item at drive root
+// path str to the recipients by email, sendInvitation emails them a link
+func (api *MicrosoftGraphAPI) PostMicrosoftGraphAPIMeDriveInvite(odd *description.OneDriveDescription, str string, emails, roles []string, message string, requireSignIn, sendInvitation bool) ([]graphapi.MicrosoftGraphPermission, error) {
+	type recipient struct {
+		Email string `json:"email"`
+	}
+	recipients := []recipient{}
+	for _, email := range emails {
+		recipients = append(recipients, recipient{email})
+	}
+	data, err := json.Marshal(struct {
+		Recipients     []recipient `json:"recipients"`
+		Message        string      `json:"message,omitempty"`
+		RequireSignIn  bool        `json:"requireSignIn"`
+		SendInvitation bool        `json:"sendInvitation"`
+		Roles          []string    `json:"roles"`
+	}{
+		recipients,
+		message,
+		requireSignIn,
+		sendInvitation,
+		roles,
+	})
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := api.UseMicrosoftGraphAPIPost(odd.UseMicrosoftGraphAPIMeDriveActionPath(str, "invite"), strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	microsoftGraphPermissionCollection := graphapi.MicrosoftGraphPermissionCollection{}
+	if err := json.Unmarshal(bytes, &microsoftGraphPermissionCollection); err != nil {
+		return nil, err
+	}
+	return microsoftGraphPermissionCollection.Value, nil
+}
+
+// DeleteMicrosoftGraphAPIMeDrivePermission revokes the permission id of the
+// item at drive root path str, inherited permissions can NOT be revoked here
+func (api *MicrosoftGraphAPI) DeleteMicrosoftGraphAPIMeDrivePermission(odd *description.OneDriveDescription, str, id string) error {
+	_, err := api.UseMicrosoftGraphAPIDelete(odd.UseMicrosoftGraphAPIMeDriveActionPath(str, "permissions/"+url.PathEscape(id)))
+	return err
+}
+
+// GetMicrosoftGraphAPIMeDriveVersions lists the versions of the file at drive
+// root path str, the newest first
+func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveVersions(odd *description.OneDriveDescription, str string) ([]graphapi.MicrosoftGraphDriveItemVersion, error) {
+	microsoftGraphDriveItemVersions := []graphapi.MicrosoftGraphDriveItemVersion{}
+	reqURL := odd.UseMicrosoftGraphAPIMeDriveActionPath(str, "versions")
+	for reqURL != "" {
+		bytes, err := api.UseMicrosoftGraphAPIGet(reqURL)
+		if err != nil {
+			return nil, err
+		}
+		microsoftGraphDriveItemVersionCollection := graphapi.MicrosoftGraphDriveItemVersionCollection{}
+		if err := json.Unmarshal(bytes, &microsoftGraphDriveItemVersionCollection); err != nil {
+			return nil, err
+		}
+		microsoftGraphDriveItemVersions = append(microsoftGraphDriveItemVersions, microsoftGraphDriveItemVersionCollection.Value...)
+		reqURL = ""
+		if microsoftGraphDriveItemVersionCollection.AtODataNextLink != nil {
+			reqURL = *microsoftGraphDriveItemVersionCollection.AtODataNextLink
+		}
+	}
+	return microsoftGraphDriveItemVersions, nil
+}
+
+// GetMicrosoftGraphAPIMeDriveVersionContentURL returns the download URL of the
+// version id of the file at drive root path str
+func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveVersionContentURL(odd *description.OneDriveDescription, str, id string) (string, error) {
+	return api.UseMicrosoftGraphAPIGetRedirect(odd.UseMicrosoftGraphAPIMeDriveActionPath(str, "versions/"+url.PathEscape(id)+"/content"))
+}
+
+// PostMicrosoftGraphAPIMeDriveVersionRestore makes the version id the current
+// version of the file at drive root path str
+func (api *MicrosoftGraphAPI) PostMicrosoftGraphAPIMeDriveVersionRestore(odd *description.OneDriveDescription, str, id string) error {
+	_, err := api.UseMicrosoftGraphAPIPost(odd.UseMicrosoftGraphAPIMeDriveActionPath(str, "versions/"+url.PathEscape(id)+"/restoreVersion"), strings.NewReader(""))
+	return err
+}
+
+// GetMicrosoftGraphAPIMeDriveDelta requests a page of the changes of the whole
+// drive since the delta or next link str, from the beginning if empty
+func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveDelta(odd *description.OneDriveDescription, str string) (*graphapi.MicrosoftGraphDriveItemCollection, error) {
+	if str == "" {
+		str = "/me/drive/root/delta?$select=id,name,size,cTag,file,folder,root,deleted,parentReference,lastModifiedDateTime,lastModifiedBy"
+	}
+	bytes, err := api.UseMicrosoftGraphAPIGet(str)
+	if err != nil {
+		return nil, err
+	}
+	microsoftGraphDriveItemCollection := graphapi.MicrosoftGraphDriveItemCollection{}
+	if err := json.Unmarshal(bytes, &microsoftGraphDriveItemCollection); err != nil {
+		return nil, err
+	}
+	return &microsoftGraphDriveItemCollection, nil
+}
+
+// GetMicrosoftGraphAPIMeDriveActivities lists the recent activities of the
+// item at drive root path str by the beta endpoint, up to maxPages pages, the
+// personal drives do NOT support it
+func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIMeDriveActivities(odd *description.OneDriveDescription, str string, maxPages int) ([]graphapi.MicrosoftGraphItemActivity, error) {
+	microsoftGraphItemActivities := []graphapi.MicrosoftGraphItemActivity{}
+	reqURL := api.MicrosoftEndPoints.UseMicrosoftGraphAPIBetaEndPointURL(odd.UseMicrosoftGraphAPIMeDriveActionPath(str, "activities") + "?$expand=driveItem($select=id,name,size,file,folder,parentReference)")
+	for page := 0; reqURL != "" && page < maxPages; page++ {
+		bytes, err := api.UseMicrosoftGraphAPIGet(reqURL)
+		if err != nil {
+			return nil, err
+		}
+		microsoftGraphItemActivityCollection := graphapi.MicrosoftGraphItemActivityCollection{}
+		if err := json.Unmarshal(bytes, &microsoftGraphItemActivityCollection); err != nil {
+			return nil, err
+		}
+		microsoftGraphItemActivities = append(microsoftGraphItemActivities, microsoftGraphItemActivityCollection.Value...)
+		reqURL = ""
+		if microsoftGraphItemActivityCollection.AtODataNextLink != nil {
+			reqURL = *microsoftGraphItemActivityCollection.AtODataNextLink
+		}
+	}
+	return microsoftGraphItemActivities, nil
+}
+
+func unmarshalMicrosoftGraphDriveItem(bytes []byte) (*graphapi.MicrosoftGraphDriveItem, error) {
+	microsoftGraphDriveItem := graphapi.MicrosoftGraphDriveItem{}
+	if err := json.Unmarshal(bytes, &microsoftGraphDriveItem); err != nil {
+		return nil, err
+	}
+	return &microsoftGraphDriveItem, nil
+}
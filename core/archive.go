@@ -0,0 +1,245 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+var (
+	ErrArchiveNotFolder         = errors.New("ArchiveNotFolder")
+	ErrArchiveFileOnly          = errors.New("ArchiveDriveVolumeMountFileOnly")
+	ErrArchiveSizeExceeded      = errors.New("ArchiveMaxSizeExceeded")
+	ErrArchiveFileCountExceeded = errors.New("ArchiveMaxFileCountExceeded")
+	ErrArchiveUnknownFormat     = errors.New("ArchiveUnknownFormat")
+)
+
+// Archive describes a folder to be streamed as a ZIP or tar.gz archive, the
+// whole tree is listed before writing so limits fail before any byte is sent
+type Archive struct {
+	Name      string
+	Size      int64
+	FileCount int
+	entries   []archiveEntry
+	od        *OneDrive
+	isAllowed func(path string) bool
+}
+
+type archiveEntry struct {
+	name           string
+	od             *OneDrive // drive of the volume mount source
+	path           string    // drive root path
+	size           int64
+	lastModifiedAt time.Time
+	file           *graphapi.MicrosoftGraphFile
+	downloadURL    *string
+}
+
+// NewMicrosoftGraphDriveArchive lists the folder at the virtual path, selected
+// limits the archive to the named children of the folder, volume mounts
+// inside the folder are walked as well, the items whose virtual path is NOT
+// allowed and the file.only volume mounts are left out
+func (od *OneDrive) NewMicrosoftGraphDriveArchive(path string, selected []string, isAllowed func(path string) bool) (*Archive, error) {
+	newPath := utils.RegularPath(path)
+	_, _, driveVolumeMountRule, err := od.ResolveDriveVolumeMount(newPath)
+	if err != nil {
+		return nil, err
+	}
+	switch driveVolumeMountRule.GetType() {
+	case description.DriveVolumeMountFileOnly:
+		return nil, ErrArchiveFileOnly
+	case description.DriveVolumeMountRedirect:
+		return nil, ErrArchiveNotFolder
+	}
+	_, name := utils.RegularPathToPathFilename(newPath)
+	if name == "" {
+		name = "root"
+		if od.OneDriveDescription.OneDriveName != nil {
+			name = *od.OneDriveDescription.OneDriveName
+		}
+	}
+	archive := &Archive{
+		Name:      name,
+		od:        od,
+		isAllowed: isAllowed,
+	}
+	selectedNames := map[string]bool{}
+	for _, s := range selected {
+		selectedNames[s] = true
+	}
+	if err := archive.walk(newPath, "", selectedNames); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func (a *Archive) walk(path, prefix string, selectedNames map[string]bool) error {
+	odd := a.od.OneDriveDescription
+	children, err := a.od.listMicrosoftGraphDriveItemChildren(path)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if len(selectedNames) > 0 && !selectedNames[child.Name] {
+			continue
+		}
+		childPath := joinSubPath(path, child.Name)
+		if a.isAllowed != nil && !a.isAllowed(childPath) {
+			continue
+		}
+		sourceOneDrive, sourcePath, driveVolumeMountRule, err := a.od.ResolveDriveVolumeMount(childPath)
+		if err != nil {
+			continue
+		}
+		if mountType := driveVolumeMountRule.GetType(); mountType == description.DriveVolumeMountRedirect || mountType == description.DriveVolumeMountFileOnly {
+			continue
+		}
+		entry := archiveEntry{
+			name:           prefix + child.Name,
+			od:             sourceOneDrive,
+			path:           sourceOneDrive.OneDriveDescription.RelativePathToDriveRootPath(sourcePath),
+			lastModifiedAt: time.Unix(child.LastModifiedAt, 0).UTC(),
+		}
+		if child.Folder != nil {
+			entry.name += "/"
+			a.entries = append(a.entries, entry)
+			if err := a.walk(childPath, entry.name, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		entry.size = child.Size
+		entry.file = child.File
+		entry.downloadURL = child.AtMicrosoftGraphDownloadURL
+		a.entries = append(a.entries, entry)
+		a.Size += child.Size
+		a.FileCount++
+		if a.Size > odd.GetArchiveMaxSize() {
+			return ErrArchiveSizeExceeded
+		}
+		if a.FileCount > odd.GetArchiveMaxFileCount() {
+			return ErrArchiveFileCountExceeded
+		}
+	}
+	return nil
+}
+
+// listMicrosoftGraphDriveItemChildren lists the folder at the virtual path
+// from the cache and falls back to Microsoft Graph on cache miss
+func (od *OneDrive) listMicrosoftGraphDriveItemChildren(path string) ([]cache.MicrosoftGraphDriveItemCache, error) {
+	microsoftGraphDriveItemCache, err := od.StatMicrosoftGraphDriveItem(path)
+	if err != nil {
+		return nil, err
+	}
+	if microsoftGraphDriveItemCache.Folder == nil {
+		return nil, ErrArchiveNotFolder
+	}
+	return microsoftGraphDriveItemCache.Children, nil
+}
+
+// Write streams the archive to w in format zip or tar.gz
+func (a *Archive) Write(w io.Writer, format string) error {
+	switch format {
+	case "", "zip":
+		return a.writeZip(w)
+	case "tar.gz", "tgz":
+		return a.writeTarGz(w)
+	}
+	return ErrArchiveUnknownFormat
+}
+
+func (a *Archive) writeZip(w io.Writer) error {
+	zipWriter := zip.NewWriter(w)
+	for _, entry := range a.entries {
+		header := &zip.FileHeader{
+			Name:     entry.name,
+			Method:   zip.Store, // most drive content is compressed already
+			Modified: entry.lastModifiedAt,
+		}
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := a.copyEntry(writer, entry); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func (a *Archive) writeTarGz(w io.Writer) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range a.entries {
+		header := &tar.Header{
+			Name:    entry.name,
+			Mode:    0644,
+			Size:    entry.size,
+			ModTime: entry.lastModifiedAt,
+		}
+		isFolder := entry.name[len(entry.name)-1] == '/'
+		if isFolder {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+			header.Size = 0
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if isFolder {
+			continue
+		}
+		if err := a.copyEntry(tarWriter, entry); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// copyEntry copies the content of entry to w, the download URL is resolved
+// again when the cached one expired while streaming, a content whose hashes
+// mismatch is cut short and fails the archive
+func (a *Archive) copyEntry(w io.Writer, entry archiveEntry) error {
+	if entry.size == 0 {
+		return nil
+	}
+	od := a.od
+	if entry.od != nil {
+		od = entry.od
+	}
+	var content io.ReadCloser = nil
+	var err error = errors.New("NoDownloadURL " + entry.path)
+	if entry.downloadURL != nil {
+		content, err = od.OpenMicrosoftGraphDownloadURL(*entry.downloadURL, entry.file)
+	}
+	if err != nil {
+		log.Println("a.copyEntry", err, "resolving", entry.path)
+		odd := od.OneDriveDescription
+		microsoftGraphDriveItem, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveItem(&odd, entry.path)
+		if err != nil {
+			return err
+		}
+		if microsoftGraphDriveItem.AtMicrosoftGraphDownloadURL == nil {
+			return errors.New("a.copyEntry NoDownloadURL " + entry.path)
+		}
+		content, err = od.OpenMicrosoftGraphDownloadURL(*microsoftGraphDriveItem.AtMicrosoftGraphDownloadURL, microsoftGraphDriveItem.File)
+		if err != nil {
+			return err
+		}
+	}
+	defer content.Close()
+	_, err = io.Copy(w, content)
+	return err
+}
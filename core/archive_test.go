@@ -0,0 +1,90 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestArchiveWriteZip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+	downloadURL := server.URL + "/e01.mkv"
+	archive := &Archive{
+		Name: "s01",
+		od:   &OneDrive{},
+		entries: []archiveEntry{
+			{name: "extras/"},
+			{name: "e01.mkv", size: int64(len("/e01.mkv")), downloadURL: &downloadURL},
+		},
+	}
+	buf := &bytes.Buffer{}
+	if err := archive.Write(buf, "zip"); err != nil {
+		t.Fatalf("%s", err)
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(zipReader.File) != 2 {
+		t.Fatalf("got %d entries, want 2", len(zipReader.File))
+	}
+	f, err := zipReader.File[1].Open()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer f.Close()
+	data, _ := ioutil.ReadAll(f)
+	if string(data) != "/e01.mkv" {
+		t.Errorf("got %q", data)
+	}
+	if err := archive.Write(buf, "rar"); err != ErrArchiveUnknownFormat {
+		t.Errorf("got %v, want ErrArchiveUnknownFormat", err)
+	}
+}
+
+func TestNewMicrosoftGraphDriveArchive(t *testing.T) {
+	od := newTestRootOneDrive("media", "private", "public")
+	od.OneDriveDescription.DriveVolumeMounts = []description.DriveVolumeMount{
+		newTestDriveVolumeMount("file.only", "", "/public", "/clips"),
+	}
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	root := &od.DriveCacheCollection.MicrosoftGraphDriveItemCache[0]
+	for i := range root.Children {
+		root.Children[i].Folder.ChildCount = 1
+	}
+	root.Children = append(root.Children, newTestFile("/drive/root:", "a.mkv", 1, day))
+	for _, folder := range []string{"private", "public"} {
+		od.DriveCacheCollection.MicrosoftGraphDriveItemCache = append(od.DriveCacheCollection.MicrosoftGraphDriveItemCache, cache.MicrosoftGraphDriveItemCache{
+			CacheDescription: &cache.CacheDescription{Path: "/drive/root:/" + folder, LastUpdateAt: time.Now().Unix(), Status: "Cached"},
+			Folder:           &graphapi.MicrosoftGraphFolder{ChildCount: 1},
+			Children:         []cache.MicrosoftGraphDriveItemCache{newTestFile("/drive/root:/"+folder, "x.mkv", 1, day)},
+		})
+	}
+
+	// The paths NOT allowed and the file.only volume mounts are left out
+	archive, err := od.NewMicrosoftGraphDriveArchive("/", nil, func(path string) bool {
+		return path != "/private"
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	names := []string{}
+	for _, entry := range archive.entries {
+		names = append(names, entry.name)
+	}
+	if strings.Join(names, ",") != "public/,public/x.mkv,a.mkv" {
+		t.Errorf("got %v", names)
+	}
+}
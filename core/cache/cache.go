@@ -134,9 +134,11 @@ func (dcc *DriveCacheCollection) Save(microsoftGraphDrive *graphapi.MicrosoftGra
 	oneDriveCache := struct {
 		DriveDescriptionCache        *graphapi.MicrosoftGraphDrive  `json:"driveDescriptionCache"`
 		MicrosoftGraphDriveItemCache []MicrosoftGraphDriveItemCache `json:"microsoftGraphDriveItemCache"`
+		Tombstones                   []Tombstone                    `json:"tombstones,omitempty"`
 	}{
 		microsoftGraphDrive,
 		dcc.MicrosoftGraphDriveItemCache,
+		dcc.Tombstones,
 	}
 
 	cacheFile := microsoftGraphDrive.ID + ".cache.json"
@@ -3,9 +3,101 @@ package cache_test
 import (
 	"testing"
 	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/graphapi"
 )
 
 func Test(t *testing.T) {
 	lastModifiedAt, _ := time.Parse("2020-01-05T22:53:19Z", "2020-01-05T22:53:19Z")
 	t.Logf("%s", lastModifiedAt)
 }
+
+func TestUpsertAndRemoveMicrosoftGraphDriveItemCache(t *testing.T) {
+	createdAt := time.Now()
+	dcc := &cache.DriveCacheCollection{
+		MicrosoftGraphDriveItemCache: []cache.MicrosoftGraphDriveItemCache{
+			{
+				CacheDescription: &cache.CacheDescription{Path: "/drive/root:"},
+				Children: []cache.MicrosoftGraphDriveItemCache{
+					{ID: "1", Name: "tv.shows", Folder: &graphapi.MicrosoftGraphFolder{}},
+				},
+			},
+			{
+				CacheDescription: &cache.CacheDescription{Path: "/drive/root:/tv.shows"},
+			},
+		},
+	}
+	err := dcc.UpsertMicrosoftGraphDriveItemCache("/drive/root:/tv.shows/s01", &graphapi.MicrosoftGraphDriveItem{
+		ID:                   "2",
+		Name:                 "s01",
+		Folder:               &graphapi.MicrosoftGraphFolder{},
+		CreatedDateTime:      &createdAt,
+		LastModifiedDateTime: &createdAt,
+		ParentReference:      &graphapi.MicrosoftGraphItemReference{Path: "/drive/root:/tv.shows"},
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if n := len(dcc.MicrosoftGraphDriveItemCache[1].Children); n != 1 {
+		t.Fatalf("got %d children, want 1", n)
+	}
+	if n := dcc.MicrosoftGraphDriveItemCache[0].Children[0].Folder.ChildCount; n != 1 {
+		t.Errorf("got child count %d, want 1", n)
+	}
+	dcc.RemoveMicrosoftGraphDriveItemCache("/drive/root:/tv.shows")
+	if n := len(dcc.MicrosoftGraphDriveItemCache); n != 1 {
+		t.Fatalf("got %d cached folders, want 1", n)
+	}
+	if n := len(dcc.MicrosoftGraphDriveItemCache[0].Children); n != 0 {
+		t.Errorf("got %d children, want 0", n)
+	}
+}
+
+func TestTombstones(t *testing.T) {
+	dcc := &cache.DriveCacheCollection{
+		MicrosoftGraphDriveItemCache: []cache.MicrosoftGraphDriveItemCache{
+			{
+				CacheDescription: &cache.CacheDescription{Path: "/drive/root:"},
+				Children: []cache.MicrosoftGraphDriveItemCache{
+					{ID: "1", Name: "tv.shows", Folder: &graphapi.MicrosoftGraphFolder{ChildCount: 2}},
+				},
+			},
+			{
+				ID:               "1",
+				CacheDescription: &cache.CacheDescription{Path: "/drive/root:/tv.shows"},
+				Children: []cache.MicrosoftGraphDriveItemCache{
+					{ID: "2", Name: "s01", Folder: &graphapi.MicrosoftGraphFolder{}},
+					{ID: "3", Name: "s02", Folder: &graphapi.MicrosoftGraphFolder{}},
+				},
+			},
+			{
+				ID:               "2",
+				CacheDescription: &cache.CacheDescription{Path: "/drive/root:/tv.shows/s01"},
+			},
+		},
+	}
+	dcc.AddTombstone(cache.Tombstone{ID: "2", Name: "s01", Path: "/drive/root:/tv.shows/s01", DeletedAt: time.Now()})
+	if n := len(dcc.MicrosoftGraphDriveItemCache); n != 2 {
+		t.Fatalf("got %d cached folders, want 2", n)
+	}
+	if children := dcc.MicrosoftGraphDriveItemCache[1].Children; len(children) != 1 || children[0].ID != "3" {
+		t.Errorf("got %+v", children)
+	}
+	if n := dcc.MicrosoftGraphDriveItemCache[0].Children[0].Folder.ChildCount; n != 1 {
+		t.Errorf("got child count %d, want 1", n)
+	}
+
+	// A listing cached before the deletion still hides the item
+	children := dcc.FilterTombstones([]cache.MicrosoftGraphDriveItemCache{{ID: "2"}, {ID: "3"}})
+	if len(children) != 1 || children[0].ID != "3" {
+		t.Errorf("got %+v", children)
+	}
+	dcc.AddTombstone(cache.Tombstone{ID: "9", DeletedAt: time.Now().Add(-cache.TombstoneMaxAge)})
+	if tombstones := dcc.ListTombstones(); len(tombstones) != 1 || tombstones[0].ID != "2" {
+		t.Errorf("got %+v", tombstones)
+	}
+	if !dcc.RemoveTombstone("2") || dcc.RemoveTombstone("2") {
+		t.Errorf("got %+v", dcc.Tombstones)
+	}
+}
@@ -4,6 +4,7 @@ import "github.com/AirWSW/onedrive/graphapi"
 
 type DriveCacheCollection struct {
 	MicrosoftGraphDriveItemCache []MicrosoftGraphDriveItemCache `json:"microsoftGraphDriveItemCache,omitempty"`
+	Tombstones                   []Tombstone                    `json:"tombstones,omitempty"`
 }
 
 // MicrosoftGraphDriveItemCache describes the MicrosoftGraphDriveItem cache structure
@@ -30,6 +31,23 @@ type MicrosoftGraphDriveItemCache struct {
 
 	/* instance annotations */
 	AtMicrosoftGraphDownloadURL *string `json:"@microsoft.graph.downloadUrl"`
+
+	/* rich metadata */
+	Image    *graphapi.MicrosoftGraphImage          `json:"image,omitempty"`
+	Photo    *graphapi.MicrosoftGraphPhoto          `json:"photo,omitempty"`
+	Video    *graphapi.MicrosoftGraphVideo          `json:"video,omitempty"`
+	Audio    *graphapi.MicrosoftGraphAudio          `json:"audio,omitempty"`
+	Location *graphapi.MicrosoftGraphGEOCoordinates `json:"location,omitempty"`
+}
+
+// SetRichMetadata keeps the image, photo, video, audio and location facets of
+// the item
+func (microsoftGraphDriveItemCache *MicrosoftGraphDriveItemCache) SetRichMetadata(microsoftGraphDriveItem *graphapi.MicrosoftGraphDriveItem) {
+	microsoftGraphDriveItemCache.Image = microsoftGraphDriveItem.Image
+	microsoftGraphDriveItemCache.Photo = microsoftGraphDriveItem.Photo
+	microsoftGraphDriveItemCache.Video = microsoftGraphDriveItem.Video
+	microsoftGraphDriveItemCache.Audio = microsoftGraphDriveItem.Audio
+	microsoftGraphDriveItemCache.Location = microsoftGraphDriveItem.Location
 }
 
 type CacheDescription struct {
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// UpsertMicrosoftGraphDriveItemCache inserts or replaces the item in the
+// cached children of its parent folder, path is the drive root path
+func (dcc *DriveCacheCollection) UpsertMicrosoftGraphDriveItemCache(path string, microsoftGraphDriveItem *graphapi.MicrosoftGraphDriveItem) error {
+	if microsoftGraphDriveItem.ParentReference == nil {
+		return errors.New("dcc.UpsertMicrosoftGraphDriveItemCache NoParentReference " + path)
+	}
+	newMicrosoftGraphDriveItemCache, err := DriveItemToCache(microsoftGraphDriveItem)
+	if err != nil {
+		return err
+	}
+	newMicrosoftGraphDriveItemCache.CacheDescription = nil
+	newMicrosoftGraphDriveItemCache.Children = nil
+	parentPath, _ := utils.RegularPathToPathFilename(path)
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i, microsoftGraphDriveItemCache := range dcc.MicrosoftGraphDriveItemCache {
+		if microsoftGraphDriveItemCache.CacheDescription.Path != parentPath {
+			continue
+		}
+		children := dcc.MicrosoftGraphDriveItemCache[i].Children
+		replaced := false
+		for j, child := range children {
+			if child.ID == newMicrosoftGraphDriveItemCache.ID {
+				children[j] = *newMicrosoftGraphDriveItemCache
+				replaced = true
+			}
+		}
+		if !replaced {
+			children = append(children, *newMicrosoftGraphDriveItemCache)
+		}
+		dcc.MicrosoftGraphDriveItemCache[i].Children = children
+	}
+	dcc.updateChildCount(parentPath)
+	return nil
+}
+
+// RemoveMicrosoftGraphDriveItemCache removes the item from the cached children
+// of its parent folder and drops the cached subtree, path is the drive root path
+func (dcc *DriveCacheCollection) RemoveMicrosoftGraphDriveItemCache(path string) {
+	parentPath, filename := utils.RegularPathToPathFilename(path)
+	mutex.Lock()
+	defer mutex.Unlock()
+	microsoftGraphDriveItemCaches := []MicrosoftGraphDriveItemCache{}
+	for _, microsoftGraphDriveItemCache := range dcc.MicrosoftGraphDriveItemCache {
+		cachePath := microsoftGraphDriveItemCache.CacheDescription.Path
+		if cachePath == path || strings.HasPrefix(cachePath, path+"/") {
+			continue
+		}
+		if cachePath == parentPath {
+			children := []MicrosoftGraphDriveItemCache{}
+			for _, child := range microsoftGraphDriveItemCache.Children {
+				if child.Name != filename {
+					children = append(children, child)
+				}
+			}
+			microsoftGraphDriveItemCache.Children = children
+		}
+		microsoftGraphDriveItemCaches = append(microsoftGraphDriveItemCaches, microsoftGraphDriveItemCache)
+	}
+	dcc.MicrosoftGraphDriveItemCache = microsoftGraphDriveItemCaches
+	dcc.updateChildCount(parentPath)
+}
+
+// updateChildCount keeps the folder facet of path in its parent folder in
+// sync, an outdated zero child count hides the children of the folder
+func (dcc *DriveCacheCollection) updateChildCount(path string) {
+	childCount := -1
+	for _, microsoftGraphDriveItemCache := range dcc.MicrosoftGraphDriveItemCache {
+		if microsoftGraphDriveItemCache.CacheDescription.Path == path {
+			childCount = len(microsoftGraphDriveItemCache.Children)
+		}
+	}
+	if childCount < 0 {
+		return
+	}
+	parentPath, filename := utils.RegularPathToPathFilename(path)
+	for i, microsoftGraphDriveItemCache := range dcc.MicrosoftGraphDriveItemCache {
+		if microsoftGraphDriveItemCache.CacheDescription.Path != parentPath {
+			continue
+		}
+		for j, child := range microsoftGraphDriveItemCache.Children {
+			if child.Name == filename && child.Folder != nil {
+				folder := *child.Folder
+				folder.ChildCount = int32(childCount)
+				dcc.MicrosoftGraphDriveItemCache[i].Children[j].Folder = &folder
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package cache
+
+// Stat sums up the cache of a drive, the update times are unix times of the
+// cached folders, the failed ones left out as they are NOT refreshed again
+type Stat struct {
+	Folders        int   `json:"folders"`
+	Items          int   `json:"items"` // cached children of all folders
+	Failed         int   `json:"failed"`
+	Tombstones     int   `json:"tombstones"`
+	OldestUpdateAt int64 `json:"oldestUpdateAt,omitempty"`
+	LatestUpdateAt int64 `json:"latestUpdateAt,omitempty"`
+}
+
+// Stat sums up the cache
+func (dcc *DriveCacheCollection) Stat() Stat {
+	mutex.Lock()
+	defer mutex.Unlock()
+	stat := Stat{
+		Folders:    len(dcc.MicrosoftGraphDriveItemCache),
+		Tombstones: len(dcc.Tombstones),
+	}
+	for _, microsoftGraphDriveItemCache := range dcc.MicrosoftGraphDriveItemCache {
+		stat.Items += len(microsoftGraphDriveItemCache.Children)
+		cacheDescription := microsoftGraphDriveItemCache.CacheDescription
+		if cacheDescription == nil {
+			continue
+		}
+		if cacheDescription.Status == "Failed" {
+			stat.Failed++
+			continue
+		}
+		if stat.OldestUpdateAt == 0 || cacheDescription.LastUpdateAt < stat.OldestUpdateAt {
+			stat.OldestUpdateAt = cacheDescription.LastUpdateAt
+		}
+		if cacheDescription.LastUpdateAt > stat.LatestUpdateAt {
+			stat.LatestUpdateAt = cacheDescription.LastUpdateAt
+		}
+	}
+	return stat
+}
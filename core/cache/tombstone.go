@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// TombstoneMaxSize and TombstoneMaxAge bound the tombstones kept for each
+// drive, the recycle bin of OneDrive keeps the deleted items for 30 days at
+// least
+var (
+	TombstoneMaxSize = 1000
+	TombstoneMaxAge  = 30 * 24 * time.Hour
+)
+
+// Tombstone records a deleted item, the path is the drive root path it had
+type Tombstone struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	IsFolder  bool      `json:"isFolder"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// AddTombstone records the deleted item and removes it from the cached
+// children of its parent folder and its cached subtree, by ID as another item
+// may take its name
+func (dcc *DriveCacheCollection) AddTombstone(tombstone Tombstone) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	tombstones := []Tombstone{}
+	for _, oldTombstone := range dcc.Tombstones {
+		if oldTombstone.ID != tombstone.ID && time.Since(oldTombstone.DeletedAt) < TombstoneMaxAge {
+			tombstones = append(tombstones, oldTombstone)
+		}
+	}
+	tombstones = append(tombstones, tombstone)
+	if over := len(tombstones) - TombstoneMaxSize; over > 0 {
+		tombstones = tombstones[over:]
+	}
+	dcc.Tombstones = tombstones
+
+	removedPaths := []string{}
+	for _, microsoftGraphDriveItemCache := range dcc.MicrosoftGraphDriveItemCache {
+		if microsoftGraphDriveItemCache.ID == tombstone.ID {
+			removedPaths = append(removedPaths, microsoftGraphDriveItemCache.CacheDescription.Path)
+		}
+	}
+	microsoftGraphDriveItemCaches := []MicrosoftGraphDriveItemCache{}
+	parentPaths := []string{}
+	for _, microsoftGraphDriveItemCache := range dcc.MicrosoftGraphDriveItemCache {
+		if isTombstonePathIn(microsoftGraphDriveItemCache.CacheDescription.Path, removedPaths) {
+			continue
+		}
+		children := dcc.filterTombstones(microsoftGraphDriveItemCache.Children)
+		if len(children) != len(microsoftGraphDriveItemCache.Children) {
+			microsoftGraphDriveItemCache.Children = children
+			parentPaths = append(parentPaths, microsoftGraphDriveItemCache.CacheDescription.Path)
+		}
+		microsoftGraphDriveItemCaches = append(microsoftGraphDriveItemCaches, microsoftGraphDriveItemCache)
+	}
+	dcc.MicrosoftGraphDriveItemCache = microsoftGraphDriveItemCaches
+	for _, parentPath := range parentPaths {
+		dcc.updateChildCount(parentPath)
+	}
+}
+
+// RemoveTombstone forgets the tombstone of the item id, which is restored
+func (dcc *DriveCacheCollection) RemoveTombstone(id string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i, tombstone := range dcc.Tombstones {
+		if tombstone.ID == id {
+			dcc.Tombstones = append(dcc.Tombstones[:i:i], dcc.Tombstones[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ListTombstones returns the tombstones younger than TombstoneMaxAge, the
+// latest deleted first
+func (dcc *DriveCacheCollection) ListTombstones() []Tombstone {
+	mutex.Lock()
+	defer mutex.Unlock()
+	tombstones := []Tombstone{}
+	for _, tombstone := range dcc.Tombstones {
+		if time.Since(tombstone.DeletedAt) < TombstoneMaxAge {
+			tombstones = append(tombstones, tombstone)
+		}
+	}
+	sort.SliceStable(tombstones, func(i, j int) bool {
+		return tombstones[i].DeletedAt.After(tombstones[j].DeletedAt)
+	})
+	return tombstones
+}
+
+// FilterTombstones leaves out the children with a tombstone, a listing
+// requested before the deletion may still hold them
+func (dcc *DriveCacheCollection) FilterTombstones(children []MicrosoftGraphDriveItemCache) []MicrosoftGraphDriveItemCache {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return dcc.filterTombstones(children)
+}
+
+func (dcc *DriveCacheCollection) filterTombstones(children []MicrosoftGraphDriveItemCache) []MicrosoftGraphDriveItemCache {
+	if len(dcc.Tombstones) == 0 {
+		return children
+	}
+	isDeleted := map[string]bool{}
+	for _, tombstone := range dcc.Tombstones {
+		isDeleted[tombstone.ID] = true
+	}
+	newChildren := []MicrosoftGraphDriveItemCache{}
+	for _, child := range children {
+		if !isDeleted[child.ID] {
+			newChildren = append(newChildren, child)
+		}
+	}
+	return newChildren
+}
+
+func isTombstonePathIn(path string, paths []string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package collection
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/AirWSW/onedrive/core/access"
+)
+
+var accessSecret []byte
+var accessSecretOnce sync.Once
+
+// AuthenticateAccessUser returns the user of the bearer token or the basic
+// credentials of r, which is nil for anonymous requests, an unknown bearer
+// token is NOT ok while unknown basic credentials stay anonymous as their
+// password may unlock a volume mount
+func (odc *OneDriveCollection) AuthenticateAccessUser(r *http.Request) (*AccessUser, bool) {
+	if odc.AccessConfig == nil {
+		return nil, true
+	}
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		token := strings.TrimPrefix(authorization, "Bearer ")
+		for i, user := range odc.AccessConfig.Users {
+			if user.Token != "" && subtle.ConstantTimeCompare([]byte(user.Token), []byte(token)) == 1 {
+				return &odc.AccessConfig.Users[i], true
+			}
+		}
+		return nil, false
+	}
+	if name, password, ok := r.BasicAuth(); ok {
+		for i, user := range odc.AccessConfig.Users {
+			if user.Name == name && user.Password != "" && subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1 {
+				return &odc.AccessConfig.Users[i], true
+			}
+		}
+	}
+	return nil, true
+}
+
+// UseAccessRole returns the role of user on drive, anonymous users read all
+// drives unless configured otherwise, and without access config the debug
+// mode grants admin to everyone
+func (odc *OneDriveCollection) UseAccessRole(user *AccessUser, drive string) access.Role {
+	if odc.AccessConfig == nil {
+		if odc.IsDebugMode != nil && *odc.IsDebugMode {
+			return access.RoleAdmin
+		}
+		return access.RoleRead
+	}
+	if user != nil {
+		role, _ := access.UseRole(user.Roles, drive)
+		return role
+	}
+	if odc.AccessConfig.AnonymousRoles == nil {
+		return access.RoleRead
+	}
+	role, _ := access.UseRole(odc.AccessConfig.AnonymousRoles, drive)
+	return role
+}
+
+// UseS3AccessRole returns the role of the S3 access key id on drive, which is
+// the role of its user, a key of an unknown user has none
+func (odc *OneDriveCollection) UseS3AccessRole(accessKeyID, drive string) access.Role {
+	if odc.S3Config == nil {
+		return access.RoleNone
+	}
+	for _, accessKey := range odc.S3Config.AccessKeys {
+		if accessKey.AccessKeyID != accessKeyID {
+			continue
+		}
+		if accessKey.User == "" {
+			return odc.UseAccessRole(nil, drive)
+		}
+		if odc.AccessConfig == nil {
+			return access.RoleNone
+		}
+		for i, user := range odc.AccessConfig.Users {
+			if user.Name == accessKey.User {
+				return odc.UseAccessRole(&odc.AccessConfig.Users[i], drive)
+			}
+		}
+		return access.RoleNone
+	}
+	return access.RoleNone
+}
+
+// UseAccessSecret returns the configured secret signing unlock tokens, a
+// random secret is used for the process lifetime if none is configured
+func (odc *OneDriveCollection) UseAccessSecret() []byte {
+	if odc.AccessConfig != nil && odc.AccessConfig.Secret != "" {
+		return []byte(odc.AccessConfig.Secret)
+	}
+	accessSecretOnce.Do(func() {
+		accessSecret = make([]byte, 32)
+		if _, err := rand.Read(accessSecret); err != nil {
+			log.Panicln(err)
+		}
+	})
+	return accessSecret
+}
@@ -2,6 +2,7 @@ package collection
 
 import (
 	"encoding/json"
+	"log"
 
 	"github.com/AirWSW/onedrive/core"
 	"github.com/AirWSW/onedrive/core/description"
@@ -15,6 +16,10 @@ func (odc *OneDriveCollection) StartAll() error {
 			return err
 		}
 	}
+	odc.InitNamespace()
+	if err := odc.InitShortLinks(); err != nil {
+		log.Println("odc.StartAll", err)
+	}
 	if err := odc.SaveConfigFile(); err != nil {
 		return err
 	}
@@ -24,8 +29,37 @@ func (odc *OneDriveCollection) StartAll() error {
 	return nil
 }
 
+// InitNamespace creates the virtual drive aggregating all drives when
+// configured, each drive is mounted at /<oneDriveName> by default
+func (odc *OneDriveCollection) InitNamespace() {
+	namespaceConfig := odc.NamespaceConfig
+	if namespaceConfig == nil || namespaceConfig.OneDriveName == "" {
+		return
+	}
+	driveVolumeMounts := namespaceConfig.DriveVolumeMounts
+	if len(driveVolumeMounts) == 0 {
+		for _, oneDrive := range odc.OneDrives {
+			if oneDrive.OneDriveDescription.OneDriveName == nil {
+				continue
+			}
+			drive, source, target := *oneDrive.OneDriveDescription.OneDriveName, "/", "/"+*oneDrive.OneDriveDescription.OneDriveName
+			driveVolumeMounts = append(driveVolumeMounts, description.DriveVolumeMount{
+				Drive:  &drive,
+				Source: &source,
+				Target: &target,
+			})
+		}
+	}
+	odc.namespace = core.NewNamespaceOneDrive(namespaceConfig.OneDriveName, driveVolumeMounts, odc)
+}
+
 func (odc *OneDriveCollection) GetDescription() ([]byte, error) {
 	var odcDescription []description.OneDriveDescription
+	if odc.namespace != nil {
+		odcDescription = append(odcDescription, description.OneDriveDescription{
+			OneDriveName: odc.namespace.OneDriveDescription.OneDriveName,
+		})
+	}
 	for _, oneDrive := range odc.OneDrives {
 		oneDriveDescription := oneDrive.OneDriveDescription
 		newOneDriveDescription := description.OneDriveDescription{
@@ -36,7 +70,15 @@ func (odc *OneDriveCollection) GetDescription() ([]byte, error) {
 	return json.Marshal(odcDescription)
 }
 
+// UseDefaultOneDrive returns the virtual drive if configured as default, the
+// first drive otherwise
 func (odc *OneDriveCollection) UseDefaultOneDrive() *core.OneDrive {
+	if odc.namespace != nil && odc.NamespaceConfig.IsDefault {
+		return odc.namespace
+	}
+	if len(odc.OneDrives) == 0 {
+		return nil
+	}
 	return odc.OneDrives[0]
 }
 
@@ -50,6 +92,9 @@ func (odc *OneDriveCollection) UseOneDriveByID(str string) *core.OneDrive {
 }
 
 func (odc *OneDriveCollection) UseOneDriveByOneDriveName(str string) *core.OneDrive {
+	if odc.namespace != nil && *odc.namespace.OneDriveDescription.OneDriveName == str {
+		return odc.namespace
+	}
 	for _, oneDrive := range odc.OneDrives {
 		if oneDrive.OneDriveDescription.OneDriveName != nil && *oneDrive.OneDriveDescription.OneDriveName == str {
 			return oneDrive
@@ -66,3 +111,16 @@ func (odc *OneDriveCollection) UseOneDriveByStateID(str string) *core.OneDrive {
 	}
 	return nil
 }
+
+// UseS3SecretAccessKey returns the secret of the S3 access key id
+func (odc *OneDriveCollection) UseS3SecretAccessKey(accessKeyID string) (string, bool) {
+	if odc.S3Config == nil {
+		return "", false
+	}
+	for _, accessKey := range odc.S3Config.AccessKeys {
+		if accessKey.AccessKeyID == accessKeyID {
+			return accessKey.SecretAccessKey, true
+		}
+	}
+	return "", false
+}
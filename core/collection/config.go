@@ -62,12 +62,20 @@ func (odc *OneDriveCollection) SaveConfigFile() error {
 		})
 	}
 	newODC := struct {
-		IsDebugMode  *bool         `json:"isDebugMode"`
-		PageTemplate *string       `json:"pageTemplate"`
-		OneDrives    []interface{} `json:"oneDrives"`
+		IsDebugMode     *bool            `json:"isDebugMode"`
+		PageTemplate    *string          `json:"pageTemplate"`
+		PublicBaseURL   string           `json:"publicBaseUrl,omitempty"`
+		S3Config        *S3Config        `json:"s3Config,omitempty"`
+		AccessConfig    *AccessConfig    `json:"accessConfig,omitempty"`
+		NamespaceConfig *NamespaceConfig `json:"namespaceConfig,omitempty"`
+		OneDrives       []interface{}    `json:"oneDrives"`
 	}{
 		odc.IsDebugMode,
 		odc.PageTemplate,
+		odc.PublicBaseURL,
+		odc.S3Config,
+		odc.AccessConfig,
+		odc.NamespaceConfig,
 		newODs,
 	}
 
@@ -17,17 +17,40 @@ func (odc *OneDriveCollection) CronStartAll() error {
 		}
 		odc.SaveConfigFile()
 	})
+	// Every ten minutes, purge orphaned and expired upload sessions
+	log.Printf("@every 10m od.CleanUploaderCollection\n")
+	c.AddFunc("@every 10m", func() {
+		for _, oneDrive := range odc.OneDrives {
+			oneDrive.CleanUploaderCollection()
+		}
+	})
+	// Every ten minutes, refresh the quotas reported by the status
+	log.Printf("@every 10m od.RefreshMicrosoftGraphDriveQuota\n")
+	c.AddFunc("@every 10m", func() {
+		for _, oneDrive := range odc.OneDrives {
+			if oneDrive.OneDriveDescription.DriveDescription == nil {
+				continue
+			}
+			if err := oneDrive.RefreshMicrosoftGraphDriveQuota(); err != nil {
+				log.Println("od.RefreshMicrosoftGraphDriveQuota", err)
+			}
+		}
+	})
 	for i := range odc.OneDrives {
 		oneDrive := odc.OneDrives[i]
 		refreshInterval := oneDrive.OneDriveDescription.GetRefreshInterval()
-		log.Printf("@every %ds od.CronCacheMicrosoftGraphDrive\n", refreshInterval)
+		log.Printf("@every %ds od.CronCacheMicrosoftGraphDrive od.SyncActivityLog\n", refreshInterval)
 		c.AddFunc(fmt.Sprintf("@every %ds", refreshInterval), func() {
 			// log.Printf("start @every %ds od.CronCacheMicrosoftGraphDrive\n", refreshInterval)
 			// defer log.Printf("end @every %ds od.CronCacheMicrosoftGraphDrive\n", refreshInterval)
 			if err := oneDrive.CronCacheMicrosoftGraphDrive(); err != nil {
 				// log.Printf("@every %ds od.CronCacheMicrosoftGraphDrive %v\n", refreshInterval, err)
 			} else {
-				oneDrive.DriveCacheCollection.Save(oneDrive.OneDriveDescription.DriveDescription)
+				oneDrive.SaveDriveCacheCollection()
+			}
+			// The tombstones of the delta stream change the cache, so both run in turn
+			if err := oneDrive.SyncActivityLog(); err != nil {
+				log.Println("od.SyncActivityLog", err)
 			}
 		})
 	}
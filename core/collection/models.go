@@ -1,10 +1,59 @@
 package collection
 
-import "github.com/AirWSW/onedrive/core"
+import (
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/shortlink"
+)
 
 // OneDriveCollection collects all OneDrives
 type OneDriveCollection struct {
-	IsDebugMode  *bool            `json:"isDebugMode"`
-	PageTemplate *string          `json:"pageTemplate"`
-	OneDrives    []*core.OneDrive `json:"oneDrives"`
+	IsDebugMode     *bool            `json:"isDebugMode"`
+	PageTemplate    *string          `json:"pageTemplate"`
+	PublicBaseURL   string           `json:"publicBaseUrl,omitempty"` // like https://drive.example.com, the URLs of feeds start with
+	S3Config        *S3Config        `json:"s3Config,omitempty"`
+	AccessConfig    *AccessConfig    `json:"accessConfig,omitempty"`
+	NamespaceConfig *NamespaceConfig `json:"namespaceConfig,omitempty"`
+	OneDrives       []*core.OneDrive `json:"oneDrives"`
+	ShortLinks      *shortlink.Store `json:"-"`
+	namespace       *core.OneDrive
+}
+
+// NamespaceConfig configures the virtual drive aggregating all drives, each
+// drive is mounted at /<oneDriveName> unless volume mounts are configured.
+type NamespaceConfig struct {
+	OneDriveName      string                         `json:"oneDriveName"`
+	IsDefault         bool                           `json:"isDefault"`
+	DriveVolumeMounts []description.DriveVolumeMount `json:"driveVolumeMounts,omitempty"`
+}
+
+// S3Config configures the S3-compatible gateway.
+type S3Config struct {
+	AllowPut   bool          `json:"allowPut"`
+	AccessKeys []S3AccessKey `json:"accessKeys"`
+}
+
+// S3AccessKey configures an access key of the S3-compatible gateway, which
+// holds the roles of the access user named by user, or the anonymous roles
+// without user.
+type S3AccessKey struct {
+	AccessKeyID     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	User            string `json:"user,omitempty"`
+}
+
+// AccessConfig configures the access control, roles map drive names or * to
+// none, read, write or admin.
+type AccessConfig struct {
+	Secret         string            `json:"secret,omitempty"`
+	AnonymousRoles map[string]string `json:"anonymousRoles,omitempty"`
+	Users          []AccessUser      `json:"users"`
+}
+
+// AccessUser configures a named user signing in by password or API token.
+type AccessUser struct {
+	Name     string            `json:"name"`
+	Password string            `json:"password,omitempty"`
+	Token    string            `json:"token,omitempty"`
+	Roles    map[string]string `json:"roles"`
 }
@@ -0,0 +1,19 @@
+package collection
+
+import (
+	"path/filepath"
+
+	"github.com/AirWSW/onedrive/core/shortlink"
+)
+
+// UseShortLinkFilename returns the file of the short links, which is kept
+// next to the config file
+func UseShortLinkFilename() string {
+	return filepath.Join(filepath.Dir(GetConfigFilenameFromArgs()), "links.json")
+}
+
+// InitShortLinks loads the short links
+func (odc *OneDriveCollection) InitShortLinks() error {
+	odc.ShortLinks = shortlink.NewStore(UseShortLinkFilename())
+	return odc.ShortLinks.Load()
+}
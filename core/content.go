@@ -0,0 +1,142 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/AirWSW/onedrive/core/integrity"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// GetMicrosoftGraphDriveItemContent opens the content of the file at path,
+// the content is verified against the cached hashes when enabled
+func (od *OneDrive) GetMicrosoftGraphDriveItemContent(path string) (io.ReadCloser, *DriveItemCachePayload, error) {
+	driveItemCachePayload, err := od.UseMicrosoftGraphDriveItemContentURL(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := od.OpenMicrosoftGraphDownloadURL(*driveItemCachePayload.DownloadURL, driveItemCachePayload.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, driveItemCachePayload, nil
+}
+
+// OpenMicrosoftGraphDownloadURL opens a download URL, the content is
+// verified against the hashes of file when enabled
+func (od *OneDrive) OpenMicrosoftGraphDownloadURL(downloadURL string, file *graphapi.MicrosoftGraphFile) (io.ReadCloser, error) {
+	open := func() (io.ReadCloser, error) {
+		resp, err := http.Get(downloadURL)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= http.StatusBadRequest {
+			resp.Body.Close()
+			return nil, errors.New(http.StatusText(resp.StatusCode))
+		}
+		return resp.Body, nil
+	}
+	content, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return od.verifyMicrosoftGraphDownloadContent(content, file, open), nil
+}
+
+// verifyMicrosoftGraphDownloadContent verifies content against the hashes of
+// file when enabled, with retries the content is downloaded again by reopen
+// on mismatch
+func (od *OneDrive) verifyMicrosoftGraphDownloadContent(content io.ReadCloser, file *graphapi.MicrosoftGraphFile, reopen func() (io.ReadCloser, error)) io.ReadCloser {
+	hashVerification := od.OneDriveDescription.HashVerification
+	if hashVerification == nil || !hashVerification.Download || file == nil {
+		return content
+	}
+	if hashVerification.Retry <= 0 {
+		return &verifyingReadCloser{
+			Reader: integrity.NewVerifyingReader(content, file.Hashes),
+			Closer: content,
+		}
+	}
+	return &retryingReadCloser{
+		content: content,
+		hashes:  file.Hashes,
+		retry:   hashVerification.Retry,
+		reopen:  reopen,
+	}
+}
+
+type verifyingReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// retryingReadCloser spools the content to a temporary file on the first read
+// and downloads it again on hash mismatch up to retry times, nothing is read
+// before the content is verified
+type retryingReadCloser struct {
+	content  io.ReadCloser
+	hashes   *graphapi.MicrosoftGraphHashes
+	retry    int
+	reopen   func() (io.ReadCloser, error)
+	tempFile *os.File
+	err      error
+}
+
+func (rc *retryingReadCloser) Read(p []byte) (int, error) {
+	if rc.tempFile == nil && rc.err == nil {
+		rc.tempFile, rc.err = rc.spool()
+	}
+	if rc.err != nil {
+		return 0, rc.err
+	}
+	return rc.tempFile.Read(p)
+}
+
+func (rc *retryingReadCloser) spool() (*os.File, error) {
+	tempFile, err := ioutil.TempFile("", "onedrive-download-")
+	if err != nil {
+		rc.content.Close()
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		_, err = io.Copy(tempFile, integrity.NewVerifyingReader(rc.content, rc.hashes))
+		rc.content.Close()
+		if err == nil {
+			if _, err = tempFile.Seek(0, io.SeekStart); err == nil {
+				return tempFile, nil
+			}
+		}
+		if !integrity.IsHashMismatch(err) || attempt >= rc.retry {
+			break
+		}
+		log.Println("rc.spool", err, "retrying")
+		if _, err = tempFile.Seek(0, io.SeekStart); err != nil {
+			break
+		}
+		if err = tempFile.Truncate(0); err != nil {
+			break
+		}
+		if rc.content, err = rc.reopen(); err != nil {
+			break
+		}
+	}
+	tempFile.Close()
+	os.Remove(tempFile.Name())
+	return nil, err
+}
+
+// Close closes the content unless it was read, which closed it already
+func (rc *retryingReadCloser) Close() error {
+	if rc.tempFile != nil {
+		rc.tempFile.Close()
+		return os.Remove(rc.tempFile.Name())
+	}
+	if rc.err == nil {
+		return rc.content.Close()
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/integrity"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestOpenMicrosoftGraphDownloadURLRetry(t *testing.T) {
+	var requests int32
+	download := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first download is corrupted
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Write([]byte("Hello, World?"))
+			return
+		}
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer download.Close()
+	quickXorHash := "SCgDG9jwBhaA4ApvnQMbyBACAAA="
+	file := &graphapi.MicrosoftGraphFile{Hashes: &graphapi.MicrosoftGraphHashes{QuickXorHash: &quickXorHash}}
+	od := newTestRootOneDrive("media")
+	od.OneDriveDescription.HashVerification = &description.DriveHashVerification{Download: true}
+
+	content, err := od.OpenMicrosoftGraphDownloadURL(download.URL, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(content); !integrity.IsHashMismatch(err) || string(got) != "Hello, World" {
+		t.Errorf("got %q %v", got, err)
+	}
+	content.Close()
+
+	od.OneDriveDescription.HashVerification.Retry = 1
+	atomic.StoreInt32(&requests, 0)
+	content, err = od.OpenMicrosoftGraphDownloadURL(download.URL, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(content); err != nil || string(got) != "Hello, World!" || atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("got %q %v after %d requests", got, err, atomic.LoadInt32(&requests))
+	}
+	if err := content.Close(); err != nil {
+		t.Error(err)
+	}
+}
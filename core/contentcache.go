@@ -0,0 +1,201 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/contentcache"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+// InitContentCache opens the on-disk content cache of the drive when enabled
+func (od *OneDrive) InitContentCache() error {
+	odd := od.OneDriveDescription
+	if odd.CacheConfig == nil || !odd.CacheConfig.CacheEabled || od.ContentCache != nil {
+		return nil
+	}
+	path := filepath.Join(odd.GetCachePath(), odd.DriveDescription.ID)
+	contentCache, err := contentcache.NewContentCache(path, odd.GetCacheMaxSize(), odd.GetCacheBlockSize())
+	if err != nil {
+		return err
+	}
+	contentCache.OnEvict = od.useCacheEviction("content")
+	od.ContentCache = contentCache
+	return nil
+}
+
+// UseContentCache reports whether the content of path is served from the
+// on-disk content cache, an empty cache list caches all paths
+func (od *OneDrive) UseContentCache(path string) bool {
+	cacheConfig := od.OneDriveDescription.CacheConfig
+	if od.ContentCache == nil || cacheConfig == nil || !cacheConfig.CacheEabled {
+		return false
+	}
+	if cacheConfig.CacheList == nil || len(*cacheConfig.CacheList) == 0 {
+		return true
+	}
+	path = utils.RegularPath(path)
+	for _, cachePath := range *cacheConfig.CacheList {
+		cachePath = strings.TrimSuffix(utils.RegularPath(cachePath), "/")
+		if path == cachePath || strings.HasPrefix(path, cachePath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CachedContent reads the content of a file block by block through the
+// on-disk content cache, missing blocks are requested with Range headers
+type CachedContent struct {
+	ID             string
+	CTag           string
+	Name           string
+	MimeType       string
+	Size           int64
+	LastModifiedAt time.Time
+
+	od           *OneDrive
+	path         string
+	offset       int64
+	countedBlock int64 // the block last counted in the metrics plus one
+}
+
+// OpenCachedMicrosoftGraphDriveItemContent opens the file at path, blocks of
+// previous cTags are invalidated
+func (od *OneDrive) OpenCachedMicrosoftGraphDriveItemContent(path string) (*CachedContent, error) {
+	if od.ContentCache == nil {
+		return nil, errors.New("od.OpenCachedMicrosoftGraphDriveItemContent ContentCacheDisabled")
+	}
+	microsoftGraphDriveItemCache, err := od.DriveCacheCollection.HitMicrosoftGraphDriveContentURLCache(&od.OneDriveDescription, path)
+	if err != nil {
+		return nil, err
+	}
+	if microsoftGraphDriveItemCache.File == nil {
+		return nil, errors.New("od.OpenCachedMicrosoftGraphDriveItemContent NotFile " + path)
+	}
+	od.ContentCache.Invalidate(microsoftGraphDriveItemCache.ID, microsoftGraphDriveItemCache.CTag)
+	return &CachedContent{
+		ID:             microsoftGraphDriveItemCache.ID,
+		CTag:           microsoftGraphDriveItemCache.CTag,
+		Name:           microsoftGraphDriveItemCache.Name,
+		MimeType:       microsoftGraphDriveItemCache.File.MimeType,
+		Size:           microsoftGraphDriveItemCache.Size,
+		LastModifiedAt: time.Unix(microsoftGraphDriveItemCache.LastModifiedAt, 0).UTC(),
+		od:             od,
+		path:           path,
+	}, nil
+}
+
+// ETag returns the cTag as a quoted entity tag
+func (cc *CachedContent) ETag() string {
+	if strings.HasPrefix(cc.CTag, "\"") {
+		return cc.CTag
+	}
+	return strconv.Quote(cc.CTag)
+}
+
+func (cc *CachedContent) Read(p []byte) (int, error) {
+	if cc.offset >= cc.Size {
+		return 0, io.EOF
+	}
+	contentCache := cc.od.ContentCache
+	block := cc.offset / contentCache.BlockSize
+	fetched := false
+	data, err := contentCache.GetOrFetch(cc.ID, cc.CTag, block, func() ([]byte, error) {
+		fetched = true
+		return cc.fetch(block)
+	})
+	// A block read in several calls counts once
+	if fetched || cc.countedBlock != block+1 {
+		cc.od.countCacheLookup("content", !fetched)
+		cc.countedBlock = block + 1
+	}
+	if err != nil {
+		return 0, err
+	}
+	start := cc.offset - block*contentCache.BlockSize
+	if start >= int64(len(data)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, data[start:])
+	cc.offset += int64(n)
+	return n, nil
+}
+
+func (cc *CachedContent) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += cc.offset
+	case io.SeekEnd:
+		offset += cc.Size
+	default:
+		return 0, errors.New("CachedContent.Seek InvalidWhence")
+	}
+	if offset < 0 {
+		return 0, errors.New("CachedContent.Seek NegativePosition")
+	}
+	cc.offset = offset
+	return offset, nil
+}
+
+func (cc *CachedContent) fetch(block int64) ([]byte, error) {
+	blockSize := cc.od.ContentCache.BlockSize
+	start := block * blockSize
+	length := blockSize
+	if start+length > cc.Size {
+		length = cc.Size - start
+	}
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+length-1))
+	resp, _, err := cc.od.GetMicrosoftGraphDriveItemContentResponse(cc.path, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK: // Range ignored
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, start); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("CachedContent.fetch UnexpectedStatus " + resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, length))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != length {
+		return nil, errors.New("CachedContent.fetch ShortBlock " + cc.path)
+	}
+	return data, nil
+}
+
+// invalidateContentCache drops the cached content of files changed or
+// removed between the old and the new folder cache
+func (od *OneDrive) invalidateContentCache(oldMicrosoftGraphDriveItemCache, newMicrosoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache) {
+	if od.ContentCache == nil {
+		return
+	}
+	cTags := map[string]string{}
+	for _, children := range newMicrosoftGraphDriveItemCache.Children {
+		cTags[children.ID] = children.CTag
+	}
+	for _, children := range oldMicrosoftGraphDriveItemCache.Children {
+		if children.File == nil {
+			continue
+		}
+		if cTag, ok := cTags[children.ID]; !ok || cTag != children.CTag {
+			od.ContentCache.Invalidate(children.ID, cTag)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package contentcache
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentCache stores file contents on local disk in blocks of BlockSize
+// keyed by item ID, cTag and block index, the least recently used blocks
+// are evicted once the total size exceeds MaxSize
+type ContentCache struct {
+	Path      string
+	MaxSize   int64
+	BlockSize int64
+	OnEvict   func() // called for each block evicted, with the cache locked
+
+	mutex    sync.Mutex
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+	inflight map[string]*inflightBlock
+}
+
+type contentCacheEntry struct {
+	key  string
+	size int64
+}
+
+type inflightBlock struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// NewContentCache creates the cache directory and indexes the existing
+// blocks ordered by modification time
+func NewContentCache(path string, maxSize, blockSize int64) (*ContentCache, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	cc := &ContentCache{
+		Path:      path,
+		MaxSize:   maxSize,
+		BlockSize: blockSize,
+		lru:       list.New(),
+		entries:   map[string]*list.Element{},
+		inflight:  map[string]*inflightBlock{},
+	}
+	fileInfos := []struct {
+		key string
+		os.FileInfo
+	}{}
+	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(info.Name(), ".tmp") {
+			return err
+		}
+		key, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
+		}
+		fileInfos = append(fileInfos, struct {
+			key string
+			os.FileInfo
+		}{filepath.ToSlash(key), info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(fileInfos, func(i, j int) bool {
+		return fileInfos[i].ModTime().After(fileInfos[j].ModTime())
+	})
+	for _, fileInfo := range fileInfos {
+		cc.entries[fileInfo.key] = cc.lru.PushBack(&contentCacheEntry{fileInfo.key, fileInfo.Size()})
+		cc.size += fileInfo.Size()
+	}
+	log.Println("Loaded content cache from", path, len(cc.entries), "blocks", cc.size, "bytes")
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	cc.evict()
+	return cc, nil
+}
+
+func useContentCacheKey(id, cTag string, block int64) string {
+	sum := sha1.Sum([]byte(cTag))
+	return id + "/" + hex.EncodeToString(sum[:8]) + "/" + strconv.FormatInt(block, 10)
+}
+
+// Get reads a cached block from disk
+func (cc *ContentCache) Get(id, cTag string, block int64) ([]byte, bool) {
+	key := useContentCacheKey(id, cTag, block)
+	cc.mutex.Lock()
+	element, ok := cc.entries[key]
+	if ok {
+		cc.lru.MoveToFront(element)
+	}
+	cc.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(filepath.Join(cc.Path, filepath.FromSlash(key)))
+	if err != nil {
+		log.Println("cc.Get", err)
+		cc.remove(key)
+		return nil, false
+	}
+	return data, true
+}
+
+// Put writes a block to disk and evicts the least recently used blocks
+func (cc *ContentCache) Put(id, cTag string, block int64, data []byte) error {
+	key := useContentCacheKey(id, cTag, block)
+	filePath := filepath.Join(cc.Path, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filePath+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(filePath+".tmp", filePath); err != nil {
+		return err
+	}
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	if element, ok := cc.entries[key]; ok {
+		cc.size -= element.Value.(*contentCacheEntry).size
+		cc.lru.Remove(element)
+	}
+	cc.entries[key] = cc.lru.PushFront(&contentCacheEntry{key, int64(len(data))})
+	cc.size += int64(len(data))
+	cc.evict()
+	return nil
+}
+
+// GetOrFetch returns the cached block or stores the block returned by fetch,
+// concurrent requests of the same block share one fetch
+func (cc *ContentCache) GetOrFetch(id, cTag string, block int64, fetch func() ([]byte, error)) ([]byte, error) {
+	if data, ok := cc.Get(id, cTag, block); ok {
+		return data, nil
+	}
+	key := useContentCacheKey(id, cTag, block)
+	cc.mutex.Lock()
+	if inflight, ok := cc.inflight[key]; ok {
+		cc.mutex.Unlock()
+		<-inflight.done
+		return inflight.data, inflight.err
+	}
+	inflight := &inflightBlock{done: make(chan struct{})}
+	cc.inflight[key] = inflight
+	cc.mutex.Unlock()
+
+	inflight.data, inflight.err = fetch()
+	if inflight.err == nil {
+		if err := cc.Put(id, cTag, block, inflight.data); err != nil {
+			log.Println("cc.GetOrFetch", err)
+		}
+	}
+	cc.mutex.Lock()
+	delete(cc.inflight, key)
+	cc.mutex.Unlock()
+	close(inflight.done)
+	return inflight.data, inflight.err
+}
+
+// Invalidate removes all blocks of the item id which do NOT belong to cTag,
+// an empty cTag removes all blocks of the item
+func (cc *ContentCache) Invalidate(id, cTag string) {
+	keep := ""
+	if cTag != "" {
+		keep = filepath.Dir(useContentCacheKey(id, cTag, 0))
+	}
+	cc.mutex.Lock()
+	keys := []string{}
+	for key := range cc.entries {
+		if strings.HasPrefix(key, id+"/") && filepath.Dir(key) != keep {
+			keys = append(keys, key)
+		}
+	}
+	cc.mutex.Unlock()
+	for _, key := range keys {
+		cc.remove(key)
+	}
+}
+
+func (cc *ContentCache) remove(key string) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	if element, ok := cc.entries[key]; ok {
+		cc.removeElement(element)
+	}
+}
+
+// evict must be called with cc.mutex held
+func (cc *ContentCache) evict() {
+	for cc.size > cc.MaxSize && cc.lru.Len() > 0 {
+		cc.removeElement(cc.lru.Back())
+		if cc.OnEvict != nil {
+			cc.OnEvict()
+		}
+	}
+}
+
+// removeElement must be called with cc.mutex held
+func (cc *ContentCache) removeElement(element *list.Element) {
+	entry := element.Value.(*contentCacheEntry)
+	cc.lru.Remove(element)
+	delete(cc.entries, entry.key)
+	cc.size -= entry.size
+	if err := os.Remove(filepath.Join(cc.Path, filepath.FromSlash(entry.key))); err != nil && !os.IsNotExist(err) {
+		log.Println("cc.removeElement", err)
+	}
+}
+
+// Size returns the total size of the cached blocks
+func (cc *ContentCache) Size() int64 {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	return cc.size
+}
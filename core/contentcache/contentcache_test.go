@@ -0,0 +1,54 @@
+package contentcache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestContentCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contentcache")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	cc, err := NewContentCache(dir, 10, 4)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	cc.Put("A", "c1", 0, []byte("0123"))
+	cc.Put("A", "c1", 1, []byte("4567"))
+	if _, ok := cc.Get("A", "c1", 0); !ok {
+		t.Fatalf("block 0 should be cached")
+	}
+	// Block 1 is the least recently used one now
+	cc.Put("B", "c1", 0, []byte("abcd"))
+	if _, ok := cc.Get("A", "c1", 1); ok {
+		t.Errorf("block 1 should be evicted")
+	}
+	if size := cc.Size(); size != 8 {
+		t.Errorf("got size %d, want 8", size)
+	}
+	fetched := 0
+	data, err := cc.GetOrFetch("A", "c2", 0, func() ([]byte, error) {
+		fetched++
+		return []byte("new!"), nil
+	})
+	if err != nil || string(data) != "new!" || fetched != 1 {
+		t.Fatalf("got %q %v %d", data, err, fetched)
+	}
+	cc.Invalidate("A", "c2")
+	if _, ok := cc.Get("A", "c1", 0); ok {
+		t.Errorf("outdated cTag should be invalidated")
+	}
+	if _, ok := cc.Get("A", "c2", 0); !ok {
+		t.Errorf("current cTag should be kept")
+	}
+	reloaded, err := NewContentCache(dir, 10, 4)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if _, ok := reloaded.Get("B", "c1", 0); !ok {
+		t.Errorf("blocks should be indexed on reload")
+	}
+}
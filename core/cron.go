@@ -3,8 +3,10 @@ package core
 import (
 	"errors"
 	"log"
+	"time"
 
 	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/metrics"
 )
 
 func (od *OneDrive) CronCacheMicrosoftGraphDrive() error {
@@ -14,7 +16,13 @@ func (od *OneDrive) CronCacheMicrosoftGraphDrive() error {
 		if err := cache.IsCacheNeedUpdate(&od.OneDriveDescription, cacheDescription); err != nil {
 			log.Println("od.CronCacheMicrosoftGraphDrive", err)
 			od.DriveCacheCollection.MicrosoftGraphDriveItemCache[i].CacheDescription.Status = "Caching"
+			start := time.Now()
 			newMicrosoftGraphDriveItemCache, err := od.MicrosoftGraphAPI.UpdateMicrosoftGraphDriveItemCache(&od.OneDriveDescription, cacheDescription)
+			result := "success"
+			if err != nil {
+				result = "failure"
+			}
+			metrics.CacheRefreshDuration.Observe(time.Since(start).Seconds(), od.useMetricsDrive(), result)
 			if err != nil {
 				log.Println("od.CronCacheMicrosoftGraphDrive", err)
 				newMicrosoftGraphDriveItemCache = &microsoftGraphDriveItemCache
@@ -22,7 +30,9 @@ func (od *OneDrive) CronCacheMicrosoftGraphDrive() error {
 				od.DriveCacheCollection.MicrosoftGraphDriveItemCache[i] = *newMicrosoftGraphDriveItemCache
 			} else {
 				newMicrosoftGraphDriveItemCache.CacheDescription.Status = "Cached"
+				od.invalidateContentCache(&microsoftGraphDriveItemCache, newMicrosoftGraphDriveItemCache)
 				od.DriveCacheCollection.MicrosoftGraphDriveItemCache[i] = *newMicrosoftGraphDriveItemCache
+				od.updateDriveIndex(newMicrosoftGraphDriveItemCache)
 				// od.DriveCacheCollection.Save(od.OneDriveDescription.DriveDescription)
 				ok = true
 			}
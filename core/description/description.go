@@ -86,6 +86,10 @@ func (odd *OneDriveDescription) UseMicrosoftGraphAPIMeDriveItem(str string) stri
 	return "/me" + str
 }
 
+func (odd *OneDriveDescription) UseMicrosoftGraphAPIMeDriveItemIDPath(id string) string {
+	return "/me/drive/items/" + id
+}
+
 func (odd *OneDriveDescription) UseMicrosoftGraphAPIMeDriveChildren(str string) string {
 	if str == "/drive/root:" {
 		return "/me/drive/root/children"
@@ -97,6 +101,31 @@ func (odd *OneDriveDescription) UseMicrosoftGraphAPIMeDriveChildrenPath(str stri
 	return odd.RelativePathToFullDriveRootPath(str) + ":/children"
 }
 
+// UseMicrosoftGraphAPIMeDriveSearchPath searches the folder at drive root path
+// str for query
+func (odd *OneDriveDescription) UseMicrosoftGraphAPIMeDriveSearchPath(str, query string) string {
+	q := url.PathEscape(strings.Replace(query, "'", "''", -1))
+	if str == "/drive/root:" {
+		return "/me/drive/root/search(q='" + q + "')"
+	}
+	return "/me" + str + ":/search(q='" + q + "')"
+}
+
+// UseMicrosoftGraphAPIMeDriveThumbnailPath requests the thumbnail of size of
+// the item at drive root path str, size is small, medium, large or cWxH
+func (odd *OneDriveDescription) UseMicrosoftGraphAPIMeDriveThumbnailPath(str, size string) string {
+	return odd.UseMicrosoftGraphAPIMeDriveActionPath(str, "thumbnails/0/"+size)
+}
+
+// UseMicrosoftGraphAPIMeDriveActionPath addresses the relationship or action
+// of the item at drive root path str, like permissions or createLink
+func (odd *OneDriveDescription) UseMicrosoftGraphAPIMeDriveActionPath(str, action string) string {
+	if str == "/drive/root:" {
+		return "/me/drive/root/" + action
+	}
+	return "/me" + str + ":/" + action
+}
+
 func (odd *OneDriveDescription) UseMicrosoftGraphAPIMeDriveExpandChildrenPath(str string) string {
 	return odd.RelativePathToFullDriveRootPath(str) + "?expand=children($select=name,size,file,folder,parentReference,createdDateTime,lastModifiedDateTime)"
 }
@@ -114,3 +143,61 @@ func (odd *OneDriveDescription) GetRefreshInterval() int64 {
 	}
 	return refreshInterval
 }
+
+func (odd *OneDriveDescription) GetArchiveMaxSize() int64 {
+	maxSize := int64(4294967296)
+	if odd.ArchiveConfig != nil && odd.ArchiveConfig.MaxSize > 0 {
+		maxSize = odd.ArchiveConfig.MaxSize
+	}
+	return maxSize
+}
+
+func (odd *OneDriveDescription) GetArchiveMaxFileCount() int {
+	maxFileCount := 1000
+	if odd.ArchiveConfig != nil && odd.ArchiveConfig.MaxFileCount > 0 {
+		maxFileCount = odd.ArchiveConfig.MaxFileCount
+	}
+	return maxFileCount
+}
+
+func (odd *OneDriveDescription) GetCachePath() string {
+	cachePath := "content"
+	if odd.CacheConfig != nil && odd.CacheConfig.CachePath != "" {
+		cachePath = odd.CacheConfig.CachePath
+	}
+	return cachePath
+}
+
+func (odd *OneDriveDescription) GetCacheMaxSize() int64 {
+	maxSize := int64(1073741824)
+	if odd.CacheConfig != nil && odd.CacheConfig.CacheMaxSize > 0 {
+		maxSize = odd.CacheConfig.CacheMaxSize
+	}
+	return maxSize
+}
+
+func (odd *OneDriveDescription) GetCacheBlockSize() int64 {
+	blockSize := int64(4194304)
+	if odd.CacheConfig != nil && odd.CacheConfig.CacheBlockSize > 0 {
+		blockSize = odd.CacheConfig.CacheBlockSize
+	}
+	return blockSize
+}
+
+func (dvm *DriveVolumeMount) GetType() string {
+	mountType := DriveVolumeMountFolder
+	if dvm.Type != nil && *dvm.Type != "" {
+		mountType = *dvm.Type
+	}
+	return mountType
+}
+
+// IsWritable reports whether the volume mount accepts writes, the empty rule
+// of paths outside any volume mount does
+func (dvm *DriveVolumeMount) IsWritable() bool {
+	switch dvm.GetType() {
+	case DriveVolumeMountFileOnly, DriveVolumeMountReadOnly, DriveVolumeMountRedirect:
+		return false
+	}
+	return true
+}
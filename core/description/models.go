@@ -7,17 +7,34 @@ type OneDriveDescription struct {
 	OneDriveName      *string                       `json:"oneDriveName"`
 	RootPath          string                        `json:"rootPath,omitempty"`
 	RefreshInterval   int64                         `json:"refreshInterval,omitempty"`
+	ContentMode       string                        `json:"contentMode,omitempty"` // redirect, proxy
+	HiddenPaths       []string                      `json:"hiddenPaths,omitempty"`
 	DriveVolumeMounts []DriveVolumeMount            `json:"driveVolumeMounts,omitempty"`
 	CacheConfig       *DriveCacheConfig             `json:"driveCacheConfig,omitempty"`
+	HashVerification  *DriveHashVerification        `json:"hashVerification,omitempty"`
+	ArchiveConfig     *DriveArchiveConfig           `json:"archiveConfig,omitempty"`
+	RichMetadata      bool                          `json:"richMetadata,omitempty"` // Caches the image, photo, video, audio and location facets
 	DriveDescription  *graphapi.MicrosoftGraphDrive `json:"driveDescription,omitempty"`
 }
 
+// DriveVolumeMount types, a volume mount without type is a folder
+const (
+	DriveVolumeMountFolder   = "folder"    // Alias of the source subtree
+	DriveVolumeMountFileOnly = "file.only" // Files are accessible but folders are NOT listed
+	DriveVolumeMountReadOnly = "readonly"  // Alias of the source subtree refusing writes
+	DriveVolumeMountHidden   = "hidden"    // Alias of the source subtree NOT listed in its parent folder
+	DriveVolumeMountPassword = "password"  // Alias of the source subtree requiring the password
+	DriveVolumeMountRedirect = "redirect"  // Redirects to the source URL
+)
+
 // DriveVolumeMount configures the volume mounts.
 type DriveVolumeMount struct {
-	Type     *string `json:"type"`
-	Source   *string `json:"source"`
-	Target   *string `json:"target"`
-	Password *string `json:"password"`
+	Type        *string `json:"type"`
+	Drive       *string `json:"drive,omitempty"` // OneDriveName of the source drive
+	Source      *string `json:"source"`
+	Target      *string `json:"target"`
+	Password    *string `json:"password"`
+	ContentMode *string `json:"contentMode,omitempty"` // redirect, proxy
 }
 
 // DriveCacheConfig configures the drive files cache.
@@ -26,4 +43,20 @@ type DriveCacheConfig struct {
 	CacheList             *[]string `json:"cacheList"`
 	FileRefreshInterval   int       `json:"fileRefreshInterval"`
 	FolderRefreshInterval int       `json:"folderRefreshInterval"`
+	CachePath             string    `json:"cachePath,omitempty"`
+	CacheMaxSize          int64     `json:"cacheMaxSize,omitempty"`
+	CacheBlockSize        int64     `json:"cacheBlockSize,omitempty"`
+}
+
+// DriveHashVerification configures the content hashes verification.
+type DriveHashVerification struct {
+	Upload   bool `json:"upload"`
+	Download bool `json:"download"`
+	Retry    int  `json:"retry"` // attempts again on mismatch, downloads are spooled to a temporary file then
+}
+
+// DriveArchiveConfig configures the folder archive limits.
+type DriveArchiveConfig struct {
+	MaxSize      int64 `json:"maxSize"`
+	MaxFileCount int   `json:"maxFileCount"`
 }
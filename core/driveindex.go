@@ -0,0 +1,95 @@
+package core
+
+import (
+	"log"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/index"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// InitDriveIndex loads the index of the drive persisted next to the cache
+// file, an index missing is built from the drive cache
+func (od *OneDrive) InitDriveIndex() error {
+	if od.DriveIndex != nil || od.OneDriveDescription.DriveDescription == nil {
+		return nil
+	}
+	driveIndex := index.NewIndex()
+	if err := driveIndex.Load(od.useDriveIndexFile()); err != nil {
+		log.Println("od.InitDriveIndex", err)
+	}
+	od.DriveIndex = driveIndex
+	if driveIndex.Len() == 0 {
+		for i := range od.DriveCacheCollection.MicrosoftGraphDriveItemCache {
+			od.updateDriveIndex(&od.DriveCacheCollection.MicrosoftGraphDriveItemCache[i])
+		}
+	}
+	return nil
+}
+
+func (od *OneDrive) useDriveIndexFile() string {
+	return od.OneDriveDescription.DriveDescription.ID + ".index.json"
+}
+
+// updateDriveIndex replaces the indexed children of the cached folder
+func (od *OneDrive) updateDriveIndex(microsoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache) {
+	if od.DriveIndex == nil || microsoftGraphDriveItemCache.CacheDescription == nil || microsoftGraphDriveItemCache.CacheDescription.Status == "Wait" {
+		return
+	}
+	odd := od.OneDriveDescription
+	path := odd.DriveRootPathToRelativePath(microsoftGraphDriveItemCache.CacheDescription.Path)
+	items := []index.Item{}
+	for _, child := range microsoftGraphDriveItemCache.Children {
+		items = append(items, newDriveIndexItem(joinSubPath(path, child.Name), &child))
+	}
+	od.DriveIndex.UpdateFolder(path, items)
+}
+
+// putDriveIndexItem indexes the changed item at path
+func (od *OneDrive) putDriveIndexItem(path string, microsoftGraphDriveItem *graphapi.MicrosoftGraphDriveItem) {
+	if od.DriveIndex == nil {
+		return
+	}
+	od.DriveIndex.Put(index.Item{
+		Path:           utils.RegularPath(path),
+		Name:           microsoftGraphDriveItem.Name,
+		IsFolder:       microsoftGraphDriveItem.Folder != nil,
+		Size:           microsoftGraphDriveItem.Size,
+		CreatedAt:      microsoftGraphDriveItem.CreatedDateTime.Unix(),
+		LastModifiedAt: microsoftGraphDriveItem.LastModifiedDateTime.Unix(),
+	})
+}
+
+// removeDriveIndexItem removes the item at path and all items below
+func (od *OneDrive) removeDriveIndexItem(path string) {
+	if od.DriveIndex != nil {
+		od.DriveIndex.Remove(utils.RegularPath(path))
+	}
+}
+
+func newDriveIndexItem(path string, microsoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache) index.Item {
+	return index.Item{
+		Path:           path,
+		Name:           microsoftGraphDriveItemCache.Name,
+		IsFolder:       microsoftGraphDriveItemCache.Folder != nil,
+		Size:           microsoftGraphDriveItemCache.Size,
+		CreatedAt:      microsoftGraphDriveItemCache.CreatedAt,
+		LastModifiedAt: microsoftGraphDriveItemCache.LastModifiedAt,
+	}
+}
+
+// SaveDriveCacheCollection persists the drive cache and the drive index
+func (od *OneDrive) SaveDriveCacheCollection() {
+	if od.OneDriveDescription.DriveDescription == nil {
+		return
+	}
+	if err := od.DriveCacheCollection.Save(od.OneDriveDescription.DriveDescription); err != nil {
+		log.Println("od.SaveDriveCacheCollection", err)
+	}
+	if od.DriveIndex != nil {
+		if err := od.DriveIndex.Save(od.useDriveIndexFile()); err != nil {
+			log.Println("od.SaveDriveCacheCollection", err)
+		}
+	}
+}
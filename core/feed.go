@@ -0,0 +1,180 @@
+package core
+
+import (
+	"errors"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/feed"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+var ErrFeedFormatInvalid = errors.New("FeedFormatInvalid")
+
+// Feed formats, a playlist of audio and video files, a podcast of audio files
+// and a catalog of ebooks and folders
+const (
+	FeedM3U8 = "m3u8"
+	FeedRSS  = "rss"
+	FeedOPDS = "opds"
+)
+
+// FeedMimeTypes are the types of the media and ebook files by extension,
+// other extensions are looked up by mime.TypeByExtension
+var FeedMimeTypes = map[string]string{
+	".aac":  "audio/aac",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".m4b":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/opus",
+	".wav":  "audio/wav",
+	".avi":  "video/x-msvideo",
+	".m4v":  "video/mp4",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".mp4":  "video/mp4",
+	".ts":   "video/mp2t",
+	".webm": "video/webm",
+	".azw3": "application/vnd.amazon.ebook",
+	".cbr":  "application/vnd.comicbook-rar",
+	".cbz":  "application/vnd.comicbook+zip",
+	".djvu": "image/vnd.djvu",
+	".epub": "application/epub+zip",
+	".fb2":  "application/x-fictionbook+xml",
+	".mobi": "application/x-mobipocket-ebook",
+	".pdf":  "application/pdf",
+}
+
+var feedEbookExtensions = []string{".azw3", ".cbr", ".cbz", ".djvu", ".epub", ".fb2", ".mobi", ".pdf"}
+
+// NewFeed turns the listing of the folder at the virtual path of drive into a
+// feed of format, the URLs start with baseURL and the entries are sorted
+// naturally by name, folders first
+func NewFeed(driveItemCachePayload *DriveItemCachePayload, format, baseURL, drive, path string) (*feed.Feed, error) {
+	if format != FeedM3U8 && format != FeedRSS && format != FeedOPDS {
+		return nil, ErrFeedFormatInvalid
+	}
+	if driveItemCachePayload.Folder == nil {
+		return nil, ErrFeedFormatInvalid
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	path = utils.RegularPath(path)
+	newFeed := &feed.Feed{
+		Title:     driveItemCachePayload.Name,
+		URL:       UseFeedURL(baseURL, format, drive, path),
+		Link:      useFeedQueryURL(baseURL+"/onedrive", drive, path),
+		UpdatedAt: driveItemCachePayload.LastModifiedAt,
+		Entries:   []feed.Entry{},
+	}
+	newFeed.ID = newFeed.URL
+	children := append([]DriveItemCachePayload{}, driveItemCachePayload.Children...)
+	sort.SliceStable(children, func(i, j int) bool {
+		if (children[i].Folder != nil) != (children[j].Folder != nil) {
+			return children[i].Folder != nil
+		}
+		return utils.NaturalLess(children[i].Name, children[j].Name)
+	})
+	for _, child := range children {
+		childPath := utils.RegularPath(path + "/" + child.Name)
+		if child.Folder != nil {
+			if format == FeedOPDS {
+				childURL := UseFeedURL(baseURL, format, drive, childPath)
+				newFeed.Entries = append(newFeed.Entries, feed.Entry{
+					ID:        childURL,
+					Title:     child.Name,
+					URL:       childURL,
+					UpdatedAt: child.LastModifiedAt,
+					IsFolder:  true,
+				})
+			}
+			continue
+		}
+		mimeType := useFeedMimeType(&child)
+		isAudio := child.Audio != nil || strings.HasPrefix(mimeType, "audio/")
+		isVideo := child.Video != nil || strings.HasPrefix(mimeType, "video/")
+		switch format {
+		case FeedM3U8:
+			if !isAudio && !isVideo {
+				continue
+			}
+		case FeedRSS:
+			if !isAudio {
+				continue
+			}
+		case FeedOPDS:
+			if !isFeedEbook(child.Name) {
+				continue
+			}
+		}
+		streamURL := baseURL + "/onedrive/stream" + utils.EscapePath(childPath)
+		if drive != "" {
+			streamURL += "?drive=" + url.QueryEscape(drive)
+		}
+		entry := feed.Entry{
+			ID:        streamURL,
+			Title:     strings.TrimSuffix(child.Name, filepath.Ext(child.Name)),
+			URL:       streamURL,
+			MimeType:  mimeType,
+			Size:      child.Size,
+			UpdatedAt: child.LastModifiedAt,
+		}
+		if child.Audio != nil {
+			if child.Audio.Title != "" {
+				entry.Title = child.Audio.Title
+			}
+			entry.Author = child.Audio.Artist
+			if entry.Author == "" {
+				entry.Author = child.Audio.AlbumArtist
+			}
+			entry.Duration = time.Duration(child.Audio.Duration) * time.Millisecond
+		} else if child.Video != nil {
+			entry.Duration = time.Duration(child.Video.Duration) * time.Millisecond
+		}
+		newFeed.Entries = append(newFeed.Entries, entry)
+	}
+	return newFeed, nil
+}
+
+// UseFeedURL returns the URL of the feed of format of the folder at path
+func UseFeedURL(baseURL, format, drive, path string) string {
+	return useFeedQueryURL(strings.TrimSuffix(baseURL, "/")+"/onedrive/feed/"+format, drive, path)
+}
+
+func useFeedQueryURL(str, drive, path string) string {
+	query := url.Values{}
+	if drive != "" {
+		query.Set("drive", drive)
+	}
+	query.Set("path", path)
+	return str + "?" + query.Encode()
+}
+
+func useFeedMimeType(driveItemCachePayload *DriveItemCachePayload) string {
+	if driveItemCachePayload.File != nil && driveItemCachePayload.File.MimeType != "" && driveItemCachePayload.File.MimeType != "application/octet-stream" {
+		return driveItemCachePayload.File.MimeType
+	}
+	extension := strings.ToLower(filepath.Ext(driveItemCachePayload.Name))
+	if mimeType, ok := FeedMimeTypes[extension]; ok {
+		return mimeType
+	}
+	if mimeType := mime.TypeByExtension(extension); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+func isFeedEbook(name string) bool {
+	extension := strings.ToLower(filepath.Ext(name))
+	for _, ebookExtension := range feedEbookExtensions {
+		if extension == ebookExtension {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Feed is a folder turned into a playlist, a podcast or a catalog, all URLs
+// are absolute
+type Feed struct {
+	ID        string
+	Title     string
+	URL       string // of the feed itself
+	Link      string // of the folder in the web client
+	UpdatedAt time.Time
+	Entries   []Entry
+}
+
+// Entry is a file of a feed, or a folder linking to its own feed
+type Entry struct {
+	ID        string
+	Title     string
+	URL       string
+	MimeType  string
+	Size      int64
+	Duration  time.Duration
+	Author    string
+	UpdatedAt time.Time
+	IsFolder  bool
+}
+
+// WriteM3U8 writes the files of the feed as an extended M3U playlist in UTF-8
+func WriteM3U8(w io.Writer, feed *Feed) error {
+	if _, err := io.WriteString(w, "#EXTM3U\n"); err != nil {
+		return err
+	}
+	for _, entry := range feed.Entries {
+		if entry.IsFolder {
+			continue
+		}
+		duration := int64(-1)
+		if entry.Duration > 0 {
+			duration = int64(entry.Duration.Seconds())
+		}
+		title := entry.Title
+		if entry.Author != "" {
+			title = entry.Author + " - " + title
+		}
+		title = strings.NewReplacer("\r", " ", "\n", " ").Replace(title)
+		if _, err := fmt.Fprintf(w, "#EXTINF:%d,%s\n%s\n", duration, title, entry.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string       `xml:"title"`
+	GUID      rssGUID      `xml:"guid"`
+	PubDate   string       `xml:"pubDate,omitempty"`
+	Enclosure rssEnclosure `xml:"enclosure"`
+	Author    string       `xml:"itunes:author,omitempty"`
+	Duration  string       `xml:"itunes:duration,omitempty"`
+	Episode   int          `xml:"itunes:episode,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// WriteRSS writes the files of the feed as a podcast RSS 2.0 feed, episodes
+// are numbered in the order of the entries
+func WriteRSS(w io.Writer, feed *Feed) error {
+	channel := rssChannel{
+		Title:       feed.Title,
+		Link:        feed.Link,
+		AtomLink:    atomLink{Rel: "self", Type: "application/rss+xml", Href: feed.URL},
+		Description: feed.Title,
+		Items:       []rssItem{},
+	}
+	if !feed.UpdatedAt.IsZero() {
+		channel.LastBuildDate = feed.UpdatedAt.UTC().Format(time.RFC1123Z)
+	}
+	for _, entry := range feed.Entries {
+		if entry.IsFolder {
+			continue
+		}
+		item := rssItem{
+			Title:     entry.Title,
+			GUID:      rssGUID{Value: entry.ID},
+			Enclosure: rssEnclosure{URL: entry.URL, Length: entry.Size, Type: entry.MimeType},
+			Author:    entry.Author,
+			Episode:   len(channel.Items) + 1,
+		}
+		if !entry.UpdatedAt.IsZero() {
+			item.PubDate = entry.UpdatedAt.UTC().Format(time.RFC1123Z)
+		}
+		if entry.Duration > 0 {
+			item.Duration = strconv.FormatInt(int64(entry.Duration.Seconds()), 10)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return writeXML(w, rss{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: channel,
+	})
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Links   []atomLink  `xml:"link"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// OPDS link relations and types
+const (
+	OPDSAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	opdsAcquisition     = "http://opds-spec.org/acquisition"
+)
+
+// WriteOPDS writes the feed as an OPDS 1.2 acquisition feed, folders are
+// linked as subsections
+func WriteOPDS(w io.Writer, feed *Feed) error {
+	atom := atomFeed{
+		XMLNS:   "http://www.w3.org/2005/Atom",
+		ID:      feed.ID,
+		Title:   feed.Title,
+		Updated: feed.UpdatedAt.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: OPDSAcquisitionType, Href: feed.URL},
+			{Rel: "start", Type: OPDSAcquisitionType, Href: feed.URL},
+		},
+		Entries: []atomEntry{},
+	}
+	for _, entry := range feed.Entries {
+		atomEntry := atomEntry{
+			ID:      entry.ID,
+			Title:   entry.Title,
+			Updated: entry.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		if entry.Author != "" {
+			atomEntry.Author = &atomAuthor{Name: entry.Author}
+		}
+		if entry.IsFolder {
+			atomEntry.Links = []atomLink{{Rel: "subsection", Type: OPDSAcquisitionType, Href: entry.URL}}
+		} else {
+			atomEntry.Links = []atomLink{{Rel: opdsAcquisition, Type: entry.MimeType, Href: entry.URL, Length: entry.Size}}
+		}
+		atom.Entries = append(atom.Entries, atomEntry)
+	}
+	return writeXML(w, atom)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(v)
+}
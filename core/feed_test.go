@@ -0,0 +1,69 @@
+package core
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/AirWSW/onedrive/core/feed"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestNewFeed(t *testing.T) {
+	driveItemCachePayload := &DriveItemCachePayload{
+		Name:   "book",
+		Folder: &graphapi.MicrosoftGraphFolder{},
+		Children: []DriveItemCachePayload{
+			{Name: "Chapter 10.mp3", File: &graphapi.MicrosoftGraphFile{}, Size: 10},
+			{Name: "Chapter 2.mp3", File: &graphapi.MicrosoftGraphFile{MimeType: "audio/mpeg"}, Audio: &graphapi.MicrosoftGraphAudio{Title: "Two", Artist: "A", Duration: 61000}},
+			{Name: "cover.jpg", File: &graphapi.MicrosoftGraphFile{MimeType: "image/jpeg"}},
+			{Name: "extras", Folder: &graphapi.MicrosoftGraphFolder{}},
+			{Name: "book.epub", File: &graphapi.MicrosoftGraphFile{}},
+		},
+	}
+	newFeed, err := NewFeed(driveItemCachePayload, FeedM3U8, "https://example.com/", "media", "/audio books/book")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	buffer := &bytes.Buffer{}
+	if err := feed.WriteM3U8(buffer, newFeed); err != nil {
+		t.Fatalf("%s", err)
+	}
+	m3u8 := "#EXTM3U\n" +
+		"#EXTINF:61,A - Two\nhttps://example.com/onedrive/stream/audio%20books/book/Chapter%202.mp3?drive=media\n" +
+		"#EXTINF:-1,Chapter 10\nhttps://example.com/onedrive/stream/audio%20books/book/Chapter%2010.mp3?drive=media\n"
+	if buffer.String() != m3u8 {
+		t.Errorf("got %s", buffer.String())
+	}
+
+	newFeed, err = NewFeed(driveItemCachePayload, FeedOPDS, "https://example.com", "", "/audio books/book")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(newFeed.Entries) != 2 || !newFeed.Entries[0].IsFolder || newFeed.Entries[1].MimeType != "application/epub+zip" {
+		t.Errorf("got %+v", newFeed.Entries)
+	}
+	if newFeed.Entries[0].URL != "https://example.com/onedrive/feed/opds?path=%2Faudio+books%2Fbook%2Fextras" {
+		t.Errorf("got %s", newFeed.Entries[0].URL)
+	}
+	for _, write := range []func(io.Writer, *feed.Feed) error{feed.WriteRSS, feed.WriteOPDS} {
+		buffer.Reset()
+		if err := write(buffer, newFeed); err != nil {
+			t.Fatalf("%s", err)
+		}
+		decoder := xml.NewDecoder(strings.NewReader(buffer.String()))
+		for {
+			if _, err := decoder.Token(); err != nil {
+				if err != io.EOF {
+					t.Errorf("%s in %s", err, buffer.String())
+				}
+				break
+			}
+		}
+	}
+	if _, err := NewFeed(driveItemCachePayload, "html", "", "", "/"); err != ErrFeedFormatInvalid {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package index
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var mutex sync.Mutex
+
+// Item is an indexed drive item, paths are relative to the root path
+type Item struct {
+	Path           string `json:"path"`
+	Name           string `json:"name"`
+	IsFolder       bool   `json:"isFolder,omitempty"`
+	Size           int64  `json:"size"`
+	CreatedAt      int64  `json:"createdAt"`
+	LastModifiedAt int64  `json:"lastModifiedAt"`
+}
+
+// Index is an inverted index of the terms of the names and the parent paths
+// of the cached items of a drive, it is updated folder by folder as the
+// drive cache refreshes
+type Index struct {
+	mutex     sync.RWMutex
+	items     map[string]*Item
+	nameTerms map[string]map[string]bool
+	pathTerms map[string]map[string]bool
+}
+
+// indexFile is the persisted index, the postings are sorted paths
+type indexFile struct {
+	Items     []*Item             `json:"items"`
+	NameTerms map[string][]string `json:"nameTerms"`
+	PathTerms map[string][]string `json:"pathTerms"`
+}
+
+// NewIndex returns an empty index
+func NewIndex() *Index {
+	return &Index{
+		items:     map[string]*Item{},
+		nameTerms: map[string]map[string]bool{},
+		pathTerms: map[string]map[string]bool{},
+	}
+}
+
+// Terms splits str into lower case terms at every rune neither a letter nor
+// a digit
+func Terms(str string) []string {
+	return strings.FieldsFunc(strings.ToLower(str), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func parentPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+func IsSubPath(path, parentPath string) bool {
+	return parentPath == "/" || path == parentPath || strings.HasPrefix(path, parentPath+"/")
+}
+
+// Len returns the count of indexed items
+func (ix *Index) Len() int {
+	ix.mutex.RLock()
+	defer ix.mutex.RUnlock()
+	return len(ix.items)
+}
+
+// Put indexes the item or replaces the item of the same path
+func (ix *Index) Put(item Item) {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	ix.put(item)
+}
+
+func (ix *Index) put(item Item) {
+	if oldItem, ok := ix.items[item.Path]; ok {
+		if *oldItem == item {
+			return
+		}
+		ix.remove(item.Path)
+	}
+	ix.items[item.Path] = &item
+	addPostings(ix.nameTerms, Terms(item.Name), item.Path)
+	addPostings(ix.pathTerms, Terms(parentPath(item.Path)), item.Path)
+}
+
+func addPostings(terms map[string]map[string]bool, newTerms []string, path string) {
+	for _, term := range newTerms {
+		if terms[term] == nil {
+			terms[term] = map[string]bool{}
+		}
+		terms[term][path] = true
+	}
+}
+
+func removePostings(terms map[string]map[string]bool, oldTerms []string, path string) {
+	for _, term := range oldTerms {
+		delete(terms[term], path)
+		if len(terms[term]) == 0 {
+			delete(terms, term)
+		}
+	}
+}
+
+// Remove removes the item at path and all items below
+func (ix *Index) Remove(path string) {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	ix.removeTree(path)
+}
+
+func (ix *Index) remove(path string) {
+	item, ok := ix.items[path]
+	if !ok {
+		return
+	}
+	removePostings(ix.nameTerms, Terms(item.Name), path)
+	removePostings(ix.pathTerms, Terms(parentPath(path)), path)
+	delete(ix.items, path)
+}
+
+func (ix *Index) removeTree(path string) {
+	if item, ok := ix.items[path]; ok && !item.IsFolder {
+		ix.remove(path)
+		return
+	}
+	for itemPath := range ix.items {
+		if IsSubPath(itemPath, path) {
+			ix.remove(itemPath)
+		}
+	}
+}
+
+// UpdateFolder replaces the children of the folder at path, the children
+// gone are removed with all items below
+func (ix *Index) UpdateFolder(path string, children []Item) {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	isFound := map[string]bool{}
+	for _, child := range children {
+		isFound[child.Path] = true
+	}
+	for itemPath, item := range ix.items {
+		if itemPath != path && parentPath(itemPath) == path && !isFound[itemPath] {
+			if item.IsFolder {
+				ix.removeTree(itemPath)
+			} else {
+				ix.remove(itemPath)
+			}
+		}
+	}
+	for _, child := range children {
+		ix.put(child)
+	}
+}
+
+// Load reads the index persisted at file, a missing file is an empty index
+func (ix *Index) Load(file string) error {
+	mutex.Lock()
+	bytes, err := ioutil.ReadFile(file)
+	mutex.Unlock()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	persisted := indexFile{}
+	if err := json.Unmarshal(bytes, &persisted); err != nil {
+		return err
+	}
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	ix.items = map[string]*Item{}
+	for _, item := range persisted.Items {
+		ix.items[item.Path] = item
+	}
+	ix.nameTerms = loadPostings(persisted.NameTerms)
+	ix.pathTerms = loadPostings(persisted.PathTerms)
+	log.Println("Loaded index of", len(ix.items), "items from", file)
+	return nil
+}
+
+func loadPostings(persisted map[string][]string) map[string]map[string]bool {
+	terms := map[string]map[string]bool{}
+	for term, paths := range persisted {
+		terms[term] = map[string]bool{}
+		for _, path := range paths {
+			terms[term][path] = true
+		}
+	}
+	return terms
+}
+
+// Save persists the index at file
+func (ix *Index) Save(file string) error {
+	ix.mutex.RLock()
+	persisted := indexFile{
+		Items:     make([]*Item, 0, len(ix.items)),
+		NameTerms: savePostings(ix.nameTerms),
+		PathTerms: savePostings(ix.pathTerms),
+	}
+	for _, item := range ix.items {
+		persisted.Items = append(persisted.Items, item)
+	}
+	sort.Slice(persisted.Items, func(i, j int) bool { return persisted.Items[i].Path < persisted.Items[j].Path })
+	bytes, err := json.Marshal(persisted)
+	ix.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	return ioutil.WriteFile(file, bytes, 0644)
+}
+
+func savePostings(terms map[string]map[string]bool) map[string][]string {
+	persisted := map[string][]string{}
+	for term, paths := range terms {
+		for path := range paths {
+			persisted[term] = append(persisted[term], path)
+		}
+		sort.Strings(persisted[term])
+	}
+	return persisted
+}
+
+// Match returns the items whose name or parent path has a term starting with
+// each of words and whose parent path has each of pathTerms, all items if
+// both are empty
+func (ix *Index) Match(words, pathTerms []string) []Item {
+	ix.mutex.RLock()
+	defer ix.mutex.RUnlock()
+	var paths map[string]bool
+	intersect := func(matched map[string]bool) {
+		if paths == nil {
+			paths = matched
+			return
+		}
+		for path := range paths {
+			if !matched[path] {
+				delete(paths, path)
+			}
+		}
+	}
+	for _, word := range words {
+		matched := map[string]bool{}
+		for _, terms := range []map[string]map[string]bool{ix.nameTerms, ix.pathTerms} {
+			for term, postings := range terms {
+				if strings.HasPrefix(term, word) {
+					for path := range postings {
+						matched[path] = true
+					}
+				}
+			}
+		}
+		intersect(matched)
+	}
+	for _, pathTerm := range pathTerms {
+		matched := map[string]bool{}
+		for path := range ix.pathTerms[pathTerm] {
+			matched[path] = true
+		}
+		intersect(matched)
+	}
+	items := []Item{}
+	if paths == nil {
+		for _, item := range ix.items {
+			items = append(items, *item)
+		}
+		return items
+	}
+	for path := range paths {
+		items = append(items, *ix.items[path])
+	}
+	return items
+}
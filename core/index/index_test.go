@@ -0,0 +1,61 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func useTestPaths(items []Item) string {
+	paths := []string{}
+	for _, item := range items {
+		paths = append(paths, item.Path)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ",")
+}
+
+func TestIndex(t *testing.T) {
+	ix := NewIndex()
+	ix.UpdateFolder("/", []Item{
+		{Path: "/tv.shows", Name: "tv.shows", IsFolder: true},
+		{Path: "/notes.txt", Name: "notes.txt"},
+	})
+	ix.UpdateFolder("/tv.shows", []Item{
+		{Path: "/tv.shows/Show.S01E01.mkv", Name: "Show.S01E01.mkv"},
+		{Path: "/tv.shows/Show.S01E02.mkv", Name: "Show.S01E02.mkv"},
+	})
+	if paths := useTestPaths(ix.Match([]string{"show"}, nil)); paths != "/tv.shows,/tv.shows/Show.S01E01.mkv,/tv.shows/Show.S01E02.mkv" {
+		t.Errorf("show got %s", paths)
+	}
+	if paths := useTestPaths(ix.Match([]string{"mkv"}, []string{"tv"})); paths != "/tv.shows/Show.S01E01.mkv,/tv.shows/Show.S01E02.mkv" {
+		t.Errorf("mkv path:tv got %s", paths)
+	}
+
+	// A child gone from its folder is removed with all items below
+	ix.UpdateFolder("/tv.shows", []Item{{Path: "/tv.shows/Show.S01E02.mkv", Name: "Show.S01E02.mkv"}})
+	if paths := useTestPaths(ix.Match([]string{"s01e01"}, nil)); paths != "" {
+		t.Errorf("s01e01 got %s", paths)
+	}
+	ix.UpdateFolder("/", []Item{{Path: "/notes.txt", Name: "notes.txt"}})
+	if ix.Len() != 1 {
+		t.Errorf("got %d items", ix.Len())
+	}
+
+	file := filepath.Join(t.TempDir(), "test.index.json")
+	if err := ix.Save(file); err != nil {
+		t.Fatalf("%s", err)
+	}
+	loaded := NewIndex()
+	if err := loaded.Load(file); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if paths := useTestPaths(loaded.Match([]string{"note"}, nil)); paths != "/notes.txt" {
+		t.Errorf("loaded got %s", paths)
+	}
+	if err := NewIndex().Load(filepath.Join(t.TempDir(), "missing.json")); err != nil && !os.IsNotExist(err) {
+		t.Errorf("missing got %s", err)
+	}
+}
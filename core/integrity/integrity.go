@@ -0,0 +1,132 @@
+package integrity
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// HashMismatchError reports a content hash which does NOT match the one
+// reported by Microsoft Graph
+type HashMismatchError struct {
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *HashMismatchError) Error() string {
+	return "MicrosoftGraphHashesMismatch " + e.Algorithm + " expected " + e.Expected + " got " + e.Actual
+}
+
+// IsHashMismatch reports whether err is a *HashMismatchError
+func IsHashMismatch(err error) bool {
+	_, ok := err.(*HashMismatchError)
+	return ok
+}
+
+// Hasher computes all MicrosoftGraphHashes of the content written to it
+type Hasher struct {
+	quickXorHash hash.Hash
+	sha1Hash     hash.Hash
+	crc32Hash    hash.Hash32
+	writer       io.Writer
+}
+
+func NewHasher() *Hasher {
+	h := &Hasher{
+		quickXorHash: NewQuickXorHash(),
+		sha1Hash:     sha1.New(),
+		crc32Hash:    crc32.NewIEEE(),
+	}
+	h.writer = io.MultiWriter(h.quickXorHash, h.sha1Hash, h.crc32Hash)
+	return h
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	return h.writer.Write(p)
+}
+
+func (h *Hasher) Reset() {
+	h.quickXorHash.Reset()
+	h.sha1Hash.Reset()
+	h.crc32Hash.Reset()
+}
+
+// Sum returns the hashes in the same encoding as Microsoft Graph does,
+// crc32Hash is the little endian hex of the CRC32 value
+func (h *Hasher) Sum() *graphapi.MicrosoftGraphHashes {
+	crc32Bytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crc32Bytes, h.crc32Hash.Sum32())
+	quickXorHash := base64.StdEncoding.EncodeToString(h.quickXorHash.Sum(nil))
+	sha1Hash := strings.ToUpper(hex.EncodeToString(h.sha1Hash.Sum(nil)))
+	crc32Hash := strings.ToUpper(hex.EncodeToString(crc32Bytes))
+	return &graphapi.MicrosoftGraphHashes{
+		CRC32Hash:    &crc32Hash,
+		SHA1Hash:     &sha1Hash,
+		QuickXorHash: &quickXorHash,
+	}
+}
+
+// Verify compares every hash provided by the drive type, personal drives
+// report sha1Hash and crc32Hash while business drives report quickXorHash
+func (h *Hasher) Verify(expected *graphapi.MicrosoftGraphHashes) error {
+	if expected == nil {
+		return nil
+	}
+	actual := h.Sum()
+	if expected.QuickXorHash != nil && *expected.QuickXorHash != *actual.QuickXorHash {
+		return &HashMismatchError{"quickXorHash", *expected.QuickXorHash, *actual.QuickXorHash}
+	}
+	if expected.SHA1Hash != nil && !strings.EqualFold(*expected.SHA1Hash, *actual.SHA1Hash) {
+		return &HashMismatchError{"sha1Hash", *expected.SHA1Hash, *actual.SHA1Hash}
+	}
+	if expected.CRC32Hash != nil && !strings.EqualFold(*expected.CRC32Hash, *actual.CRC32Hash) {
+		return &HashMismatchError{"crc32Hash", *expected.CRC32Hash, *actual.CRC32Hash}
+	}
+	return nil
+}
+
+type verifyingReader struct {
+	reader   *bufio.Reader
+	hasher   *Hasher
+	expected *graphapi.MicrosoftGraphHashes
+}
+
+// NewVerifyingReader returns a reader which hashes everything read from r
+// and returns a *HashMismatchError instead of io.EOF on mismatch, the last
+// byte is held back until the content is verified so corrupted content is
+// never read completely
+func NewVerifyingReader(r io.Reader, expected *graphapi.MicrosoftGraphHashes) io.Reader {
+	return &verifyingReader{
+		reader:   bufio.NewReader(r),
+		hasher:   NewHasher(),
+		expected: expected,
+	}
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	n, err := vr.reader.Read(p)
+	vr.hasher.Write(p[:n])
+	if err == nil {
+		if _, err = vr.reader.Peek(1); err == nil {
+			return n, nil
+		}
+	}
+	if err == io.EOF {
+		if verifyErr := vr.hasher.Verify(vr.expected); verifyErr != nil {
+			if n > 0 {
+				n--
+			}
+			return n, verifyErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,71 @@
+package integrity
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestQuickXorHash(t *testing.T) {
+	long := []byte{}
+	for i := 0; i < 768; i++ {
+		long = append(long, byte(i))
+	}
+	tests := []struct {
+		input []byte
+		want  string
+	}{
+		{[]byte(""), "AAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+		{[]byte("0"), "MAAAAAAAAAAAAAAAAQAAAAAAAAA="},
+		{[]byte("Hello, World!"), "SCgDG9jwBhaA4ApvnQMbyBACAAA="},
+		{long, "rxAOGe1RimTF/e+k/m0O5nnSZT8="},
+	}
+	for _, test := range tests {
+		h := NewQuickXorHash()
+		h.Write(test.input)
+		if got := base64.StdEncoding.EncodeToString(h.Sum(nil)); got != test.want {
+			t.Errorf("QuickXorHash(%d bytes) = %s, want %s", len(test.input), got, test.want)
+		}
+		// Writing in odd sized chunks must produce the same result
+		h.Reset()
+		for i := 0; i < len(test.input); i += 7 {
+			end := i + 7
+			if end > len(test.input) {
+				end = len(test.input)
+			}
+			h.Write(test.input[i:end])
+		}
+		if got := base64.StdEncoding.EncodeToString(h.Sum(nil)); got != test.want {
+			t.Errorf("QuickXorHash(%d bytes) chunked = %s, want %s", len(test.input), got, test.want)
+		}
+	}
+}
+
+func TestVerifyingReader(t *testing.T) {
+	content := []byte("Hello, World!")
+	quickXorHash := "SCgDG9jwBhaA4ApvnQMbyBACAAA="
+	sha1Hash := "0a0a9f2a6772942557ab5355d76af442f8f65e01"
+	expected := &graphapi.MicrosoftGraphHashes{
+		QuickXorHash: &quickXorHash,
+		SHA1Hash:     &sha1Hash,
+	}
+	if _, err := ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(content), expected)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, err := ioutil.ReadAll(iotest.OneByteReader(NewVerifyingReader(bytes.NewReader(content), expected))); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("got %q %v", got, err)
+	}
+	// The last byte of corrupted content is never returned
+	got, err := ioutil.ReadAll(NewVerifyingReader(io.MultiReader(bytes.NewReader(content), bytes.NewReader([]byte("!"))), expected))
+	if !IsHashMismatch(err) {
+		t.Fatalf("expected HashMismatchError, got %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,101 @@
+package integrity
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+// QuickXorHash is the hash algorithm used by OneDrive for Business and
+// SharePoint, see https://docs.microsoft.com/en-us/onedrive/developer/code-snippets/quickxorhash
+const (
+	QuickXorHashBlockSize = 64
+	QuickXorHashSize      = 20
+
+	quickXorHashShift          = 11
+	quickXorHashWidthInBits    = 8 * QuickXorHashSize
+	quickXorHashBitsInLastCell = 32
+)
+
+type quickXorHash struct {
+	data        [(quickXorHashWidthInBits-1)/64 + 1]uint64
+	lengthSoFar uint64
+	shiftSoFar  int
+}
+
+// NewQuickXorHash returns a new hash.Hash computing the QuickXorHash checksum
+func NewQuickXorHash() hash.Hash {
+	return &quickXorHash{}
+}
+
+func (q *quickXorHash) Write(p []byte) (int, error) {
+	currentShift := q.shiftSoFar
+	vectorArrayIndex := currentShift / 64
+	vectorOffset := currentShift % 64
+	iterations := len(p)
+	if iterations > quickXorHashWidthInBits {
+		iterations = quickXorHashWidthInBits
+	}
+	for i := 0; i < iterations; i++ {
+		isLastCell := vectorArrayIndex == len(q.data)-1
+		bitsInVectorCell := 64
+		if isLastCell {
+			bitsInVectorCell = quickXorHashBitsInLastCell
+		}
+		if vectorOffset <= bitsInVectorCell-8 {
+			for j := i; j < len(p); j += quickXorHashWidthInBits {
+				q.data[vectorArrayIndex] ^= uint64(p[j]) << uint(vectorOffset)
+			}
+		} else {
+			index1 := vectorArrayIndex
+			index2 := vectorArrayIndex + 1
+			if isLastCell {
+				index2 = 0
+			}
+			low := uint(bitsInVectorCell - vectorOffset)
+			xoredByte := byte(0)
+			for j := i; j < len(p); j += quickXorHashWidthInBits {
+				xoredByte ^= p[j]
+			}
+			q.data[index1] ^= uint64(xoredByte) << uint(vectorOffset)
+			q.data[index2] ^= uint64(xoredByte) >> low
+		}
+		vectorOffset += quickXorHashShift
+		for vectorOffset >= bitsInVectorCell {
+			if isLastCell {
+				vectorArrayIndex = 0
+			} else {
+				vectorArrayIndex++
+			}
+			vectorOffset -= bitsInVectorCell
+		}
+	}
+	q.shiftSoFar = (q.shiftSoFar + quickXorHashShift*(len(p)%quickXorHashWidthInBits)) % quickXorHashWidthInBits
+	q.lengthSoFar += uint64(len(p))
+	return len(p), nil
+}
+
+func (q *quickXorHash) Sum(b []byte) []byte {
+	rgb := make([]byte, 8*len(q.data))
+	for i, cell := range q.data {
+		binary.LittleEndian.PutUint64(rgb[8*i:], cell)
+	}
+	rgb = rgb[:QuickXorHashSize]
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, q.lengthSoFar)
+	for i := range length {
+		rgb[QuickXorHashSize-8+i] ^= length[i]
+	}
+	return append(b, rgb...)
+}
+
+func (q *quickXorHash) Reset() {
+	*q = quickXorHash{}
+}
+
+func (q *quickXorHash) Size() int {
+	return QuickXorHashSize
+}
+
+func (q *quickXorHash) BlockSize() int {
+	return QuickXorHashBlockSize
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"io"
+
+	"github.com/AirWSW/onedrive/metrics"
+)
+
+// useMetricsDrive returns the drive label of the metrics of the drive
+func (od *OneDrive) useMetricsDrive() string {
+	if od.OneDriveDescription.OneDriveName == nil {
+		return ""
+	}
+	return *od.OneDriveDescription.OneDriveName
+}
+
+// countCacheLookup counts a lookup of the cache of the drive, driveitem,
+// contenturl, content or thumbnail
+func (od *OneDrive) countCacheLookup(cache string, hit bool) {
+	if hit {
+		metrics.CacheHits.Inc(od.useMetricsDrive(), cache)
+	} else {
+		metrics.CacheMisses.Inc(od.useMetricsDrive(), cache)
+	}
+}
+
+// useCacheEviction returns the function counting the evictions of the cache
+// of the drive
+func (od *OneDrive) useCacheEviction(cache string) func() {
+	drive := od.useMetricsDrive()
+	return func() {
+		metrics.CacheEvictions.Inc(drive, cache)
+	}
+}
+
+// uploadCountingReader counts the bytes read for upload to the drive
+type uploadCountingReader struct {
+	io.Reader
+	drive string
+}
+
+func (r *uploadCountingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	metrics.UploadBytes.Add(float64(n), r.drive)
+	return n, err
+}
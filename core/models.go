@@ -3,9 +3,14 @@ package core
 import (
 	"time"
 
+	"github.com/AirWSW/onedrive/core/activity"
 	"github.com/AirWSW/onedrive/core/api"
 	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/contentcache"
 	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/index"
+	"github.com/AirWSW/onedrive/core/sharing"
+	"github.com/AirWSW/onedrive/core/thumbnail"
 	"github.com/AirWSW/onedrive/core/upload"
 	"github.com/AirWSW/onedrive/graphapi"
 )
@@ -19,19 +24,37 @@ type OneDrive struct {
 	MicrosoftGraphAPI      api.MicrosoftGraphAPI           `json:"microsoftGraphApi,omitempty"`
 	DriveCacheCollection   cache.DriveCacheCollection      `json:"driveCacheCollection,omitempty"`
 	UploaderCollection     upload.UploaderCollection       `json:"uploaderCollection,omitempty"`
+	ContentCache           *contentcache.ContentCache      `json:"-"`
+	DriveIndex             *index.Index                    `json:"-"`
+	ThumbnailCache         *thumbnail.Cache                `json:"-"`
+	SharingCache           *sharing.Cache                  `json:"-"`
+	ActivityLog            *activity.Log                   `json:"-"`
+	odc                    oneDriveCollection
+	namespace              bool
+	activityGraphRetryAt   int64 // unix time, accessed atomically
+	quota                  *graphapi.MicrosoftGraphQuota
+	quotaRefreshedAt       time.Time
 }
 
 type DriveItemCachePayload struct {
-	Description    *string                         `json:"description,omitempty"`
-	File           *graphapi.MicrosoftGraphFile    `json:"file,omitempty"`
-	Folder         *graphapi.MicrosoftGraphFolder  `json:"folder,omitempty"`
-	Size           int64                           `json:"size"`
-	Children       []DriveItemCachePayload         `json:"children,omitempty"`
-	CreatedAt      time.Time                       `json:"createdAt"`
-	LastModifiedAt time.Time                       `json:"lastModifiedAt"`
-	Name           string                          `json:"name"`
-	Reference      *DriveItemCachePayloadReference `json:"reference,omitempty"`
-	DownloadURL    *string                         `json:"downloadUrl,omitempty"`
+	Description    *string                                `json:"description,omitempty"`
+	File           *graphapi.MicrosoftGraphFile           `json:"file,omitempty"`
+	Folder         *graphapi.MicrosoftGraphFolder         `json:"folder,omitempty"`
+	Size           int64                                  `json:"size"`
+	Children       []DriveItemCachePayload                `json:"children,omitempty"`
+	CreatedAt      time.Time                              `json:"createdAt"`
+	LastModifiedAt time.Time                              `json:"lastModifiedAt"`
+	Name           string                                 `json:"name"`
+	Reference      *DriveItemCachePayloadReference        `json:"reference,omitempty"`
+	DownloadURL    *string                                `json:"downloadUrl,omitempty"`
+	SearchResult   *graphapi.MicrosoftGraphSearchResult   `json:"searchResult,omitempty"`
+	ThumbnailURL   *string                                `json:"thumbnailUrl,omitempty"`
+	Image          *graphapi.MicrosoftGraphImage          `json:"image,omitempty"`
+	Photo          *graphapi.MicrosoftGraphPhoto          `json:"photo,omitempty"`
+	Video          *graphapi.MicrosoftGraphVideo          `json:"video,omitempty"`
+	Audio          *graphapi.MicrosoftGraphAudio          `json:"audio,omitempty"`
+	Location       *graphapi.MicrosoftGraphGEOCoordinates `json:"location,omitempty"`
+	Permissions    []graphapi.MicrosoftGraphPermission    `json:"permissions,omitempty"`
 }
 
 type DriveItemCachePayloadReference struct {
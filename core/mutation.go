@@ -0,0 +1,126 @@
+package core
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// CreateMicrosoftGraphDriveFolder creates the folder at path, conflictBehavior
+// is one of rename, fail and replace
+func (od *OneDrive) CreateMicrosoftGraphDriveFolder(path, conflictBehavior string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	parentPath, filename := utils.RegularPathToPathFilename(newPath)
+	if filename == "" {
+		return nil, errors.New("od.CreateMicrosoftGraphDriveFolder InvalidPath " + path)
+	}
+	microsoftGraphDriveItem, err := od.MicrosoftGraphAPI.PostMicrosoftGraphAPIMeDriveFolder(&odd, odd.RelativePathToDriveRootPath(parentPath), filename, conflictBehavior)
+	if err != nil {
+		return nil, err
+	}
+	// The folder may be renamed by conflictBehavior
+	od.patchMicrosoftGraphDriveItemCache(utils.RegularPath(parentPath+"/"+microsoftGraphDriveItem.Name), microsoftGraphDriveItem)
+	return microsoftGraphDriveItem, nil
+}
+
+// MoveMicrosoftGraphDriveItem moves the item at path to destination, which
+// renames the item if both share the same parent folder
+func (od *OneDrive) MoveMicrosoftGraphDriveItem(path, destination string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	newDestination := utils.RegularPath(destination)
+	parentPath, filename := utils.RegularPathToPathFilename(newPath)
+	destinationParentPath, destinationFilename := utils.RegularPathToPathFilename(newDestination)
+	if filename == "" || destinationFilename == "" {
+		return nil, errors.New("od.MoveMicrosoftGraphDriveItem InvalidPath " + path + " " + destination)
+	}
+	name, newParentPath := "", ""
+	if filename != destinationFilename {
+		name = destinationFilename
+	}
+	if utils.RegularPath(parentPath) != utils.RegularPath(destinationParentPath) {
+		newParentPath = odd.RelativePathToDriveRootPath(destinationParentPath)
+	}
+	if name == "" && newParentPath == "" {
+		return nil, errors.New("od.MoveMicrosoftGraphDriveItem SamePath " + path)
+	}
+	microsoftGraphDriveItem, err := od.MicrosoftGraphAPI.PatchMicrosoftGraphAPIMeDriveItem(&odd, odd.RelativePathToDriveRootPath(newPath), name, newParentPath)
+	if err != nil {
+		return nil, err
+	}
+	od.DriveCacheCollection.RemoveMicrosoftGraphDriveItemCache(odd.RelativePathToDriveRootPath(newPath))
+	od.removeDriveIndexItem(newPath)
+	od.patchMicrosoftGraphDriveItemCache(newDestination, microsoftGraphDriveItem)
+	return microsoftGraphDriveItem, nil
+}
+
+// RenameMicrosoftGraphDriveItem renames the item at path to name
+func (od *OneDrive) RenameMicrosoftGraphDriveItem(path, name string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	parentPath, _ := utils.RegularPathToPathFilename(utils.RegularPath(path))
+	return od.MoveMicrosoftGraphDriveItem(path, parentPath+"/"+name)
+}
+
+// DeleteMicrosoftGraphDriveItem moves the item at path to the recycle bin and
+// returns the deleted item, whose ID is required to restore it
+func (od *OneDrive) DeleteMicrosoftGraphDriveItem(path string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	if newPath == "/" {
+		return nil, errors.New("od.DeleteMicrosoftGraphDriveItem CanNotDeleteRoot")
+	}
+	drivePath := odd.RelativePathToDriveRootPath(newPath)
+	microsoftGraphDriveItem, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveItem(&odd, drivePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := od.MicrosoftGraphAPI.DeleteMicrosoftGraphAPIMeDriveItem(&odd, drivePath); err != nil {
+		return nil, err
+	}
+	od.DriveCacheCollection.RemoveMicrosoftGraphDriveItemCache(drivePath)
+	od.removeDriveIndexItem(newPath)
+	od.addTombstone(drivePath, newTombstone(microsoftGraphDriveItem, time.Now()))
+	od.SaveDriveCacheCollection()
+	return microsoftGraphDriveItem, nil
+}
+
+// RestoreMicrosoftGraphDriveItem restores the deleted item id into parentPath
+// as name, empty arguments restore the item to its original location
+func (od *OneDrive) RestoreMicrosoftGraphDriveItem(id, parentPath, name string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	odd := od.OneDriveDescription
+	parentID := ""
+	if parentPath != "" {
+		parent, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveItem(&odd, odd.RelativePathToDriveRootPath(utils.RegularPath(parentPath)))
+		if err != nil {
+			return nil, err
+		}
+		parentID = parent.ID
+	}
+	microsoftGraphDriveItem, err := od.MicrosoftGraphAPI.PostMicrosoftGraphAPIMeDriveItemRestore(&odd, id, parentID, name)
+	if err != nil {
+		return nil, err
+	}
+	od.DriveCacheCollection.RemoveTombstone(id)
+	if microsoftGraphDriveItem.ParentReference != nil {
+		relativePath := odd.DriveRootPathToRelativePath(microsoftGraphDriveItem.ParentReference.Path)
+		od.patchMicrosoftGraphDriveItemCache(utils.RegularPath(relativePath+"/"+microsoftGraphDriveItem.Name), microsoftGraphDriveItem)
+	}
+	return microsoftGraphDriveItem, nil
+}
+
+// patchMicrosoftGraphDriveItemCache puts the changed item at path into the
+// cache immediately instead of waiting for the next cron pass
+func (od *OneDrive) patchMicrosoftGraphDriveItemCache(path string, microsoftGraphDriveItem *graphapi.MicrosoftGraphDriveItem) {
+	drivePath := od.OneDriveDescription.RelativePathToDriveRootPath(path)
+	od.putDriveIndexItem(path, microsoftGraphDriveItem)
+	if err := od.DriveCacheCollection.UpsertMicrosoftGraphDriveItemCache(drivePath, microsoftGraphDriveItem); err != nil {
+		log.Println("od.patchMicrosoftGraphDriveItemCache", err)
+		if err := od.ForceGetMicrosoftGraphDriveItem(path, "patch"); err != nil {
+			log.Println("od.patchMicrosoftGraphDriveItemCache", err)
+		}
+	}
+	od.SaveDriveCacheCollection()
+}
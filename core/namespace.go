@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+var ErrNamespaceItemNotFound = errors.New("NamespaceItemNotFound")
+
+// NewNamespaceOneDrive returns the virtual drive named name which aggregates
+// the drives of odc by its volume mounts, the virtual drive holds no item
+// itself but the folders above its volume mounts
+func NewNamespaceOneDrive(name string, driveVolumeMounts []description.DriveVolumeMount, odc oneDriveCollection) *OneDrive {
+	return &OneDrive{
+		OneDriveDescription: description.OneDriveDescription{
+			OneDriveName:      &name,
+			DriveVolumeMounts: driveVolumeMounts,
+		},
+		odc:       odc,
+		namespace: true,
+	}
+}
+
+// IsNamespace reports whether od is the virtual drive aggregating all drives
+func (od *OneDrive) IsNamespace() bool {
+	return od.namespace
+}
+
+// statNamespaceFolder returns the folder at path of the virtual drive, which
+// exists only if a volume mount lies below, the folders leading to deeper
+// volume mounts are its children
+func (od *OneDrive) statNamespaceFolder(path string) (*cache.MicrosoftGraphDriveItemCache, error) {
+	newPath := utils.RegularPath(path)
+	isFound := newPath == "/"
+	names := map[string]bool{}
+	children := []cache.MicrosoftGraphDriveItemCache{}
+	for _, driveVolumeMount := range od.OneDriveDescription.DriveVolumeMounts {
+		if driveVolumeMount.Target == nil {
+			continue
+		}
+		target := utils.RegularPath(*driveVolumeMount.Target)
+		if !IsSubPath(target, newPath) {
+			continue
+		}
+		isFound = true
+		if target == newPath || driveVolumeMount.GetType() == description.DriveVolumeMountHidden {
+			continue
+		}
+		// The volume mounts right inside are listed by addDriveVolumeMountChildren
+		name := strings.SplitN(strings.TrimPrefix(target[len(newPath):], "/"), "/", 2)[0]
+		if !names[name] {
+			names[name] = true
+			children = append(children, newNamespaceFolder(od, joinSubPath(newPath, name)))
+		}
+	}
+	if !isFound {
+		return nil, ErrNamespaceItemNotFound
+	}
+	microsoftGraphDriveItemCache := newNamespaceFolder(od, newPath)
+	microsoftGraphDriveItemCache.CacheDescription = &cache.CacheDescription{
+		Path:         od.OneDriveDescription.RelativePathToDriveRootPath(newPath),
+		LastUpdateAt: time.Now().Unix(),
+		Status:       "Cached",
+	}
+	microsoftGraphDriveItemCache.Folder.ChildCount = int32(len(children))
+	microsoftGraphDriveItemCache.Children = children
+	return &microsoftGraphDriveItemCache, nil
+}
+
+func newNamespaceFolder(od *OneDrive, path string) cache.MicrosoftGraphDriveItemCache {
+	parentPath, filename := utils.RegularPathToPathFilename(path)
+	return cache.MicrosoftGraphDriveItemCache{
+		Folder: &graphapi.MicrosoftGraphFolder{},
+		Name:   filename,
+		ParentReference: &graphapi.MicrosoftGraphItemReference{
+			Path: od.OneDriveDescription.RelativePathToDriveRootPath(parentPath),
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func newTestRootOneDrive(name string, children ...string) *OneDrive {
+	od := &OneDrive{OneDriveDescription: description.OneDriveDescription{OneDriveName: &name}}
+	root := cache.MicrosoftGraphDriveItemCache{
+		CacheDescription: &cache.CacheDescription{Path: "/drive/root:", LastUpdateAt: time.Now().Unix(), Status: "Cached"},
+		Folder:           &graphapi.MicrosoftGraphFolder{ChildCount: int32(len(children))},
+	}
+	for _, child := range children {
+		root.Children = append(root.Children, cache.MicrosoftGraphDriveItemCache{
+			Folder:          &graphapi.MicrosoftGraphFolder{},
+			Name:            child,
+			ParentReference: &graphapi.MicrosoftGraphItemReference{Path: "/drive/root:"},
+		})
+	}
+	od.DriveCacheCollection.MicrosoftGraphDriveItemCache = append(od.DriveCacheCollection.MicrosoftGraphDriveItemCache, root)
+	return od
+}
+
+func useTestChildrenNames(t *testing.T, od *OneDrive, path string) string {
+	driveItemCachePayload, err := od.GetMicrosoftGraphDriveItem(path)
+	if err != nil {
+		t.Fatalf("%s %s", path, err)
+	}
+	names := []string{}
+	for _, children := range driveItemCachePayload.Children {
+		names = append(names, children.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestNamespaceOneDrive(t *testing.T) {
+	media := newTestRootOneDrive("media", "a", "private", "shared")
+	media.OneDriveDescription.HiddenPaths = []string{"/private"}
+	media.OneDriveDescription.DriveVolumeMounts = []description.DriveVolumeMount{
+		newTestDriveVolumeMount("folder", "", "/a", "/tv"),
+	}
+	music := newTestRootOneDrive("music", "albums", "shared")
+	odc := testOneDriveCollection{media, music}
+	media.odc, music.odc = odc, odc
+	ns := NewNamespaceOneDrive("all", []description.DriveVolumeMount{
+		newTestDriveVolumeMount("folder", "media", "/", "/drives/media"),
+		newTestDriveVolumeMount("folder", "music", "/", "/drives/music"),
+		newTestDriveVolumeMount("folder", "music", "/", "/drives/media"),
+	}, odc)
+
+	if names := useTestChildrenNames(t, ns, "/"); names != "drives" {
+		t.Errorf("/ got %s", names)
+	}
+	if names := useTestChildrenNames(t, ns, "/drives"); names != "media,music" {
+		t.Errorf("/drives got %s", names)
+	}
+	// Hidden paths and volume mounts of media apply, music is overlaid
+	if names := useTestChildrenNames(t, ns, "/drives/media"); names != "a,albums,shared,tv" {
+		t.Errorf("/drives/media got %s", names)
+	}
+	sourceOneDrive, sourcePath, _, err := ns.ResolveDriveVolumeMount("/drives/media/tv/x.mkv")
+	if err != nil || sourceOneDrive != media || sourcePath != "/a/x.mkv" {
+		t.Errorf("got %v %s %v", sourceOneDrive == media, sourcePath, err)
+	}
+	hops, err := ns.ResolveDriveVolumeMountHops("/drives/media/private")
+	if err != nil || len(hops) != 2 || hops[1].OneDrive != media || hops[1].Path != "/private" || !media.IsHiddenPath(hops[1].Path) || !media.IsHiddenPath("/PRIVATE/a") {
+		t.Errorf("got %d hops %v", len(hops), err)
+	}
+	if _, err := ns.GetMicrosoftGraphDriveItem("/nothing"); err != ErrNamespaceItemNotFound {
+		t.Errorf("/nothing got %v", err)
+	}
+}
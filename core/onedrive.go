@@ -9,9 +9,11 @@ import (
 
 type oneDriveCollection interface { // import cycle
 	SaveConfigFile() error
+	UseOneDriveByOneDriveName(string) *OneDrive
 }
 
 func (od *OneDrive) Start(odc oneDriveCollection) error { // import cycle
+	od.odc = odc
 	if err := od.InitMicrosoftGraphAPI(); err != nil {
 		return err
 	}
@@ -27,18 +29,32 @@ func (od *OneDrive) Start(odc oneDriveCollection) error { // import cycle
 	if err := od.DriveCacheCollection.Load(od.OneDriveDescription.DriveDescription); err != nil {
 		return err
 	}
+	od.initQuota()
+	if err := od.InitDriveIndex(); err != nil {
+		log.Println("od.Start", err)
+	}
+	if err := od.InitActivityLog(); err != nil {
+		log.Println("od.Start", err)
+	}
 	go func() {
 		if err := od.CronCacheMicrosoftGraphDrive(); err != nil {
 			log.Println("od.Start", err)
 		} else {
-			od.DriveCacheCollection.Save(od.OneDriveDescription.DriveDescription)
+			od.SaveDriveCacheCollection()
+		}
+		if err := od.SyncActivityLog(); err != nil {
+			log.Println("od.Start", err)
 		}
 	}()
-	// go func() {
-	// 	if err := od.UploaderCollection.Init(&od.MicrosoftGraphAPI); err != nil {
-	// 		log.Println(err)
-	// 	}
-	// }()
+	if err := od.UploaderCollection.Init(od.OneDriveDescription.DriveDescription.ID); err != nil {
+		return err
+	}
+	go od.CleanUploaderCollection()
+	if err := od.InitContentCache(); err != nil {
+		log.Println("od.Start", err)
+	}
+	od.InitThumbnailCache()
+	od.InitSharingCache()
 	return nil
 }
 
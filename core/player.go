@@ -0,0 +1,200 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+var (
+	ErrPlayerItemNotFound = errors.New("PlayerItemNotFound")
+	ErrPlayerItemNotMedia = errors.New("PlayerItemNotMedia")
+	ErrSubtitleTooLarge   = errors.New("SubtitleTooLarge")
+)
+
+// SubtitleMaxSize bounds the subtitle files converted to WebVTT
+var SubtitleMaxSize = int64(4 << 20)
+
+// PlayerCoverNames are the base names of the cover images of a folder, an
+// image sharing the base name of the video is its cover as well
+var PlayerCoverNames = []string{"cover", "folder", "poster", "fanart", "thumb"}
+
+var (
+	playerSubtitleExtensions = []string{".srt", ".vtt"}
+	playerCoverExtensions    = []string{".jpg", ".jpeg", ".png", ".webp"}
+)
+
+// PlayerManifest describes how to play a video or audio file, URLs are
+// relative to the host
+type PlayerManifest struct {
+	Name         string           `json:"name"`
+	Path         string           `json:"path"`
+	StreamURL    string           `json:"streamUrl"`
+	MimeType     string           `json:"mimeType"`
+	Size         int64            `json:"size"`
+	Duration     float64          `json:"duration,omitempty"` // seconds
+	Bitrate      int64            `json:"bitrate,omitempty"`  // bits per second
+	Width        int32            `json:"width,omitempty"`
+	Height       int32            `json:"height,omitempty"`
+	ThumbnailURL string           `json:"thumbnailUrl"`
+	Subtitles    []PlayerSubtitle `json:"subtitles"`
+	Covers       []PlayerCover    `json:"covers"`
+}
+
+// PlayerSubtitle is a sibling subtitle file served as WebVTT
+type PlayerSubtitle struct {
+	Name     string `json:"name"`
+	Language string `json:"language,omitempty"`
+	URL      string `json:"url"`
+}
+
+// PlayerCover is a sibling cover image
+type PlayerCover struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// NewPlayerManifest returns the manifest of the file name in the listing of
+// the folder at the virtual path of drive, subtitles are the siblings named
+// like the file, optionally with a language, as in movie.en.srt
+func NewPlayerManifest(driveItemCachePayload *DriveItemCachePayload, drive, path, name string) (*PlayerManifest, error) {
+	path = utils.RegularPath(path)
+	var item *DriveItemCachePayload
+	for i := range driveItemCachePayload.Children {
+		if driveItemCachePayload.Children[i].Name == name && driveItemCachePayload.Children[i].File != nil {
+			item = &driveItemCachePayload.Children[i]
+			break
+		}
+	}
+	if item == nil {
+		return nil, ErrPlayerItemNotFound
+	}
+	mimeType := useFeedMimeType(item)
+	if item.Video == nil && item.Audio == nil && !strings.HasPrefix(mimeType, "video/") && !strings.HasPrefix(mimeType, "audio/") {
+		return nil, ErrPlayerItemNotMedia
+	}
+	itemPath := utils.RegularPath(path + "/" + name)
+	playerManifest := &PlayerManifest{
+		Name:         name,
+		Path:         itemPath,
+		StreamURL:    useDriveQueryURL("/onedrive/stream"+utils.EscapePath(itemPath), drive, nil),
+		MimeType:     mimeType,
+		Size:         item.Size,
+		ThumbnailURL: UseThumbnailURL(drive, itemPath, "large"),
+		Subtitles:    []PlayerSubtitle{},
+		Covers:       []PlayerCover{},
+	}
+	if item.Video != nil {
+		playerManifest.Duration = float64(item.Video.Duration) / 1000
+		playerManifest.Bitrate = int64(item.Video.Bitrate)
+		playerManifest.Width = item.Video.Width
+		playerManifest.Height = item.Video.Height
+	} else if item.Audio != nil {
+		playerManifest.Duration = float64(item.Audio.Duration) / 1000
+		playerManifest.Bitrate = item.Audio.Bitrate * 1000 // kbps
+	}
+
+	baseName := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	for _, child := range driveItemCachePayload.Children {
+		if child.File == nil || child.Name == name {
+			continue
+		}
+		childPath := utils.RegularPath(path + "/" + child.Name)
+		extension := strings.ToLower(filepath.Ext(child.Name))
+		childBaseName := strings.ToLower(strings.TrimSuffix(child.Name, filepath.Ext(child.Name)))
+		switch {
+		case isStringIn(extension, playerSubtitleExtensions):
+			if childBaseName != baseName && !strings.HasPrefix(childBaseName, baseName+".") {
+				continue
+			}
+			playerSubtitle := PlayerSubtitle{
+				Name: child.Name,
+				URL:  useDriveQueryURL("/api/onedrive/subtitle", drive, url.Values{"path": {childPath}}),
+			}
+			if childBaseName != baseName {
+				playerSubtitle.Language = childBaseName[len(baseName)+1:]
+			}
+			playerManifest.Subtitles = append(playerManifest.Subtitles, playerSubtitle)
+		case isStringIn(extension, playerCoverExtensions):
+			if childBaseName != baseName && !isStringIn(childBaseName, PlayerCoverNames) {
+				continue
+			}
+			playerManifest.Covers = append(playerManifest.Covers, PlayerCover{
+				Name: child.Name,
+				URL:  useDriveQueryURL("/onedrive/stream"+utils.EscapePath(childPath), drive, nil),
+			})
+		}
+	}
+	return playerManifest, nil
+}
+
+func isStringIn(str string, strs []string) bool {
+	for _, s := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// useDriveQueryURL appends the drive and the query to str
+func useDriveQueryURL(str, drive string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	if drive != "" {
+		query.Set("drive", drive)
+	}
+	if len(query) == 0 {
+		return str
+	}
+	return str + "?" + query.Encode()
+}
+
+// GetMicrosoftGraphDriveItemSubtitle returns the subtitles at path of the
+// drive itself as WebVTT
+func (od *OneDrive) GetMicrosoftGraphDriveItemSubtitle(path string) ([]byte, error) {
+	resp, _, err := od.GetMicrosoftGraphDriveItemContentResponse(path, http.Header{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("od.GetMicrosoftGraphDriveItemSubtitle UnexpectedStatus " + resp.Status)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, SubtitleMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > SubtitleMaxSize {
+		return nil, ErrSubtitleTooLarge
+	}
+	return ConvertSRTToWebVTT(content), nil
+}
+
+var srtTimestampRegexp = regexp.MustCompile(`(\d{1,2}:\d{2}:\d{2}),(\d{3})`)
+
+// ConvertSRTToWebVTT converts SubRip subtitles to WebVTT, WebVTT subtitles are
+// returned as they are
+func ConvertSRTToWebVTT(srt []byte) []byte {
+	srt = bytes.TrimPrefix(srt, []byte("\xef\xbb\xbf"))
+	if bytes.HasPrefix(srt, []byte("WEBVTT")) {
+		return srt
+	}
+	srt = bytes.Replace(srt, []byte("\r\n"), []byte("\n"), -1)
+	lines := bytes.Split(srt, []byte("\n"))
+	for i, line := range lines {
+		if bytes.Contains(line, []byte("-->")) {
+			lines[i] = srtTimestampRegexp.ReplaceAll(line, []byte("$1.$2"))
+		}
+	}
+	return append([]byte("WEBVTT\n\n"), bytes.Join(lines, []byte("\n"))...)
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestNewPlayerManifest(t *testing.T) {
+	driveItemCachePayload := &DriveItemCachePayload{
+		Name:   "movie",
+		Folder: &graphapi.MicrosoftGraphFolder{},
+		Children: []DriveItemCachePayload{
+			{Name: "Movie.mkv", File: &graphapi.MicrosoftGraphFile{}, Size: 10, Video: &graphapi.MicrosoftGraphVideo{Duration: 90500, Bitrate: 8000000, Width: 1920, Height: 1080}},
+			{Name: "Movie.srt", File: &graphapi.MicrosoftGraphFile{}},
+			{Name: "Movie.en.vtt", File: &graphapi.MicrosoftGraphFile{}},
+			{Name: "Movie 2.srt", File: &graphapi.MicrosoftGraphFile{}},
+			{Name: "poster.jpg", File: &graphapi.MicrosoftGraphFile{}},
+			{Name: "still.jpg", File: &graphapi.MicrosoftGraphFile{}},
+			{Name: "notes.txt", File: &graphapi.MicrosoftGraphFile{}},
+		},
+	}
+	playerManifest, err := NewPlayerManifest(driveItemCachePayload, "media", "/movies/movie", "Movie.mkv")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if playerManifest.StreamURL != "/onedrive/stream/movies/movie/Movie.mkv?drive=media" || playerManifest.MimeType != "video/x-matroska" {
+		t.Errorf("got %+v", playerManifest)
+	}
+	if playerManifest.Duration != 90.5 || playerManifest.Bitrate != 8000000 || playerManifest.Width != 1920 {
+		t.Errorf("got %+v", playerManifest)
+	}
+	if len(playerManifest.Subtitles) != 2 || playerManifest.Subtitles[0].Language != "" || playerManifest.Subtitles[1].Language != "en" {
+		t.Errorf("got %+v", playerManifest.Subtitles)
+	}
+	if playerManifest.Subtitles[0].URL != "/api/onedrive/subtitle?drive=media&path=%2Fmovies%2Fmovie%2FMovie.srt" {
+		t.Errorf("got %s", playerManifest.Subtitles[0].URL)
+	}
+	if len(playerManifest.Covers) != 1 || playerManifest.Covers[0].Name != "poster.jpg" {
+		t.Errorf("got %+v", playerManifest.Covers)
+	}
+
+	if _, err := NewPlayerManifest(driveItemCachePayload, "", "/movies/movie", "notes.txt"); err != ErrPlayerItemNotMedia {
+		t.Errorf("got %v", err)
+	}
+	if _, err := NewPlayerManifest(driveItemCachePayload, "", "/movies/movie", "missing.mkv"); err != ErrPlayerItemNotFound {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestConvertSRTToWebVTT(t *testing.T) {
+	srt := "\xef\xbb\xbf1\r\n00:00:01,500 --> 00:00:02,000\r\nHello, 00:00:03,000\r\n"
+	vtt := "WEBVTT\n\n1\n00:00:01.500 --> 00:00:02.000\nHello, 00:00:03,000\n"
+	if got := string(ConvertSRTToWebVTT([]byte(srt))); got != vtt {
+		t.Errorf("got %q", got)
+	}
+	if got := string(ConvertSRTToWebVTT([]byte(vtt))); got != vtt {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// ProxyRequestHeaders are forwarded from clients to the download URL
+var ProxyRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// ProxyResponseHeaders are passed through from the download URL to clients
+var ProxyResponseHeaders = []string{"Accept-Ranges", "Content-Length", "Content-Range", "Content-Type", "ETag", "Last-Modified"}
+
+// UseContentMode returns the content mode of path, redirect or proxy, where
+// the volume mount setting takes precedence over the drive setting, the
+// outermost setting of all drives path is resolved through wins
+func (od *OneDrive) UseContentMode(path string) string {
+	contentMode := od.OneDriveDescription.ContentMode
+	if hops, err := od.ResolveDriveVolumeMountHops(path); err == nil {
+		contentMode = useDriveVolumeMountHopsContentMode(hops)
+	}
+	if contentMode == "proxy" {
+		return "proxy"
+	}
+	return "redirect"
+}
+
+func useDriveVolumeMountHopsContentMode(hops []DriveVolumeMountHop) string {
+	for _, hop := range hops {
+		if hop.DriveVolumeMountRule.ContentMode != nil {
+			return *hop.DriveVolumeMountRule.ContentMode
+		}
+	}
+	for _, hop := range hops {
+		if hop.OneDrive.OneDriveDescription.ContentMode != "" {
+			return hop.OneDrive.OneDriveDescription.ContentMode
+		}
+	}
+	return ""
+}
+
+// GetMicrosoftGraphDriveItemContentResponse requests the content of the file at
+// path with the ProxyRequestHeaders of header, a missing, stale or expired
+// download URL is resolved again from Microsoft Graph transparently
+func (od *OneDrive) GetMicrosoftGraphDriveItemContentResponse(path string, header http.Header) (*http.Response, *DriveItemCachePayload, error) {
+	driveItemCachePayload, err := od.GetMicrosoftGraphAPIMeDriveContentURL(path)
+	if err == nil && driveItemCachePayload.DownloadURL != nil {
+		resp, err := requestMicrosoftGraphDownloadURL(*driveItemCachePayload.DownloadURL, header)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !isMicrosoftGraphDownloadURLExpired(resp.StatusCode) {
+			return od.verifyMicrosoftGraphDownloadResponse(resp, *driveItemCachePayload.DownloadURL, header, driveItemCachePayload.File), driveItemCachePayload, nil
+		}
+		resp.Body.Close()
+		log.Println("od.GetMicrosoftGraphDriveItemContentResponse DownloadURLExpired", path)
+	}
+	driveItemCachePayload, err = od.getMicrosoftGraphDriveItemContentURL(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := requestMicrosoftGraphDownloadURL(*driveItemCachePayload.DownloadURL, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	return od.verifyMicrosoftGraphDownloadResponse(resp, *driveItemCachePayload.DownloadURL, header, driveItemCachePayload.File), driveItemCachePayload, nil
+}
+
+// UseMicrosoftGraphDriveItemContentURL returns the download URL of the file
+// at path from the cache, or from Microsoft Graph if the cache misses or is
+// stale
+func (od *OneDrive) UseMicrosoftGraphDriveItemContentURL(path string) (*DriveItemCachePayload, error) {
+	driveItemCachePayload, err := od.GetMicrosoftGraphAPIMeDriveContentURL(path)
+	if err == nil && driveItemCachePayload.DownloadURL != nil {
+		return driveItemCachePayload, nil
+	}
+	return od.getMicrosoftGraphDriveItemContentURL(path)
+}
+
+// getMicrosoftGraphDriveItemContentURL requests the file at path from
+// Microsoft Graph for a fresh download URL and updates the cache
+func (od *OneDrive) getMicrosoftGraphDriveItemContentURL(path string) (*DriveItemCachePayload, error) {
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	microsoftGraphDriveItem, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveItem(&odd, odd.RelativePathToDriveRootPath(newPath))
+	if err != nil {
+		return nil, err
+	}
+	if microsoftGraphDriveItem.AtMicrosoftGraphDownloadURL == nil {
+		return nil, errors.New("od.getMicrosoftGraphDriveItemContentURL NoDownloadURL " + path)
+	}
+	od.patchMicrosoftGraphDriveItemCache(newPath, microsoftGraphDriveItem)
+	return &DriveItemCachePayload{
+		Description:    microsoftGraphDriveItem.Description,
+		File:           microsoftGraphDriveItem.File,
+		Size:           microsoftGraphDriveItem.Size,
+		CreatedAt:      microsoftGraphDriveItem.CreatedDateTime.UTC(),
+		LastModifiedAt: microsoftGraphDriveItem.LastModifiedDateTime.UTC(),
+		Name:           microsoftGraphDriveItem.Name,
+		DownloadURL:    microsoftGraphDriveItem.AtMicrosoftGraphDownloadURL,
+	}, nil
+}
+
+func requestMicrosoftGraphDownloadURL(downloadURL string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest("GET", downloadURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range ProxyRequestHeaders {
+		if value := header.Get(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	client := &http.Client{}
+	return client.Do(req)
+}
+
+func isMicrosoftGraphDownloadURLExpired(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden || statusCode == http.StatusNotFound || statusCode == http.StatusGone
+}
+
+// verifyMicrosoftGraphDownloadResponse verifies complete content only, the
+// hashes of partial content are unknown, a retry requests the download URL
+// again
+func (od *OneDrive) verifyMicrosoftGraphDownloadResponse(resp *http.Response, downloadURL string, header http.Header, file *graphapi.MicrosoftGraphFile) *http.Response {
+	if resp.StatusCode != http.StatusOK {
+		return resp
+	}
+	resp.Body = od.verifyMicrosoftGraphDownloadContent(resp.Body, file, func() (io.ReadCloser, error) {
+		resp, err := requestMicrosoftGraphDownloadURL(downloadURL, header)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, errors.New("od.verifyMicrosoftGraphDownloadResponse UnexpectedStatus " + resp.Status)
+		}
+		return resp.Body, nil
+	})
+	return resp
+}
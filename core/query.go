@@ -0,0 +1,369 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/index"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+var (
+	ErrQueryInvalid     = errors.New("QueryInvalid")
+	ErrQuerySortInvalid = errors.New("QuerySortInvalid")
+)
+
+// Query is a parsed query of the drive index, like
+// `ext:mkv size>1G modified>2026-01-01 path:/tv.shows`
+type Query struct {
+	Words     []string // terms of the name or the parent path, prefix matched
+	Phrases   []string // quoted or name: strings all contained in the name
+	PathTerms []string // terms of the parent path, exact matched
+	Filter    SearchFilter
+}
+
+// queryResult is an item of the drive index found at the virtual path
+type queryResult struct {
+	path  string
+	item  cache.MicrosoftGraphDriveItemCache
+	score int
+}
+
+// queryCursor is the sort key of the last result of a page, the next page
+// starts after it
+type queryCursor struct {
+	Sort  string `json:"o"`
+	Score int    `json:"s,omitempty"`
+	Name  string `json:"n,omitempty"`
+	Value int64  `json:"v,omitempty"`
+	Path  string `json:"p"`
+}
+
+// ParseQuery parses bare words, "quoted phrases" and the qualifiers name:,
+// ext:, type:, path:, size, modified and created, the last three compare
+// with :, =, >, >=, < or <=
+func ParseQuery(str string) (*Query, error) {
+	query := &Query{}
+	for _, token := range splitQuery(str) {
+		if strings.HasPrefix(token, "\"") {
+			if phrase := strings.Trim(token, "\""); phrase != "" {
+				query.Phrases = append(query.Phrases, strings.ToLower(phrase))
+			}
+			continue
+		}
+		key, operator, value := splitQueryToken(token)
+		var err error
+		switch key {
+		case "name":
+			if value = strings.Trim(value, "\""); value != "" {
+				query.Phrases = append(query.Phrases, strings.ToLower(value))
+			}
+		case "ext":
+			for _, extension := range strings.Split(value, ",") {
+				if extension != "" {
+					query.Filter.Extensions = append(query.Filter.Extensions, extension)
+				}
+			}
+		case "type":
+			if value != "file" && value != "folder" {
+				return nil, ErrQueryInvalid
+			}
+			query.Filter.Type = value
+		case "path":
+			value = strings.Trim(value, "\"")
+			if strings.HasPrefix(value, "/") {
+				query.Filter.Path = value
+			} else {
+				query.PathTerms = append(query.PathTerms, index.Terms(value)...)
+			}
+		case "size":
+			err = query.Filter.useQuerySize(operator, value)
+		case "modified":
+			err = useQueryTime(operator, value, &query.Filter.ModifiedAfter, &query.Filter.ModifiedBefore)
+		case "created":
+			err = useQueryTime(operator, value, &query.Filter.CreatedAfter, &query.Filter.CreatedBefore)
+		default:
+			query.Words = append(query.Words, index.Terms(token)...)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
+
+// splitQuery splits str at spaces outside of double quotes
+func splitQuery(str string) []string {
+	tokens := []string{}
+	isQuoted := false
+	token := strings.Builder{}
+	for _, r := range str {
+		if r == '"' {
+			isQuoted = !isQuoted
+		}
+		if unicode.IsSpace(r) && !isQuoted {
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+			continue
+		}
+		token.WriteRune(r)
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+// splitQueryToken splits a qualifier like size>=1G into its key, operator and
+// value, the key is empty for a bare word
+func splitQueryToken(token string) (string, string, string) {
+	i := strings.IndexAny(token, ":=<>")
+	if i <= 0 {
+		return "", "", token
+	}
+	operator := token[i : i+1]
+	if (operator == ">" || operator == "<") && strings.HasPrefix(token[i+1:], "=") {
+		operator += "="
+	}
+	return strings.ToLower(token[:i]), operator, token[i+len(operator):]
+}
+
+func (filter *SearchFilter) useQuerySize(operator, value string) error {
+	size, err := ParseSearchSize(value)
+	if err != nil {
+		return err
+	}
+	switch operator {
+	case ">":
+		filter.MinSize = size + 1
+	case ">=":
+		filter.MinSize = size
+	case "<":
+		filter.MaxSize, filter.HasMaxSize = size-1, true
+	case "<=":
+		filter.MaxSize, filter.HasMaxSize = size, true
+	default:
+		filter.MinSize, filter.MaxSize, filter.HasMaxSize = size, size, true
+	}
+	return nil
+}
+
+// useQueryTime sets the range of after, inclusive, and before, exclusive, a
+// date compares by days and a time by seconds
+func useQueryTime(operator, value string, after, before *time.Time) error {
+	t, err := ParseSearchTime(value)
+	if err != nil {
+		return err
+	}
+	next := t.Add(time.Second)
+	if !strings.Contains(value, "T") {
+		next = t.AddDate(0, 0, 1)
+	}
+	switch operator {
+	case ">":
+		*after = next
+	case ">=":
+		*after = t
+	case "<":
+		*before = t
+	case "<=":
+		*before = next
+	default:
+		*after, *before = t, next
+	}
+	return nil
+}
+
+// QueryDriveIndex queries the indexes of the drives behind the virtual drive,
+// sortBy is relevance, name, size, modified, created or path and order is
+// asc or desc, by default names and paths ascend and the others descend
+func (od *OneDrive) QueryDriveIndex(str, sortBy, order string, top int, cursor string) (*SearchPayload, error) {
+	query, err := ParseQuery(str)
+	if err != nil {
+		return nil, err
+	}
+	if sortBy == "" {
+		sortBy = "relevance"
+	}
+	switch sortBy {
+	case "relevance", "size", "modified", "created":
+		if order == "" {
+			order = "desc"
+		}
+	case "name", "path":
+		if order == "" {
+			order = "asc"
+		}
+	default:
+		return nil, ErrQuerySortInvalid
+	}
+	if order != "asc" && order != "desc" {
+		return nil, ErrQuerySortInvalid
+	}
+	sortOrder := sortBy + " " + order
+	var currentCursor *queryCursor
+	if cursor != "" {
+		bytes, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, ErrSearchCursorInvalid
+		}
+		currentCursor = &queryCursor{}
+		if err := json.Unmarshal(bytes, currentCursor); err != nil || currentCursor.Sort != sortOrder {
+			return nil, ErrSearchCursorInvalid
+		}
+	}
+
+	queryResults := od.useQueryResults(query)
+	queryCursors := make([]queryCursor, len(queryResults))
+	for i := range queryResults {
+		queryCursors[i] = queryResults[i].useQueryCursor(sortBy, sortOrder)
+	}
+	isDesc := order == "desc"
+	sort.Sort(queryResultSorter{queryResults, queryCursors, isDesc})
+	offset := 0
+	if currentCursor != nil {
+		offset = sort.Search(len(queryCursors), func(i int) bool {
+			return isQueryCursorLess(currentCursor, &queryCursors[i], isDesc)
+		})
+	}
+	searchPayload := &SearchPayload{Value: []DriveItemCachePayload{}}
+	end := offset + useSearchTop(top)
+	if end < len(queryResults) {
+		bytes, err := json.Marshal(queryCursors[end-1])
+		if err != nil {
+			return nil, err
+		}
+		searchPayload.NextCursor = base64.RawURLEncoding.EncodeToString(bytes)
+	} else {
+		end = len(queryResults)
+	}
+	for _, result := range queryResults[offset:end] {
+		searchPayload.Value = append(searchPayload.Value, od.searchResultToPayload(result.path, &result.item))
+	}
+	return searchPayload, nil
+}
+
+// useQueryResults matches the query against the indexes of the drives behind
+// the virtual drive, an item found twice at a virtual path is kept once
+func (od *OneDrive) useQueryResults(query *Query) []queryResult {
+	queryResults := []queryResult{}
+	isFound := map[string]bool{}
+	nameWords := append([]string{}, query.Words...)
+	for _, phrase := range query.Phrases {
+		nameWords = append(nameWords, strings.Fields(phrase)...)
+	}
+	for _, source := range od.useSearchSources(query.Filter.Path) {
+		if source.od.DriveIndex == nil {
+			continue
+		}
+		odd := source.od.OneDriveDescription
+		for _, indexItem := range source.od.DriveIndex.Match(query.Words, query.PathTerms) {
+			if !IsSubPath(indexItem.Path, source.path) || !isQueryPhrasesMatched(indexItem.Name, query.Phrases) {
+				continue
+			}
+			item := newQueryDriveItemCache(&indexItem, odd.RelativePathToDriveRootPath(utils.RegularPath(parentPathOf(indexItem.Path))))
+			score, _ := useSearchScore(item.Name, nameWords)
+			for _, path := range od.UseDriveVolumeMountVirtualPaths(source.od, indexItem.Path) {
+				if !isFound[path] && query.Filter.isMatched(path, &item) {
+					isFound[path] = true
+					queryResults = append(queryResults, queryResult{path, item, score})
+				}
+			}
+		}
+	}
+	return queryResults
+}
+
+func parentPathOf(path string) string {
+	parentPath, _ := utils.RegularPathToPathFilename(path)
+	return parentPath
+}
+
+func isQueryPhrasesMatched(name string, phrases []string) bool {
+	lowerName := strings.ToLower(name)
+	for _, phrase := range phrases {
+		if !strings.Contains(lowerName, phrase) {
+			return false
+		}
+	}
+	return true
+}
+
+// newQueryDriveItemCache returns the cached item the indexed item stands for
+func newQueryDriveItemCache(indexItem *index.Item, parentPath string) cache.MicrosoftGraphDriveItemCache {
+	item := cache.MicrosoftGraphDriveItemCache{
+		Size:            indexItem.Size,
+		CreatedAt:       indexItem.CreatedAt,
+		LastModifiedAt:  indexItem.LastModifiedAt,
+		Name:            indexItem.Name,
+		ParentReference: &graphapi.MicrosoftGraphItemReference{Path: parentPath},
+	}
+	if indexItem.IsFolder {
+		item.Folder = &graphapi.MicrosoftGraphFolder{}
+	} else {
+		item.File = &graphapi.MicrosoftGraphFile{}
+	}
+	return item
+}
+
+func (result *queryResult) useQueryCursor(sortBy, sortOrder string) queryCursor {
+	currentCursor := queryCursor{Sort: sortOrder, Path: result.path}
+	switch sortBy {
+	case "relevance":
+		currentCursor.Score = result.score
+	case "name":
+		currentCursor.Name = strings.ToLower(result.item.Name)
+	case "size":
+		currentCursor.Value = result.item.Size
+	case "modified":
+		currentCursor.Value = result.item.LastModifiedAt
+	case "created":
+		currentCursor.Value = result.item.CreatedAt
+	}
+	return currentCursor
+}
+
+// isQueryCursorLess reports whether a sorts before b, the sort key is in the
+// order asked for and the paths break ties in ascending order
+func isQueryCursorLess(a, b *queryCursor, isDesc bool) bool {
+	if a.Score != b.Score {
+		return (a.Score < b.Score) != isDesc
+	}
+	if a.Name != b.Name {
+		return (a.Name < b.Name) != isDesc
+	}
+	if a.Value != b.Value {
+		return (a.Value < b.Value) != isDesc
+	}
+	if strings.HasPrefix(a.Sort, "path ") {
+		return a.Path != b.Path && (a.Path < b.Path) != isDesc
+	}
+	return a.Path < b.Path
+}
+
+// queryResultSorter sorts the results and their sort keys together
+type queryResultSorter struct {
+	queryResults []queryResult
+	queryCursors []queryCursor
+	isDesc       bool
+}
+
+func (sorter queryResultSorter) Len() int { return len(sorter.queryResults) }
+
+func (sorter queryResultSorter) Less(i, j int) bool {
+	return isQueryCursorLess(&sorter.queryCursors[i], &sorter.queryCursors[j], sorter.isDesc)
+}
+
+func (sorter queryResultSorter) Swap(i, j int) {
+	sorter.queryResults[i], sorter.queryResults[j] = sorter.queryResults[j], sorter.queryResults[i]
+	sorter.queryCursors[i], sorter.queryCursors[j] = sorter.queryCursors[j], sorter.queryCursors[i]
+}
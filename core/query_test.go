@@ -0,0 +1,110 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/index"
+)
+
+func TestParseQuery(t *testing.T) {
+	query, err := ParseQuery(`ext:mkv,mp4 size>1G modified>=2026-01-01 path:/tv.shows "the office" season`)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if len(query.Filter.Extensions) != 2 || query.Filter.MinSize != 1<<30+1 || !query.Filter.ModifiedAfter.Equal(day) || query.Filter.Path != "/tv.shows" {
+		t.Errorf("got %+v", query.Filter)
+	}
+	if len(query.Phrases) != 1 || query.Phrases[0] != "the office" || len(query.Words) != 1 || query.Words[0] != "season" {
+		t.Errorf("got %v %v", query.Phrases, query.Words)
+	}
+	query, err = ParseQuery("created<=2026-01-01 path:shows")
+	if err != nil || !query.Filter.CreatedBefore.Equal(day.AddDate(0, 0, 1)) || len(query.PathTerms) != 1 {
+		t.Errorf("got %+v %v", query, err)
+	}
+	if _, err := ParseQuery("size>big"); err != ErrSearchSizeInvalid {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestQueryDriveIndex(t *testing.T) {
+	od := newTestRootOneDrive("media", "shows")
+	od.OneDriveDescription.DriveVolumeMounts = []description.DriveVolumeMount{
+		newTestDriveVolumeMount("folder", "", "/shows", "/tv"),
+	}
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	root := &od.DriveCacheCollection.MicrosoftGraphDriveItemCache[0]
+	root.Children = append(root.Children,
+		newTestFile("/drive/root:", "Movie.mkv", 2<<30, day),
+		newTestFile("/drive/root:", "notes.txt", 1<<10, day),
+	)
+	od.DriveCacheCollection.MicrosoftGraphDriveItemCache = append(od.DriveCacheCollection.MicrosoftGraphDriveItemCache, cache.MicrosoftGraphDriveItemCache{
+		CacheDescription: &cache.CacheDescription{Path: "/drive/root:/shows", LastUpdateAt: time.Now().Unix(), Status: "Cached"},
+		Children: []cache.MicrosoftGraphDriveItemCache{
+			newTestFile("/drive/root:/shows", "show.s01e01.mkv", 1<<30, day),
+			newTestFile("/drive/root:/shows", "show.s01e02.mkv", 3<<29, day.AddDate(0, 0, 7)),
+		},
+	})
+	od.DriveIndex = index.NewIndex()
+	for i := range od.DriveCacheCollection.MicrosoftGraphDriveItemCache {
+		od.updateDriveIndex(&od.DriveCacheCollection.MicrosoftGraphDriveItemCache[i])
+	}
+
+	tests := []struct {
+		query, sortBy, order string
+		paths                []string
+	}{
+		{"ext:mkv", "size", "", []string{"/Movie.mkv", "/shows/show.s01e02.mkv", "/tv/show.s01e02.mkv", "/shows/show.s01e01.mkv", "/tv/show.s01e01.mkv"}},
+		{"ext:mkv path:/tv modified>2026-01-01", "", "", []string{"/tv/show.s01e02.mkv"}},
+		// Path terms match the folders of the drive the item is stored in
+		{"show path:shows", "path", "desc", []string{"/tv/show.s01e02.mkv", "/tv/show.s01e01.mkv", "/shows/show.s01e02.mkv", "/shows/show.s01e01.mkv"}},
+		{`"s01e01"`, "name", "", []string{"/shows/show.s01e01.mkv", "/tv/show.s01e01.mkv"}},
+		// No file is empty
+		{"type:file size:0", "", "", []string{}},
+		{"ext:txt size<=1K", "", "", []string{"/notes.txt"}},
+	}
+	for _, test := range tests {
+		searchPayload, err := od.QueryDriveIndex(test.query, test.sortBy, test.order, 0, "")
+		if err != nil {
+			t.Fatalf("%s %s", test.query, err)
+		}
+		paths := []string{}
+		for _, value := range searchPayload.Value {
+			paths = append(paths, *value.DownloadURL)
+		}
+		if len(paths) != len(test.paths) {
+			t.Errorf("%s got %v", test.query, paths)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != test.paths[i] {
+				t.Errorf("%s got %v", test.query, paths)
+				break
+			}
+		}
+	}
+
+	paths := []string{}
+	cursor := ""
+	for {
+		searchPayload, err := od.QueryDriveIndex("ext:mkv", "size", "asc", 2, cursor)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		for _, value := range searchPayload.Value {
+			paths = append(paths, *value.DownloadURL)
+		}
+		if cursor = searchPayload.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if len(paths) != 5 || paths[0] != "/shows/show.s01e01.mkv" || paths[4] != "/Movie.mkv" {
+		t.Errorf("got %v", paths)
+	}
+	if _, err := od.QueryDriveIndex("ext:mkv", "name", "", 2, cursor+"x"); err != ErrSearchCursorInvalid {
+		t.Errorf("got %v", err)
+	}
+}
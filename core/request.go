@@ -1,7 +1,6 @@
 package core
 
 import (
-	"errors"
 	"log"
 	"time"
 
@@ -11,86 +10,109 @@ import (
 	"github.com/AirWSW/onedrive/graphapi"
 )
 
+// GetMicrosoftGraphDriveItem returns the item at the virtual path, which is
+// resolved through the volume mounts, the volume mounts inside a folder are
+// listed as its children
 func (od *OneDrive) GetMicrosoftGraphDriveItem(path string) (*DriveItemCachePayload, error) {
 	newPath := utils.RegularPath(path)
-	newPathLength := len(newPath)
-	parentPath, filename := utils.RegularPathToPathFilename(newPath)
 	if newPath == "/drive/root:" {
 		newPath = "/drive/root"
-		parentPath, filename = "/drive/root", ""
-	}
-	driveVolumeMountRule := &description.DriveVolumeMount{}
-	for _, driveVolumeMount := range od.OneDriveDescription.DriveVolumeMounts {
-		target := utils.RegularPath(*driveVolumeMount.Target)
-		targetLength := len(target)
-		if newPathLength >= targetLength && newPath[0:targetLength] == target {
-			newPath = utils.RegularPath(*driveVolumeMount.Source) + newPath[targetLength:newPathLength]
-			driveVolumeMountRule = &driveVolumeMount
-			continue
-		}
-	}
-
-	microsoftGraphDriveItemCache, err := od.DriveCacheCollection.HitMicrosoftGraphDriveItemCache(&od.OneDriveDescription, newPath)
-	if err != nil {
-		go func() {
-			if err := od.CronCacheMicrosoftGraphDrive(); err != nil {
-				log.Println("od.GetMicrosoftGraphDriveItem", err)
-			} else {
-				od.DriveCacheCollection.Save(od.OneDriveDescription.DriveDescription)
-			}
-		}()
-		if microsoftGraphDriveItemCache == nil {
-			return nil, err
-		}
 	}
-	driveItemCachePayload, err := od.DriveItemCacheToPayLoad(microsoftGraphDriveItemCache)
+	hops, err := od.ResolveDriveVolumeMountHops(newPath)
 	if err != nil {
 		return nil, err
 	}
+	driveVolumeMountRule := useDriveVolumeMountHopsRule(hops)
+	if driveVolumeMountRule.GetType() == description.DriveVolumeMountRedirect {
+		return nil, ErrDriveVolumeMountRedirect
+	}
+	sourceOneDrive, sourcePath := hops[len(hops)-1].SourceOneDrive, hops[len(hops)-1].SourcePath
 
-	if newPath != utils.RegularPath(path) {
-		if driveVolumeMountRule.Type != nil {
-			if *driveVolumeMountRule.Type == "file.only" && driveItemCachePayload.File == nil {
-				return nil, errors.New("file.only")
-			}
+	var microsoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache
+	if sourceOneDrive.IsNamespace() {
+		microsoftGraphDriveItemCache, err = sourceOneDrive.statNamespaceFolder(sourcePath)
+		if err != nil {
+			return nil, err
 		}
-		driveItemCachePayload.Reference.Path = utils.RegularPath(parentPath)
-		driveItemCachePayload.Name = filename
-		innerDriveItemCachePayload := []DriveItemCachePayload{}
-		newDriveItemCachePayload := DriveItemCachePayload{}
-		for _, children := range driveItemCachePayload.Children {
-			innerDownloadURL := utils.RegularPath(od.OneDriveDescription.DriveRootPathToRelativePath(microsoftGraphDriveItemCache.ParentReference.Path) + "/" + children.Name)
-			innerDownloadURLPointer := &innerDownloadURL
-			if children.Folder != nil {
-				innerDownloadURLPointer = nil
+	} else {
+		microsoftGraphDriveItemCache, err = sourceOneDrive.DriveCacheCollection.HitMicrosoftGraphDriveItemCache(&sourceOneDrive.OneDriveDescription, sourcePath)
+		sourceOneDrive.countCacheLookup("driveitem", err == nil)
+		if err != nil {
+			go func() {
+				if err := sourceOneDrive.CronCacheMicrosoftGraphDrive(); err != nil {
+					log.Println("od.GetMicrosoftGraphDriveItem", err)
+				} else {
+					sourceOneDrive.SaveDriveCacheCollection()
+				}
+			}()
+			if microsoftGraphDriveItemCache == nil {
+				return nil, err
 			}
-			newDriveItemCachePayload = DriveItemCachePayload{
-				Description:    children.Description,
-				File:           children.File,
-				Folder:         children.Folder,
-				Size:           children.Size,
-				CreatedAt:      children.CreatedAt,
-				LastModifiedAt: children.LastModifiedAt,
-				Name:           children.Name,
-				DownloadURL:    innerDownloadURLPointer,
-			}
-			innerDriveItemCachePayload = append(innerDriveItemCachePayload, newDriveItemCachePayload)
 		}
 	}
-	return driveItemCachePayload, nil
+	if driveVolumeMountRule.GetType() == description.DriveVolumeMountFileOnly && microsoftGraphDriveItemCache.File == nil {
+		return nil, ErrDriveVolumeMountFileOnly
+	}
+	if microsoftGraphDriveItemCache.Folder != nil {
+		newMicrosoftGraphDriveItemCache := *microsoftGraphDriveItemCache
+		children := microsoftGraphDriveItemCache.Children
+		// The items deleted since the folder was cached are NOT listed
+		if !sourceOneDrive.IsNamespace() {
+			children = sourceOneDrive.DriveCacheCollection.FilterTombstones(children)
+		}
+		if driveVolumeMountRule.Target != nil {
+			children = sourceOneDrive.filterHiddenChildren(sourcePath, children)
+		}
+		newMicrosoftGraphDriveItemCache.Children = useDriveVolumeMountHopsChildren(hops, children)
+		microsoftGraphDriveItemCache = &newMicrosoftGraphDriveItemCache
+	}
+	if driveVolumeMountRule.Target == nil {
+		return od.DriveItemCacheToPayLoad(microsoftGraphDriveItemCache)
+	}
+	return od.virtualDriveItemCacheToPayLoad(newPath, microsoftGraphDriveItemCache), nil
 }
 
+// virtualDriveItemCacheToPayLoad returns the payload of the volume mount
+// source at the virtual path, so references and download URLs stay inside
+// the volume mount, the children are filtered already
+func (od *OneDrive) virtualDriveItemCacheToPayLoad(path string, microsoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache) *DriveItemCachePayload {
+	parentPath, filename := utils.RegularPathToPathFilename(path)
+	relativePath := path
+	if microsoftGraphDriveItemCache.Folder == nil {
+		relativePath = utils.RegularPath(parentPath)
+	}
+	driveItemCachePayload := od.newDriveItemCachePayload(microsoftGraphDriveItemCache, relativePath, microsoftGraphDriveItemCache.Children)
+	driveItemCachePayload.Name = filename
+	if path == "/" && od.OneDriveDescription.OneDriveName != nil {
+		driveItemCachePayload.Name = *od.OneDriveDescription.OneDriveName
+	}
+	if driveItemCachePayload.Folder == nil {
+		downloadURL := path
+		driveItemCachePayload.DownloadURL = &downloadURL
+	}
+	return driveItemCachePayload
+}
+
+// ForceGetMicrosoftGraphDriveItem marks the cache of the item at the virtual
+// path and its parent to be refreshed on the source drive
 func (od *OneDrive) ForceGetMicrosoftGraphDriveItem(path, force string) error {
-	odd := od.OneDriveDescription
-	newPath := utils.RegularPath(path)
+	sourceOneDrive, sourcePath, _, err := od.ResolveDriveVolumeMount(path)
+	if err != nil {
+		return err
+	}
+	if sourceOneDrive.IsNamespace() {
+		return nil
+	}
+	odd := sourceOneDrive.OneDriveDescription
+	newPath := utils.RegularPath(sourcePath)
 	parentPath, _ := utils.RegularPathToPathFilename(newPath)
 	newPath = odd.RelativePathToDriveRootPath(newPath)
 	parentPath = odd.RelativePathToDriveRootPath(parentPath)
-	for i, microsoftGraphDriveItemCache := range od.DriveCacheCollection.MicrosoftGraphDriveItemCache {
+	for i, microsoftGraphDriveItemCache := range sourceOneDrive.DriveCacheCollection.MicrosoftGraphDriveItemCache {
 		if microsoftGraphDriveItemCache.CacheDescription.Path == newPath {
-			od.DriveCacheCollection.MicrosoftGraphDriveItemCache[i].CacheDescription.Status = "Force"
+			sourceOneDrive.DriveCacheCollection.MicrosoftGraphDriveItemCache[i].CacheDescription.Status = "Force"
 		} else if microsoftGraphDriveItemCache.CacheDescription.Path == parentPath {
-			od.DriveCacheCollection.MicrosoftGraphDriveItemCache[i].CacheDescription.Status = "Force"
+			sourceOneDrive.DriveCacheCollection.MicrosoftGraphDriveItemCache[i].CacheDescription.Status = "Force"
 		}
 	}
 	// go func() {
@@ -105,7 +127,6 @@ func (od *OneDrive) ForceGetMicrosoftGraphDriveItem(path, force string) error {
 
 func (od *OneDrive) DriveItemCacheToPayLoad(microsoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache) (*DriveItemCachePayload, error) {
 	oneDriveDescription := od.OneDriveDescription
-	driveItemCachePayloadReference := &DriveItemCachePayloadReference{}
 	parentReference := &graphapi.MicrosoftGraphItemReference{}
 	relativePath := ""
 	if microsoftGraphDriveItemCache.Children != nil && len(microsoftGraphDriveItemCache.Children) > 0 {
@@ -121,15 +142,30 @@ func (od *OneDrive) DriveItemCacheToPayLoad(microsoftGraphDriveItemCache *cache.
 		parentReference = microsoftGraphDriveItemCache.ParentReference
 		relativePath = oneDriveDescription.DriveRootPathToRelativePath(parentReference.Path)
 	}
-	driveItemCachePayloadReference = &DriveItemCachePayloadReference{
-		LastUpdateAt: time.Unix(microsoftGraphDriveItemCache.CacheDescription.LastUpdateAt, 0).UTC(),
-		DriveType:    parentReference.DriveType,
-		Path:         relativePath,
+	return od.newDriveItemCachePayload(microsoftGraphDriveItemCache, relativePath, od.filterHiddenChildren(relativePath, microsoftGraphDriveItemCache.Children)), nil
+}
+
+// newDriveItemCachePayload returns the payload of the item inside the folder
+// at relativePath with children, a folder is at relativePath itself
+func (od *OneDrive) newDriveItemCachePayload(microsoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache, relativePath string, children []cache.MicrosoftGraphDriveItemCache) *DriveItemCachePayload {
+	oneDriveDescription := od.OneDriveDescription
+	driveType := ""
+	if len(children) > 0 && children[0].ParentReference != nil {
+		driveType = children[0].ParentReference.DriveType
+	} else if microsoftGraphDriveItemCache.ParentReference != nil {
+		driveType = microsoftGraphDriveItemCache.ParentReference.DriveType
+	}
+	driveItemCachePayloadReference := &DriveItemCachePayloadReference{
+		DriveType: driveType,
+		Path:      relativePath,
+	}
+	if microsoftGraphDriveItemCache.CacheDescription != nil {
+		driveItemCachePayloadReference.LastUpdateAt = time.Unix(microsoftGraphDriveItemCache.CacheDescription.LastUpdateAt, 0).UTC()
 	}
 
 	innerDriveItemCachePayload := []DriveItemCachePayload{}
 	newDriveItemCachePayload := DriveItemCachePayload{}
-	for _, children := range microsoftGraphDriveItemCache.Children {
+	for _, children := range children {
 		innerDownloadURL := utils.RegularPath(relativePath + "/" + children.Name)
 		innerDownloadURLPointer := &innerDownloadURL
 		if children.Folder != nil {
@@ -144,6 +180,11 @@ func (od *OneDrive) DriveItemCacheToPayLoad(microsoftGraphDriveItemCache *cache.
 			LastModifiedAt: time.Unix(children.LastModifiedAt, 0).UTC(),
 			Name:           children.Name,
 			DownloadURL:    innerDownloadURLPointer,
+			Image:          children.Image,
+			Photo:          children.Photo,
+			Video:          children.Video,
+			Audio:          children.Audio,
+			Location:       children.Location,
 		}
 		innerDriveItemCachePayload = append(innerDriveItemCachePayload, newDriveItemCachePayload)
 	}
@@ -170,12 +211,18 @@ func (od *OneDrive) DriveItemCacheToPayLoad(microsoftGraphDriveItemCache *cache.
 		Name:           name,
 		Reference:      driveItemCachePayloadReference,
 		DownloadURL:    downloadURLPointer,
+		Image:          microsoftGraphDriveItemCache.Image,
+		Photo:          microsoftGraphDriveItemCache.Photo,
+		Video:          microsoftGraphDriveItemCache.Video,
+		Audio:          microsoftGraphDriveItemCache.Audio,
+		Location:       microsoftGraphDriveItemCache.Location,
 	}
-	return &driveItemCachePayload, nil
+	return &driveItemCachePayload
 }
 
 func (od *OneDrive) GetMicrosoftGraphAPIMeDriveContentURL(path string) (*DriveItemCachePayload, error) {
 	microsoftGraphDriveItemCache, err := od.DriveCacheCollection.HitMicrosoftGraphDriveContentURLCache(&od.OneDriveDescription, path)
+	od.countCacheLookup("contenturl", err == nil)
 	if err != nil {
 		go func() {
 			if err := od.CronCacheMicrosoftGraphDrive(); err != nil {
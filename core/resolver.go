@@ -1 +1,409 @@
 package core
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+var (
+	ErrDriveVolumeMountDriveNotFound = errors.New("DriveVolumeMountDriveNotFound")
+	ErrDriveVolumeMountFileOnly      = errors.New("DriveVolumeMountFileOnly")
+	ErrDriveVolumeMountLoop          = errors.New("DriveVolumeMountLoop")
+	ErrDriveVolumeMountRedirect      = errors.New("DriveVolumeMountRedirect")
+)
+
+// driveVolumeMountSource is the source of a virtual path in a drive
+type driveVolumeMountSource struct {
+	od                   *OneDrive
+	path                 string
+	driveVolumeMountRule *description.DriveVolumeMount
+}
+
+// UseDriveVolumeMount maps the target path of the longest matching volume
+// mount to its source path and returns the matched volume mount rule, the
+// source path may lie in another drive, see ResolveDriveVolumeMount
+func (od *OneDrive) UseDriveVolumeMount(path string) (string, *description.DriveVolumeMount) {
+	newPath := utils.RegularPath(path)
+	driveVolumeMountRules, matchLength := od.useDriveVolumeMounts(newPath)
+	if len(driveVolumeMountRules) == 0 {
+		return newPath, &description.DriveVolumeMount{}
+	}
+	return useDriveVolumeMountSourcePath(newPath, matchLength, driveVolumeMountRules[0]), driveVolumeMountRules[0]
+}
+
+// useDriveVolumeMounts returns the volume mounts of the longest target
+// matching path, volume mounts sharing the same target overlay each other
+func (od *OneDrive) useDriveVolumeMounts(path string) ([]*description.DriveVolumeMount, int) {
+	driveVolumeMountRules := []*description.DriveVolumeMount{}
+	matchLength := -1
+	for i, driveVolumeMount := range od.OneDriveDescription.DriveVolumeMounts {
+		if driveVolumeMount.Target == nil || driveVolumeMount.Source == nil {
+			continue
+		}
+		target := utils.RegularPath(*driveVolumeMount.Target)
+		if len(target) < matchLength || !IsSubPath(path, target) {
+			continue
+		}
+		if len(target) > matchLength {
+			driveVolumeMountRules = driveVolumeMountRules[:0]
+			matchLength = len(target)
+		}
+		driveVolumeMountRules = append(driveVolumeMountRules, &od.OneDriveDescription.DriveVolumeMounts[i])
+	}
+	return driveVolumeMountRules, matchLength
+}
+
+func useDriveVolumeMountSourcePath(path string, matchLength int, driveVolumeMountRule *description.DriveVolumeMount) string {
+	if driveVolumeMountRule.GetType() == description.DriveVolumeMountRedirect {
+		return path
+	}
+	return joinSubPath(utils.RegularPath(*driveVolumeMountRule.Source), path[matchLength:])
+}
+
+// DriveVolumeMountHop is a drive passed while resolving a virtual path, a
+// drive mounted into another drive is seen through its own volume mounts
+type DriveVolumeMountHop struct {
+	OneDrive             *OneDrive
+	Path                 string
+	SourceOneDrive       *OneDrive
+	SourcePath           string
+	DriveVolumeMountRule *description.DriveVolumeMount
+}
+
+// driveVolumeMountMaxHops limits the drives a virtual path is resolved through
+const driveVolumeMountMaxHops = 8
+
+// ResolveDriveVolumeMountHops resolves path drive by drive until a drive maps
+// it into itself or a redirect volume mount matches, the source of the last
+// hop is the source of path
+func (od *OneDrive) ResolveDriveVolumeMountHops(path string) ([]DriveVolumeMountHop, error) {
+	hops := []DriveVolumeMountHop{}
+	hopOneDrive, hopPath := od, utils.RegularPath(path)
+	for len(hops) < driveVolumeMountMaxHops {
+		sourceOneDrive, sourcePath, driveVolumeMountRule, err := hopOneDrive.resolveDriveVolumeMount(hopPath)
+		if err != nil {
+			return nil, err
+		}
+		hops = append(hops, DriveVolumeMountHop{hopOneDrive, hopPath, sourceOneDrive, sourcePath, driveVolumeMountRule})
+		if sourceOneDrive == hopOneDrive || driveVolumeMountRule.GetType() == description.DriveVolumeMountRedirect {
+			return hops, nil
+		}
+		hopOneDrive, hopPath = sourceOneDrive, sourcePath
+	}
+	return nil, ErrDriveVolumeMountLoop
+}
+
+// ResolveDriveVolumeMount maps path through the volume mounts and returns the
+// drive holding the source path, which is od itself unless the volume mount
+// names another drive, see ResolveDriveVolumeMountHops
+func (od *OneDrive) ResolveDriveVolumeMount(path string) (*OneDrive, string, *description.DriveVolumeMount, error) {
+	hops, err := od.ResolveDriveVolumeMountHops(path)
+	if err != nil {
+		return nil, "", &description.DriveVolumeMount{}, err
+	}
+	hop := hops[len(hops)-1]
+	return hop.SourceOneDrive, hop.SourcePath, useDriveVolumeMountHopsRule(hops), nil
+}
+
+// useDriveVolumeMountHopsRule returns the volume mount rule in effect for all
+// hops, a volume mount refusing writes wins over any other and a plain folder
+// volume mount loses to any other
+func useDriveVolumeMountHopsRule(hops []DriveVolumeMountHop) *description.DriveVolumeMount {
+	var driveVolumeMountRule *description.DriveVolumeMount
+	for _, hop := range hops {
+		hopRule := hop.DriveVolumeMountRule
+		if hopRule.Target == nil {
+			continue
+		}
+		if !hopRule.IsWritable() {
+			return hopRule
+		}
+		if driveVolumeMountRule == nil || isPlainDriveVolumeMount(driveVolumeMountRule) && !isPlainDriveVolumeMount(hopRule) {
+			driveVolumeMountRule = hopRule
+		}
+	}
+	if driveVolumeMountRule == nil {
+		return hops[0].DriveVolumeMountRule
+	}
+	return driveVolumeMountRule
+}
+
+func isPlainDriveVolumeMount(driveVolumeMountRule *description.DriveVolumeMount) bool {
+	return driveVolumeMountRule.GetType() == description.DriveVolumeMountFolder && driveVolumeMountRule.Password == nil && driveVolumeMountRule.ContentMode == nil
+}
+
+// useDriveVolumeMountHopsChildren layers the volume mounts of each hop over
+// the children of the source folder, from the innermost hop outwards
+func useDriveVolumeMountHopsChildren(hops []DriveVolumeMountHop, children []cache.MicrosoftGraphDriveItemCache) []cache.MicrosoftGraphDriveItemCache {
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := hops[i]
+		children = hop.OneDrive.addDriveVolumeMountOverlayChildren(hop.Path, hop.SourceOneDrive, hop.SourcePath, children)
+		if hop.DriveVolumeMountRule.Target != nil {
+			children = hop.OneDrive.filterHiddenChildren(hop.Path, children)
+		}
+		children = hop.OneDrive.addDriveVolumeMountChildren(hop.Path, children)
+	}
+	return children
+}
+
+// resolveDriveVolumeMount maps path through the volume mounts of od only, the
+// first overlaid source caching the item wins and the first source is written
+// to otherwise
+func (od *OneDrive) resolveDriveVolumeMount(path string) (*OneDrive, string, *description.DriveVolumeMount, error) {
+	driveVolumeMountSources, err := od.resolveDriveVolumeMounts(path)
+	if err != nil {
+		return nil, "", &description.DriveVolumeMount{}, err
+	}
+	if len(driveVolumeMountSources) > 1 {
+		for _, source := range driveVolumeMountSources {
+			if source.od.IsNamespace() {
+				continue
+			}
+			if microsoftGraphDriveItemCache, _ := source.od.DriveCacheCollection.HitMicrosoftGraphDriveItemCache(&source.od.OneDriveDescription, source.path); microsoftGraphDriveItemCache != nil {
+				return source.od, source.path, source.driveVolumeMountRule, nil
+			}
+		}
+	}
+	source := driveVolumeMountSources[0]
+	return source.od, source.path, source.driveVolumeMountRule, nil
+}
+
+// resolveDriveVolumeMounts returns all overlaid sources of path, unknown
+// drives are skipped unless no source is left
+func (od *OneDrive) resolveDriveVolumeMounts(path string) ([]driveVolumeMountSource, error) {
+	newPath := utils.RegularPath(path)
+	driveVolumeMountRules, matchLength := od.useDriveVolumeMounts(newPath)
+	if len(driveVolumeMountRules) == 0 {
+		return []driveVolumeMountSource{{od, newPath, &description.DriveVolumeMount{}}}, nil
+	}
+	driveVolumeMountSources := []driveVolumeMountSource{}
+	for _, driveVolumeMountRule := range driveVolumeMountRules {
+		sourceOneDrive := od.useDriveVolumeMountOneDrive(driveVolumeMountRule)
+		if sourceOneDrive == nil {
+			continue
+		}
+		sourcePath := useDriveVolumeMountSourcePath(newPath, matchLength, driveVolumeMountRule)
+		driveVolumeMountSources = append(driveVolumeMountSources, driveVolumeMountSource{sourceOneDrive, sourcePath, driveVolumeMountRule})
+	}
+	if len(driveVolumeMountSources) == 0 {
+		return nil, ErrDriveVolumeMountDriveNotFound
+	}
+	return driveVolumeMountSources, nil
+}
+
+func (od *OneDrive) useDriveVolumeMountOneDrive(driveVolumeMountRule *description.DriveVolumeMount) *OneDrive {
+	if driveVolumeMountRule.Drive == nil || *driveVolumeMountRule.Drive == "" {
+		return od
+	}
+	if od.OneDriveDescription.OneDriveName != nil && *od.OneDriveDescription.OneDriveName == *driveVolumeMountRule.Drive {
+		return od
+	}
+	if od.odc == nil {
+		return nil
+	}
+	return od.odc.UseOneDriveByOneDriveName(*driveVolumeMountRule.Drive)
+}
+
+// addDriveVolumeMountOverlayChildren merges the children of all folders
+// overlaid at path into children of the winning source, the first child of
+// a name wins
+func (od *OneDrive) addDriveVolumeMountOverlayChildren(path string, sourceOneDrive *OneDrive, sourcePath string, children []cache.MicrosoftGraphDriveItemCache) []cache.MicrosoftGraphDriveItemCache {
+	driveVolumeMountSources, err := od.resolveDriveVolumeMounts(path)
+	if err != nil || len(driveVolumeMountSources) < 2 {
+		return children
+	}
+	names := map[string]bool{}
+	for _, child := range children {
+		names[child.Name] = true
+	}
+	newChildren := append([]cache.MicrosoftGraphDriveItemCache{}, children...)
+	for _, source := range driveVolumeMountSources {
+		if source.od.IsNamespace() || source.od == sourceOneDrive && source.path == sourcePath {
+			continue
+		}
+		microsoftGraphDriveItemCache, _ := source.od.DriveCacheCollection.HitMicrosoftGraphDriveItemCache(&source.od.OneDriveDescription, source.path)
+		if microsoftGraphDriveItemCache == nil || microsoftGraphDriveItemCache.Folder == nil {
+			continue
+		}
+		for _, child := range source.od.filterHiddenChildren(source.path, microsoftGraphDriveItemCache.Children) {
+			if !names[child.Name] {
+				newChildren = append(newChildren, child)
+				names[child.Name] = true
+			}
+		}
+	}
+	return newChildren
+}
+
+// UseDriveVolumeMountRedirectURL returns the URL the path of a redirect volume
+// mount redirects to, the subpath below the target is appended to the source
+func (od *OneDrive) UseDriveVolumeMountRedirectURL(path string) (string, bool) {
+	hops, err := od.ResolveDriveVolumeMountHops(path)
+	if err != nil {
+		return "", false
+	}
+	hop := hops[len(hops)-1]
+	driveVolumeMountRule := hop.DriveVolumeMountRule
+	if driveVolumeMountRule.GetType() != description.DriveVolumeMountRedirect || driveVolumeMountRule.Source == nil {
+		return "", false
+	}
+	target := utils.RegularPath(*driveVolumeMountRule.Target)
+	subPath := ""
+	if IsSubPath(hop.Path, target) {
+		subPath = strings.TrimPrefix(hop.Path[len(strings.TrimSuffix(target, "/")):], "/")
+	}
+	if subPath == "" {
+		return *driveVolumeMountRule.Source, true
+	}
+	return strings.TrimSuffix(*driveVolumeMountRule.Source, "/") + (&url.URL{Path: "/" + strings.TrimPrefix(subPath, "/")}).EscapedPath(), true
+}
+
+// addDriveVolumeMountChildren lists the volume mounts directly inside the
+// folder at path as its children, hidden volume mounts excluded, a volume
+// mount shadows the child of the same name
+func (od *OneDrive) addDriveVolumeMountChildren(path string, children []cache.MicrosoftGraphDriveItemCache) []cache.MicrosoftGraphDriveItemCache {
+	newPath := utils.RegularPath(path)
+	newChildren := []cache.MicrosoftGraphDriveItemCache{}
+	names := map[string]bool{}
+	for i := range od.OneDriveDescription.DriveVolumeMounts {
+		driveVolumeMount := &od.OneDriveDescription.DriveVolumeMounts[i]
+		if driveVolumeMount.Target == nil || driveVolumeMount.GetType() == description.DriveVolumeMountHidden {
+			continue
+		}
+		parentPath, filename := utils.RegularPathToPathFilename(utils.RegularPath(*driveVolumeMount.Target))
+		if filename == "" || names[filename] || utils.RegularPath(parentPath) != newPath {
+			continue
+		}
+		if microsoftGraphDriveItemCache, ok := od.statDriveVolumeMountSource(driveVolumeMount); ok {
+			microsoftGraphDriveItemCache.Name = filename
+			microsoftGraphDriveItemCache.ParentReference = &graphapi.MicrosoftGraphItemReference{
+				Path: od.OneDriveDescription.RelativePathToDriveRootPath(newPath),
+			}
+			newChildren = append(newChildren, *microsoftGraphDriveItemCache)
+			names[filename] = true
+		}
+	}
+	if len(newChildren) == 0 {
+		return children
+	}
+	for _, child := range children {
+		if !names[child.Name] {
+			newChildren = append(newChildren, child)
+		}
+	}
+	return newChildren
+}
+
+// statDriveVolumeMountSource returns the cached source of a volume mount, an
+// uncached source is listed as a folder until cached
+func (od *OneDrive) statDriveVolumeMountSource(driveVolumeMountRule *description.DriveVolumeMount) (*cache.MicrosoftGraphDriveItemCache, bool) {
+	if driveVolumeMountRule.GetType() == description.DriveVolumeMountRedirect {
+		return &cache.MicrosoftGraphDriveItemCache{File: &graphapi.MicrosoftGraphFile{}}, true
+	}
+	sourceOneDrive, sourcePath, _, err := od.ResolveDriveVolumeMount(*driveVolumeMountRule.Target)
+	if err != nil {
+		return nil, false
+	}
+	if sourceOneDrive.IsNamespace() {
+		return &cache.MicrosoftGraphDriveItemCache{Folder: &graphapi.MicrosoftGraphFolder{}}, true
+	}
+	microsoftGraphDriveItemCache, err := sourceOneDrive.DriveCacheCollection.HitMicrosoftGraphDriveItemCache(&sourceOneDrive.OneDriveDescription, sourcePath)
+	if err != nil || microsoftGraphDriveItemCache == nil {
+		if driveVolumeMountRule.GetType() == description.DriveVolumeMountFileOnly {
+			return nil, false
+		}
+		return &cache.MicrosoftGraphDriveItemCache{Folder: &graphapi.MicrosoftGraphFolder{}}, true
+	}
+	if driveVolumeMountRule.GetType() == description.DriveVolumeMountFileOnly && microsoftGraphDriveItemCache.Folder != nil {
+		return nil, false
+	}
+	newMicrosoftGraphDriveItemCache := *microsoftGraphDriveItemCache
+	newMicrosoftGraphDriveItemCache.Children = nil
+	return &newMicrosoftGraphDriveItemCache, true
+}
+
+// UseDriveVolumeMountVirtualPaths returns the virtual paths of od resolving
+// to sourcePath of sourceOneDrive, the reverse of ResolveDriveVolumeMount, a
+// source path shadowed by a volume mount has no virtual path
+func (od *OneDrive) UseDriveVolumeMountVirtualPaths(sourceOneDrive *OneDrive, sourcePath string) []string {
+	return od.useDriveVolumeMountVirtualPaths(sourceOneDrive, utils.RegularPath(sourcePath), 0)
+}
+
+func (od *OneDrive) useDriveVolumeMountVirtualPaths(sourceOneDrive *OneDrive, sourcePath string, depth int) []string {
+	if depth >= driveVolumeMountMaxHops {
+		return nil
+	}
+	paths := []string{}
+	if od == sourceOneDrive {
+		paths = append(paths, sourcePath)
+	}
+	for i := range od.OneDriveDescription.DriveVolumeMounts {
+		driveVolumeMount := &od.OneDriveDescription.DriveVolumeMounts[i]
+		if driveVolumeMount.Target == nil || driveVolumeMount.Source == nil || driveVolumeMount.GetType() == description.DriveVolumeMountRedirect {
+			continue
+		}
+		mountOneDrive := od.useDriveVolumeMountOneDrive(driveVolumeMount)
+		if mountOneDrive == nil {
+			continue
+		}
+		// The source of a volume mount inside od is NOT resolved again
+		mountPaths := []string{}
+		if mountOneDrive == od && od == sourceOneDrive {
+			mountPaths = append(mountPaths, sourcePath)
+		} else if mountOneDrive != od {
+			mountPaths = mountOneDrive.useDriveVolumeMountVirtualPaths(sourceOneDrive, sourcePath, depth+1)
+		}
+		source, target := utils.RegularPath(*driveVolumeMount.Source), utils.RegularPath(*driveVolumeMount.Target)
+		for _, mountPath := range mountPaths {
+			if !IsSubPath(mountPath, source) {
+				continue
+			}
+			subPath := ""
+			if source != "/" {
+				subPath = mountPath[len(source):]
+			} else if mountPath != source {
+				subPath = mountPath
+			}
+			paths = append(paths, joinSubPath(target, subPath))
+		}
+	}
+	virtualPaths := []string{}
+	isFound := map[string]bool{}
+	for _, path := range paths {
+		if isFound[path] {
+			continue
+		}
+		isFound[path] = true
+		resolvedOneDrive, resolvedPath, driveVolumeMountRule, err := od.ResolveDriveVolumeMount(path)
+		if err != nil || resolvedOneDrive != sourceOneDrive || resolvedPath != sourcePath || driveVolumeMountRule.GetType() == description.DriveVolumeMountRedirect {
+			continue
+		}
+		virtualPaths = append(virtualPaths, path)
+	}
+	return virtualPaths
+}
+
+// IsSubPath reports whether path is or lies below parentPath, both regular,
+// ignoring case as Microsoft Graph does, path[len(parentPath):] is the subpath
+func IsSubPath(path, parentPath string) bool {
+	if parentPath == "/" {
+		return true
+	}
+	if len(path) < len(parentPath) || !strings.EqualFold(path[:len(parentPath)], parentPath) {
+		return false
+	}
+	return len(path) == len(parentPath) || path[len(parentPath)] == '/'
+}
+
+func joinSubPath(path, subPath string) string {
+	if subPath == "" {
+		return path
+	}
+	return strings.TrimSuffix(path, "/") + "/" + strings.TrimPrefix(subPath, "/")
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/AirWSW/onedrive/core/description"
+)
+
+type testOneDriveCollection []*OneDrive
+
+func (odc testOneDriveCollection) SaveConfigFile() error { return nil }
+
+func (odc testOneDriveCollection) UseOneDriveByOneDriveName(str string) *OneDrive {
+	for _, od := range odc {
+		if *od.OneDriveDescription.OneDriveName == str {
+			return od
+		}
+	}
+	return nil
+}
+
+func newTestDriveVolumeMount(mountType, drive, source, target string) description.DriveVolumeMount {
+	return description.DriveVolumeMount{Type: &mountType, Drive: &drive, Source: &source, Target: &target}
+}
+
+func TestResolveDriveVolumeMount(t *testing.T) {
+	media, music := "media", "music"
+	od := &OneDrive{OneDriveDescription: description.OneDriveDescription{
+		OneDriveName: &media,
+		DriveVolumeMounts: []description.DriveVolumeMount{
+			newTestDriveVolumeMount("folder", "", "/a", "/tv"),
+			newTestDriveVolumeMount("readonly", "", "/b", "/tv/shows"),
+			newTestDriveVolumeMount("folder", "music", "/albums", "/music"),
+			newTestDriveVolumeMount("redirect", "", "https://example.com/docs/", "/docs"),
+		},
+	}}
+	other := &OneDrive{OneDriveDescription: description.OneDriveDescription{OneDriveName: &music}}
+	od.odc = testOneDriveCollection{od, other}
+	tests := []struct {
+		path, sourcePath string
+		sourceOneDrive   *OneDrive
+		writable         bool
+	}{
+		{"/tv", "/a", od, true},
+		{"/tv/x.mkv", "/a/x.mkv", od, true},
+		{"/tv/shows/s01", "/b/s01", od, false},
+		{"/tv.shows", "/tv.shows", od, true},
+		// Microsoft Graph ignores case, so do the volume mounts
+		{"/TV/Shows/s01", "/b/s01", od, false},
+		{"/music/x.flac", "/albums/x.flac", other, true},
+	}
+	for _, test := range tests {
+		sourceOneDrive, sourcePath, driveVolumeMountRule, err := od.ResolveDriveVolumeMount(test.path)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if sourceOneDrive != test.sourceOneDrive || sourcePath != test.sourcePath || driveVolumeMountRule.IsWritable() != test.writable {
+			t.Errorf("%s got %s %s %v", test.path, *sourceOneDrive.OneDriveDescription.OneDriveName, sourcePath, driveVolumeMountRule.IsWritable())
+		}
+	}
+	if redirectURL, ok := od.UseDriveVolumeMountRedirectURL("/docs/a b.pdf"); !ok || redirectURL != "https://example.com/docs/a%20b.pdf" {
+		t.Errorf("got %s %v", redirectURL, ok)
+	}
+	if redirectURL, ok := od.UseDriveVolumeMountRedirectURL("/Docs/a b.pdf"); !ok || redirectURL != "https://example.com/docs/a%20b.pdf" {
+		t.Errorf("got %s %v", redirectURL, ok)
+	}
+	if _, ok := od.UseDriveVolumeMountRedirectURL("/tv/x.mkv"); ok {
+		t.Errorf("got redirect for folder volume mount")
+	}
+}
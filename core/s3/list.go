@@ -0,0 +1,124 @@
+package s3
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+)
+
+// ErrDelimiterNotImplemented is returned for delimiters other than the slash
+var ErrDelimiterNotImplemented = errors.New("DelimiterNotImplemented")
+
+// Object is a key or, with IsPrefix, a common prefix of a listing
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+	IsPrefix     bool
+}
+
+// ListChildren returns the children of the folder at the relative path
+type ListChildren func(path string) ([]cache.MicrosoftGraphDriveItemCache, error)
+
+type objectLister struct {
+	list       ListChildren
+	prefix     string
+	delimiter  string
+	startAfter string
+	maxKeys    int
+	objects    []Object
+	truncated  bool
+}
+
+var errListFull = errors.New("ListFull")
+
+// ListObjects lists the keys below prefix in lexicographic order after
+// startAfter, with the slash delimiter folders are rolled up to common
+// prefixes, the result is truncated after maxKeys objects
+func ListObjects(list ListChildren, prefix, delimiter, startAfter string, maxKeys int) ([]Object, bool, error) {
+	if delimiter != "" && delimiter != "/" {
+		return nil, false, ErrDelimiterNotImplemented
+	}
+	ol := &objectLister{
+		list:       list,
+		prefix:     prefix,
+		delimiter:  delimiter,
+		startAfter: startAfter,
+		maxKeys:    maxKeys,
+		objects:    []Object{},
+	}
+	folder := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		folder = prefix[:i+1]
+	}
+	if err := ol.walk(folder); err != nil && err != errListFull {
+		return nil, false, err
+	}
+	return ol.objects, ol.truncated, nil
+}
+
+func (ol *objectLister) walk(folder string) error {
+	children, err := ol.list("/" + strings.TrimSuffix(folder, "/"))
+	if err != nil {
+		return err
+	}
+	sorted := make([]cache.MicrosoftGraphDriveItemCache, len(children))
+	copy(sorted, children)
+	// Folders sort by their key prefix so the walk yields lexicographic keys
+	sortKey := func(children cache.MicrosoftGraphDriveItemCache) string {
+		if children.Folder != nil {
+			return children.Name + "/"
+		}
+		return children.Name
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sortKey(sorted[i]) < sortKey(sorted[j])
+	})
+	for _, children := range sorted {
+		key := folder + sortKey(children)
+		if !strings.HasPrefix(key, ol.prefix) && !strings.HasPrefix(ol.prefix, key) {
+			continue
+		}
+		if children.Folder == nil {
+			if err := ol.add(Object{
+				Key:          key,
+				Size:         children.Size,
+				LastModified: time.Unix(children.LastModifiedAt, 0).UTC(),
+				ETag:         children.ETag,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if ol.delimiter != "" && strings.HasPrefix(key, ol.prefix) {
+			if err := ol.add(Object{Key: key, IsPrefix: true}); err != nil {
+				return err
+			}
+			continue
+		}
+		// The whole subtree sorts before startAfter
+		if ol.startAfter >= key && !strings.HasPrefix(ol.startAfter, key) {
+			continue
+		}
+		if err := ol.walk(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ol *objectLister) add(object Object) error {
+	if object.Key <= ol.startAfter {
+		return nil
+	}
+	if len(ol.objects) >= ol.maxKeys {
+		ol.truncated = true
+		return errListFull
+	}
+	ol.objects = append(ol.objects, object)
+	return nil
+}
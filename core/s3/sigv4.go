@@ -0,0 +1,222 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureV4Algorithm is the only supported signing algorithm
+const SignatureV4Algorithm = "AWS4-HMAC-SHA256"
+
+// UnsignedPayload is the payload hash of requests without a signed body
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// SignatureV4MaxSkew is the allowed clock skew of signed requests
+var SignatureV4MaxSkew = 15 * time.Minute
+
+var (
+	ErrSignatureV4Missing      = errors.New("SignatureV4Missing")
+	ErrSignatureV4Malformed    = errors.New("SignatureV4Malformed")
+	ErrSignatureV4AccessKey    = errors.New("SignatureV4InvalidAccessKeyId")
+	ErrSignatureV4Expired      = errors.New("SignatureV4RequestTimeTooSkewed")
+	ErrSignatureV4DoesNotMatch = errors.New("SignatureV4DoesNotMatch")
+)
+
+// SecretAccessKeyLookup returns the secret of an access key id
+type SecretAccessKeyLookup func(accessKeyID string) (string, bool)
+
+type signatureV4 struct {
+	accessKeyID   string
+	date          string // yyyymmdd
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       string
+	payloadHash   string
+	presigned     bool
+	expires       time.Duration
+}
+
+// VerifySignatureV4 checks the Authorization header or the presigned query of
+// r and returns the access key id which signed it
+func VerifySignatureV4(r *http.Request, lookup SecretAccessKeyLookup, now time.Time) (string, error) {
+	sig, err := parseSignatureV4(r)
+	if err != nil {
+		return "", err
+	}
+	secretAccessKey, ok := lookup(sig.accessKeyID)
+	if !ok {
+		return "", ErrSignatureV4AccessKey
+	}
+	signedAt, err := time.Parse("20060102T150405Z", sig.amzDate)
+	if err != nil || !strings.HasPrefix(sig.amzDate, sig.date) {
+		return "", ErrSignatureV4Malformed
+	}
+	if sig.presigned {
+		if now.Before(signedAt.Add(-SignatureV4MaxSkew)) || now.After(signedAt.Add(sig.expires)) {
+			return "", ErrSignatureV4Expired
+		}
+	} else if now.Sub(signedAt) > SignatureV4MaxSkew || signedAt.Sub(now) > SignatureV4MaxSkew {
+		return "", ErrSignatureV4Expired
+	}
+	scope := sig.date + "/" + sig.region + "/" + sig.service + "/aws4_request"
+	canonicalRequest := useCanonicalRequest(r, sig)
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := SignatureV4Algorithm + "\n" + sig.amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+	signingKey := hmacSHA256([]byte("AWS4"+secretAccessKey), sig.date)
+	signingKey = hmacSHA256(signingKey, sig.region)
+	signingKey = hmacSHA256(signingKey, sig.service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(sig.signature)) != 1 {
+		return "", ErrSignatureV4DoesNotMatch
+	}
+	return sig.accessKeyID, nil
+}
+
+// UsePayloadHash returns the signed payload hash of r, which is either
+// UnsignedPayload or the hex encoded SHA-256 of the body
+func UsePayloadHash(r *http.Request) string {
+	if r.URL.Query().Get("X-Amz-Signature") != "" {
+		return UnsignedPayload
+	}
+	if payloadHash := r.Header.Get("X-Amz-Content-Sha256"); payloadHash != "" {
+		return payloadHash
+	}
+	return UnsignedPayload
+}
+
+func parseSignatureV4(r *http.Request) (*signatureV4, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Signature") != "" {
+		if query.Get("X-Amz-Algorithm") != SignatureV4Algorithm {
+			return nil, ErrSignatureV4Malformed
+		}
+		sig, err := parseSignatureV4Credential(query.Get("X-Amz-Credential"))
+		if err != nil {
+			return nil, err
+		}
+		expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+		if err != nil || expires < 0 || expires > 604800 {
+			return nil, ErrSignatureV4Malformed
+		}
+		sig.signedHeaders = strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+		sig.signature = query.Get("X-Amz-Signature")
+		sig.amzDate = query.Get("X-Amz-Date")
+		sig.payloadHash = UnsignedPayload
+		sig.presigned = true
+		sig.expires = time.Duration(expires) * time.Second
+		return sig, nil
+	}
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return nil, ErrSignatureV4Missing
+	}
+	if !strings.HasPrefix(authorization, SignatureV4Algorithm+" ") {
+		return nil, ErrSignatureV4Malformed
+	}
+	fields := map[string]string{}
+	for _, field := range strings.Split(authorization[len(SignatureV4Algorithm)+1:], ",") {
+		keyValue := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(keyValue) != 2 {
+			return nil, ErrSignatureV4Malformed
+		}
+		fields[keyValue[0]] = keyValue[1]
+	}
+	sig, err := parseSignatureV4Credential(fields["Credential"])
+	if err != nil {
+		return nil, err
+	}
+	if fields["SignedHeaders"] == "" || fields["Signature"] == "" {
+		return nil, ErrSignatureV4Malformed
+	}
+	sig.signedHeaders = strings.Split(fields["SignedHeaders"], ";")
+	sig.signature = fields["Signature"]
+	sig.amzDate = r.Header.Get("X-Amz-Date")
+	sig.payloadHash = UsePayloadHash(r)
+	return sig, nil
+}
+
+func parseSignatureV4Credential(credential string) (*signatureV4, error) {
+	credentials := strings.Split(credential, "/")
+	if len(credentials) != 5 || credentials[4] != "aws4_request" {
+		return nil, ErrSignatureV4Malformed
+	}
+	return &signatureV4{
+		accessKeyID: credentials[0],
+		date:        credentials[1],
+		region:      credentials[2],
+		service:     credentials[3],
+	}, nil
+}
+
+func useCanonicalRequest(r *http.Request, sig *signatureV4) string {
+	query := r.URL.Query()
+	if sig.presigned {
+		query.Del("X-Amz-Signature")
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	canonicalQuery := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			canonicalQuery = append(canonicalQuery, URIEncode(key, true)+"="+URIEncode(value, true))
+		}
+	}
+	canonicalHeaders := ""
+	for _, header := range sig.signedHeaders {
+		value := r.Header.Get(header)
+		if header == "host" {
+			value = r.Host
+		}
+		canonicalHeaders += header + ":" + strings.Join(strings.Fields(value), " ") + "\n"
+	}
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	return r.Method + "\n" +
+		URIEncode(path, false) + "\n" +
+		strings.Join(canonicalQuery, "&") + "\n" +
+		canonicalHeaders + "\n" +
+		strings.Join(sig.signedHeaders, ";") + "\n" +
+		sig.payloadHash
+}
+
+// URIEncode encodes all bytes except the unreserved characters, the slash is
+// kept unless encodeSlash
+func URIEncode(str string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var builder strings.Builder
+	for i := 0; i < len(str); i++ {
+		b := str[i]
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			builder.WriteByte(b)
+			continue
+		}
+		builder.WriteByte('%')
+		builder.WriteByte(hexDigits[b>>4])
+		builder.WriteByte(hexDigits[b&15])
+	}
+	return builder.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
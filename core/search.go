@@ -0,0 +1,527 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+var (
+	ErrSearchQueryEmpty      = errors.New("SearchQueryEmpty")
+	ErrSearchCursorInvalid   = errors.New("SearchCursorInvalid")
+	ErrSearchSizeInvalid     = errors.New("SearchSizeInvalid")
+	ErrSearchTimeInvalid     = errors.New("SearchTimeInvalid")
+	ErrSearchDurationInvalid = errors.New("SearchDurationInvalid")
+)
+
+// SearchDefaultTop and SearchMaxTop are the default and the maximum count of
+// results per page
+var (
+	SearchDefaultTop = 50
+	SearchMaxTop     = 1000
+)
+
+// SearchFilter narrows the results of a search, zero values do NOT filter
+type SearchFilter struct {
+	Name           string   // words all contained in the name, case-insensitive
+	Extensions     []string // without the leading dot, case-insensitive
+	Type           string   // file, folder
+	MinSize        int64
+	MaxSize        int64 // only if HasMaxSize, as zero is a maximum as well
+	HasMaxSize     bool
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	Path           string // virtual folder the results lie below
+
+	// The rich metadata of the drives with it cached
+	Media       string // image, photo, video, audio, location
+	TakenAfter  time.Time
+	TakenBefore time.Time
+	MinDuration time.Duration // of videos and audio
+	MaxDuration time.Duration
+}
+
+// SearchPayload is a page of search results, the next page is requested by
+// the NextCursor until it is empty
+type SearchPayload struct {
+	Value      []DriveItemCachePayload `json:"value"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
+}
+
+// searchSource is a drive searched for the virtual drive and the folder the
+// search is limited to
+type searchSource struct {
+	od   *OneDrive
+	path string
+}
+
+// searchResult is an item found at the virtual path
+type searchResult struct {
+	path  string
+	item  cache.MicrosoftGraphDriveItemCache
+	score int
+}
+
+// searchCursor is the source drive and the next link of the next page of a
+// search by Microsoft Graph
+type searchCursor struct {
+	Source   int    `json:"s"`
+	NextLink string `json:"n,omitempty"`
+}
+
+// SearchMicrosoftGraphDriveItem searches the drives behind the virtual drive
+// for query by Microsoft Graph, the results are ranked by Microsoft Graph and
+// mapped to the virtual paths, a page may hold less than top results as the
+// filter applies afterwards
+func (od *OneDrive) SearchMicrosoftGraphDriveItem(query string, filter *SearchFilter, top int, cursor string) (*SearchPayload, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, ErrSearchQueryEmpty
+	}
+	currentCursor := searchCursor{}
+	if cursor != "" {
+		bytes, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, ErrSearchCursorInvalid
+		}
+		if err := json.Unmarshal(bytes, &currentCursor); err != nil {
+			return nil, ErrSearchCursorInvalid
+		}
+	}
+	searchSources := od.useSearchSources(filter.Path)
+	if currentCursor.Source < 0 || currentCursor.Source >= len(searchSources) {
+		return nil, ErrSearchCursorInvalid
+	}
+	source := searchSources[currentCursor.Source]
+	odd := source.od.OneDriveDescription
+	str := odd.RelativePathToDriveRootPath(source.path)
+	if currentCursor.NextLink != "" {
+		// The cursor comes from the client, the next link must NOT take the
+		// access token anywhere but Microsoft Graph
+		if !source.od.MicrosoftGraphAPI.MicrosoftEndPoints.IsMicrosoftGraphAPIEndPointURL(currentCursor.NextLink) {
+			return nil, ErrSearchCursorInvalid
+		}
+		str = currentCursor.NextLink
+	}
+	microsoftGraphDriveItemCollection, err := source.od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveSearch(&odd, str, query, useSearchTop(top))
+	if err != nil {
+		return nil, err
+	}
+	searchPayload := &SearchPayload{Value: []DriveItemCachePayload{}}
+	parentPaths := map[string]string{}
+	for _, value := range microsoftGraphDriveItemCollection.Value {
+		sourcePath, ok := source.od.useSearchSourcePath(&value, parentPaths)
+		if !ok {
+			continue
+		}
+		item := cache.MicrosoftGraphDriveItemCache{
+			CTag:                        value.CTag,
+			Description:                 value.Description,
+			File:                        value.File,
+			Folder:                      value.Folder,
+			Size:                        value.Size,
+			ID:                          value.ID,
+			CreatedAt:                   value.CreatedDateTime.Unix(),
+			ETag:                        value.ETag,
+			LastModifiedAt:              value.LastModifiedDateTime.Unix(),
+			Name:                        value.Name,
+			ParentReference:             value.ParentReference,
+			WebURL:                      value.WebURL,
+			AtMicrosoftGraphDownloadURL: value.AtMicrosoftGraphDownloadURL,
+		}
+		if odd.RichMetadata {
+			item.SetRichMetadata(&value)
+		}
+		for _, path := range od.UseDriveVolumeMountVirtualPaths(source.od, sourcePath) {
+			if !filter.isMatched(path, &item) {
+				continue
+			}
+			driveItemCachePayload := od.searchResultToPayload(path, &item)
+			driveItemCachePayload.SearchResult = value.SearchResult
+			searchPayload.Value = append(searchPayload.Value, driveItemCachePayload)
+		}
+	}
+	if microsoftGraphDriveItemCollection.AtODataNextLink != nil {
+		currentCursor.NextLink = *microsoftGraphDriveItemCollection.AtODataNextLink
+	} else {
+		currentCursor = searchCursor{Source: currentCursor.Source + 1}
+	}
+	if currentCursor.Source < len(searchSources) {
+		bytes, err := json.Marshal(currentCursor)
+		if err != nil {
+			return nil, err
+		}
+		searchPayload.NextCursor = base64.RawURLEncoding.EncodeToString(bytes)
+	}
+	return searchPayload, nil
+}
+
+// SearchDriveCacheCollection searches the cached items of the drives behind
+// the virtual drive without requesting Microsoft Graph, the results are ranked
+// by how well the name matches, the latest modified first otherwise
+func (od *OneDrive) SearchDriveCacheCollection(filter *SearchFilter, top int, cursor string) (*SearchPayload, error) {
+	offset := 0
+	if cursor != "" {
+		n, err := strconv.Atoi(cursor)
+		if err != nil || n < 0 {
+			return nil, ErrSearchCursorInvalid
+		}
+		offset = n
+	}
+	searchResults := []searchResult{}
+	words := strings.Fields(strings.ToLower(filter.Name))
+	for _, source := range od.useSearchSources(filter.Path) {
+		odd := source.od.OneDriveDescription
+		isFound := map[string]bool{}
+		for _, microsoftGraphDriveItemCache := range source.od.DriveCacheCollection.MicrosoftGraphDriveItemCache {
+			for _, child := range microsoftGraphDriveItemCache.Children {
+				if child.ParentReference == nil || !isSearchDriveRootPath(&odd, child.ParentReference.Path) {
+					continue
+				}
+				sourcePath := joinSubPath(odd.DriveRootPathToRelativePath(child.ParentReference.Path), child.Name)
+				if isFound[sourcePath] || !IsSubPath(sourcePath, source.path) {
+					continue
+				}
+				isFound[sourcePath] = true
+				score, ok := useSearchScore(child.Name, words)
+				if !ok {
+					continue
+				}
+				for _, path := range od.UseDriveVolumeMountVirtualPaths(source.od, sourcePath) {
+					if filter.isMatched(path, &child) {
+						searchResults = append(searchResults, searchResult{path, child, score})
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(searchResults, func(i, j int) bool {
+		if searchResults[i].score != searchResults[j].score {
+			return searchResults[i].score > searchResults[j].score
+		}
+		if searchResults[i].item.LastModifiedAt != searchResults[j].item.LastModifiedAt {
+			return searchResults[i].item.LastModifiedAt > searchResults[j].item.LastModifiedAt
+		}
+		return searchResults[i].path < searchResults[j].path
+	})
+	searchPayload := &SearchPayload{Value: []DriveItemCachePayload{}}
+	if offset > len(searchResults) {
+		offset = len(searchResults)
+	}
+	end := offset + useSearchTop(top)
+	if end < len(searchResults) {
+		searchPayload.NextCursor = strconv.Itoa(end)
+	} else {
+		end = len(searchResults)
+	}
+	for _, result := range searchResults[offset:end] {
+		searchPayload.Value = append(searchPayload.Value, od.searchResultToPayload(result.path, &result.item))
+	}
+	return searchPayload, nil
+}
+
+func useSearchTop(top int) int {
+	if top <= 0 {
+		return SearchDefaultTop
+	}
+	if top > SearchMaxTop {
+		return SearchMaxTop
+	}
+	return top
+}
+
+// useSearchSources returns the drives behind the virtual drive, limited to the
+// source of the virtual folder path if given
+func (od *OneDrive) useSearchSources(path string) []searchSource {
+	if path != "" && utils.RegularPath(path) != "/" {
+		sourceOneDrive, sourcePath, _, err := od.ResolveDriveVolumeMount(path)
+		if err == nil && !sourceOneDrive.IsNamespace() {
+			return []searchSource{{sourceOneDrive, sourcePath}}
+		}
+	}
+	searchSources := []searchSource{}
+	isFound := map[*OneDrive]bool{}
+	var addSearchSources func(od *OneDrive, depth int)
+	addSearchSources = func(od *OneDrive, depth int) {
+		if isFound[od] || depth >= driveVolumeMountMaxHops {
+			return
+		}
+		isFound[od] = true
+		if !od.IsNamespace() {
+			searchSources = append(searchSources, searchSource{od, "/"})
+		}
+		for i := range od.OneDriveDescription.DriveVolumeMounts {
+			if mountOneDrive := od.useDriveVolumeMountOneDrive(&od.OneDriveDescription.DriveVolumeMounts[i]); mountOneDrive != nil {
+				addSearchSources(mountOneDrive, depth+1)
+			}
+		}
+	}
+	addSearchSources(od, 0)
+	return searchSources
+}
+
+// useSearchSourcePath returns the path of a Microsoft Graph search result
+// relative to the root path, the parent path is requested by its ID if
+// missing, which parentPaths keeps for the other results
+func (od *OneDrive) useSearchSourcePath(microsoftGraphDriveItem *graphapi.MicrosoftGraphDriveItem, parentPaths map[string]string) (string, bool) {
+	odd := od.OneDriveDescription
+	parentReference := microsoftGraphDriveItem.ParentReference
+	if parentReference == nil {
+		return "", false
+	}
+	parentPath := parentReference.Path
+	if parentPath == "" && parentReference.ID != "" {
+		if _, ok := parentPaths[parentReference.ID]; !ok {
+			parentPaths[parentReference.ID] = ""
+			parentItem, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveItem(&odd, "/drive/items/"+parentReference.ID)
+			if err != nil {
+				log.Println("od.useSearchSourcePath", err)
+			} else if parentItem.ParentReference == nil || parentItem.ParentReference.Path == "" {
+				parentPaths[parentReference.ID] = "/drive/root:"
+			} else {
+				parentPaths[parentReference.ID] = parentItem.ParentReference.Path + "/" + parentItem.Name
+			}
+		}
+		parentPath = parentPaths[parentReference.ID]
+	}
+	if !isSearchDriveRootPath(&odd, parentPath) {
+		return "", false
+	}
+	return joinSubPath(odd.DriveRootPathToRelativePath(parentPath), microsoftGraphDriveItem.Name), true
+}
+
+// isSearchDriveRootPath reports whether the drive root path lies inside the
+// root path of the drive
+func isSearchDriveRootPath(odd *description.OneDriveDescription, path string) bool {
+	rootPath := odd.RelativePathToDriveRootPath("/")
+	return path != "" && (path == rootPath || strings.HasPrefix(path, rootPath+"/"))
+}
+
+// useSearchScore ranks how well name matches all words, an exact name ranks
+// first, then names starting with the words and names containing the words
+// at word boundaries
+func useSearchScore(name string, words []string) (int, bool) {
+	if len(words) == 0 {
+		return 0, true
+	}
+	lowerName := strings.ToLower(name)
+	baseName := strings.TrimSuffix(lowerName, filepath.Ext(lowerName))
+	query := strings.Join(words, " ")
+	score := 0
+	if lowerName == query || baseName == query {
+		score += 100
+	} else if strings.HasPrefix(lowerName, query) {
+		score += 50
+	}
+	for _, word := range words {
+		i := strings.Index(lowerName, word)
+		if i < 0 {
+			return 0, false
+		}
+		if i == 0 || strings.ContainsRune(" ._-()[]", rune(lowerName[i-1])) {
+			score += 20
+		} else {
+			score += 10
+		}
+	}
+	return score, true
+}
+
+func (filter *SearchFilter) isMatched(path string, item *cache.MicrosoftGraphDriveItemCache) bool {
+	if filter.Path != "" {
+		filterPath := utils.RegularPath(filter.Path)
+		if path == filterPath || !IsSubPath(path, filterPath) {
+			return false
+		}
+	}
+	switch filter.Type {
+	case "file":
+		if item.File == nil {
+			return false
+		}
+	case "folder":
+		if item.Folder == nil {
+			return false
+		}
+	}
+	if len(filter.Extensions) > 0 {
+		extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(item.Name), "."))
+		isFound := false
+		for _, filterExtension := range filter.Extensions {
+			if strings.ToLower(strings.TrimPrefix(filterExtension, ".")) == extension {
+				isFound = true
+				break
+			}
+		}
+		if !isFound || item.Folder != nil {
+			return false
+		}
+	}
+	if item.Size < filter.MinSize || (filter.HasMaxSize && item.Size > filter.MaxSize) {
+		return false
+	}
+	if !filter.ModifiedAfter.IsZero() && item.LastModifiedAt < filter.ModifiedAfter.Unix() {
+		return false
+	}
+	if !filter.ModifiedBefore.IsZero() && item.LastModifiedAt >= filter.ModifiedBefore.Unix() {
+		return false
+	}
+	if !filter.CreatedAfter.IsZero() && item.CreatedAt < filter.CreatedAfter.Unix() {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && item.CreatedAt >= filter.CreatedBefore.Unix() {
+		return false
+	}
+	return filter.isRichMetadataMatched(item)
+}
+
+func (filter *SearchFilter) isRichMetadataMatched(item *cache.MicrosoftGraphDriveItemCache) bool {
+	switch filter.Media {
+	case "image":
+		if item.Image == nil {
+			return false
+		}
+	case "photo":
+		if item.Photo == nil {
+			return false
+		}
+	case "video":
+		if item.Video == nil {
+			return false
+		}
+	case "audio":
+		if item.Audio == nil {
+			return false
+		}
+	case "location":
+		if item.Location == nil {
+			return false
+		}
+	}
+	if !filter.TakenAfter.IsZero() || !filter.TakenBefore.IsZero() {
+		if item.Photo == nil || item.Photo.TakenDateTime == nil {
+			return false
+		}
+		if !filter.TakenAfter.IsZero() && item.Photo.TakenDateTime.Before(filter.TakenAfter) {
+			return false
+		}
+		if !filter.TakenBefore.IsZero() && !item.Photo.TakenDateTime.Before(filter.TakenBefore) {
+			return false
+		}
+	}
+	if filter.MinDuration > 0 || filter.MaxDuration > 0 {
+		duration := time.Duration(-1)
+		if item.Video != nil {
+			duration = time.Duration(item.Video.Duration) * time.Millisecond
+		} else if item.Audio != nil {
+			duration = time.Duration(item.Audio.Duration) * time.Millisecond
+		}
+		if duration < 0 || duration < filter.MinDuration || (filter.MaxDuration > 0 && duration > filter.MaxDuration) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterChildren leaves out the children of the listing NOT matching filter,
+// the path of the filter is NOT taken into account
+func (filter *SearchFilter) FilterChildren(driveItemCachePayload *DriveItemCachePayload) {
+	childFilter := *filter
+	childFilter.Path = ""
+	children := []DriveItemCachePayload{}
+	for _, child := range driveItemCachePayload.Children {
+		item := cache.MicrosoftGraphDriveItemCache{
+			File:           child.File,
+			Folder:         child.Folder,
+			Size:           child.Size,
+			CreatedAt:      child.CreatedAt.Unix(),
+			LastModifiedAt: child.LastModifiedAt.Unix(),
+			Name:           child.Name,
+			Image:          child.Image,
+			Photo:          child.Photo,
+			Video:          child.Video,
+			Audio:          child.Audio,
+			Location:       child.Location,
+		}
+		if childFilter.isMatched("", &item) {
+			children = append(children, child)
+		}
+	}
+	driveItemCachePayload.Children = children
+}
+
+// searchResultToPayload returns the payload of the item at the virtual path
+func (od *OneDrive) searchResultToPayload(path string, item *cache.MicrosoftGraphDriveItemCache) DriveItemCachePayload {
+	parentPath, filename := utils.RegularPathToPathFilename(path)
+	driveItemCachePayload := od.newDriveItemCachePayload(item, utils.RegularPath(parentPath), nil)
+	driveItemCachePayload.Name = filename
+	driveItemCachePayload.Children = nil
+	if driveItemCachePayload.Folder == nil {
+		driveItemCachePayload.DownloadURL = &path
+	}
+	return *driveItemCachePayload
+}
+
+// ParseSearchSize parses a size in bytes with an optional K, M, G or T suffix
+// of binary multiples, like 512K or 1.5G
+func ParseSearchSize(str string) (int64, error) {
+	str = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(str)), "B")
+	multiple := float64(1)
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'K':
+			multiple = 1 << 10
+		case 'M':
+			multiple = 1 << 20
+		case 'G':
+			multiple = 1 << 30
+		case 'T':
+			multiple = 1 << 40
+		}
+		if multiple > 1 {
+			str = str[:n-1]
+		}
+	}
+	size, err := strconv.ParseFloat(str, 64)
+	if err != nil || size < 0 {
+		return 0, ErrSearchSizeInvalid
+	}
+	return int64(size * multiple), nil
+}
+
+// ParseSearchTime parses a time in RFC 3339 or a date like 2006-01-02 in UTC
+func ParseSearchTime(str string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, str); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", str)
+	if err != nil {
+		return time.Time{}, ErrSearchTimeInvalid
+	}
+	return t, nil
+}
+
+// ParseSearchDuration parses a duration like 90s, 10m or 1h30m, or a count of
+// seconds
+func ParseSearchDuration(str string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(str, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	duration, err := time.ParseDuration(str)
+	if err != nil || duration < 0 {
+		return 0, ErrSearchDurationInvalid
+	}
+	return duration, nil
+}
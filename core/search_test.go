@@ -0,0 +1,160 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func newTestFile(parentPath, name string, size int64, lastModifiedAt time.Time) cache.MicrosoftGraphDriveItemCache {
+	return cache.MicrosoftGraphDriveItemCache{
+		File:            &graphapi.MicrosoftGraphFile{},
+		Size:            size,
+		LastModifiedAt:  lastModifiedAt.Unix(),
+		Name:            name,
+		ParentReference: &graphapi.MicrosoftGraphItemReference{Path: parentPath},
+	}
+}
+
+func TestSearchDriveCacheCollection(t *testing.T) {
+	od := newTestRootOneDrive("media", "shows")
+	od.OneDriveDescription.DriveVolumeMounts = []description.DriveVolumeMount{
+		newTestDriveVolumeMount("folder", "", "/shows", "/tv"),
+	}
+	day := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	root := &od.DriveCacheCollection.MicrosoftGraphDriveItemCache[0]
+	root.Children = append(root.Children,
+		newTestFile("/drive/root:", "Movie.mkv", 2<<30, day),
+		newTestFile("/drive/root:", "a movie trailer.mp4", 1<<20, day.AddDate(0, 1, 0)),
+		newTestFile("/drive/root:", "notes.txt", 1<<10, day),
+	)
+	od.DriveCacheCollection.MicrosoftGraphDriveItemCache = append(od.DriveCacheCollection.MicrosoftGraphDriveItemCache, cache.MicrosoftGraphDriveItemCache{
+		CacheDescription: &cache.CacheDescription{Path: "/drive/root:/shows", LastUpdateAt: time.Now().Unix(), Status: "Cached"},
+		Children:         []cache.MicrosoftGraphDriveItemCache{newTestFile("/drive/root:/shows", "movie.s01e01.mkv", 1<<30, day)},
+	})
+
+	tests := []struct {
+		filter SearchFilter
+		paths  []string
+	}{
+		// The source of a volume mount is found at both paths
+		{SearchFilter{Name: "movie"}, []string{"/Movie.mkv", "/shows/movie.s01e01.mkv", "/tv/movie.s01e01.mkv", "/a movie trailer.mp4"}},
+		{SearchFilter{Name: "movie", Extensions: []string{"MKV"}, MinSize: 2 << 30}, []string{"/Movie.mkv"}},
+		{SearchFilter{ModifiedAfter: day.AddDate(0, 0, 1)}, []string{"/a movie trailer.mp4"}},
+		{SearchFilter{Type: "file", Path: "/tv"}, []string{"/tv/movie.s01e01.mkv"}},
+	}
+	for _, test := range tests {
+		searchPayload, err := od.SearchDriveCacheCollection(&test.filter, 0, "")
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		paths := []string{}
+		for _, value := range searchPayload.Value {
+			paths = append(paths, *value.DownloadURL)
+		}
+		if len(paths) != len(test.paths) {
+			t.Errorf("%+v got %v", test.filter, paths)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != test.paths[i] {
+				t.Errorf("%+v got %v", test.filter, paths)
+				break
+			}
+		}
+	}
+
+	searchPayload, err := od.SearchDriveCacheCollection(&SearchFilter{Name: "movie"}, 2, "")
+	if err != nil || len(searchPayload.Value) != 2 || searchPayload.NextCursor != "2" {
+		t.Fatalf("got %v %v", searchPayload, err)
+	}
+	searchPayload, err = od.SearchDriveCacheCollection(&SearchFilter{Name: "movie"}, 3, searchPayload.NextCursor)
+	if err != nil || len(searchPayload.Value) != 2 || searchPayload.NextCursor != "" {
+		t.Fatalf("got %v %v", searchPayload, err)
+	}
+}
+
+func TestParseSearchSize(t *testing.T) {
+	for str, size := range map[string]int64{"1024": 1024, "512K": 512 << 10, "1.5G": 3 << 29, "2mb": 2 << 20} {
+		if got, err := ParseSearchSize(str); err != nil || got != size {
+			t.Errorf("%s got %d %v", str, got, err)
+		}
+	}
+	if _, err := ParseSearchSize("big"); err != ErrSearchSizeInvalid {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestSearchFilterChildren(t *testing.T) {
+	taken := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	driveItemCachePayload := &DriveItemCachePayload{Children: []DriveItemCachePayload{
+		{Name: "a.jpg", File: &graphapi.MicrosoftGraphFile{}, Image: &graphapi.MicrosoftGraphImage{}, Photo: &graphapi.MicrosoftGraphPhoto{TakenDateTime: &taken}},
+		{Name: "b.png", File: &graphapi.MicrosoftGraphFile{}, Image: &graphapi.MicrosoftGraphImage{}},
+		{Name: "c.mp4", File: &graphapi.MicrosoftGraphFile{}, Video: &graphapi.MicrosoftGraphVideo{Duration: 45 * 60 * 1000}},
+		{Name: "d.mp3", File: &graphapi.MicrosoftGraphFile{}, Audio: &graphapi.MicrosoftGraphAudio{Duration: 3 * 60 * 1000}},
+	}}
+	tests := []struct {
+		filter SearchFilter
+		names  string
+	}{
+		{SearchFilter{Media: "image"}, "a.jpg,b.png"},
+		{SearchFilter{TakenAfter: taken.AddDate(0, 0, -1), TakenBefore: taken.AddDate(0, 0, 1)}, "a.jpg"},
+		{SearchFilter{TakenAfter: taken.AddDate(0, 0, 1)}, ""},
+		{SearchFilter{MinDuration: 10 * time.Minute}, "c.mp4"},
+		{SearchFilter{Media: "audio", MaxDuration: 10 * time.Minute, Path: "/music"}, "d.mp3"},
+	}
+	for _, test := range tests {
+		payload := *driveItemCachePayload
+		test.filter.FilterChildren(&payload)
+		names := []string{}
+		for _, child := range payload.Children {
+			names = append(names, child.Name)
+		}
+		if strings.Join(names, ",") != test.names {
+			t.Errorf("%+v got %v", test.filter, names)
+		}
+	}
+	if duration, err := ParseSearchDuration("1h30m"); err != nil || duration != 90*time.Minute {
+		t.Errorf("got %s %v", duration, err)
+	}
+}
+
+func TestSearchMicrosoftGraphDriveItemCursor(t *testing.T) {
+	graph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"value":[]}`))
+	}))
+	defer graph.Close()
+	foreignRequests := 0
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		foreignRequests++
+		w.Write([]byte(`{"value":[]}`))
+	}))
+	defer foreign.Close()
+	od := newTestRootOneDrive("media")
+	od.MicrosoftGraphAPI.MicrosoftEndPoints.MicrosoftGraphAPIEndPointURL = graph.URL
+	od.MicrosoftGraphAPI.MicrosoftGraphAPIToken = &graphapi.MicrosoftGraphAPIToken{TokenType: "Bearer", AccessToken: "token"}
+
+	useCursor := func(nextLink string) string {
+		bytes, _ := json.Marshal(searchCursor{NextLink: nextLink})
+		return base64.RawURLEncoding.EncodeToString(bytes)
+	}
+	if _, err := od.SearchMicrosoftGraphDriveItem("movie", &SearchFilter{}, 0, useCursor(graph.URL+"/v1.0/me/drive/root/search(q='movie')?$skiptoken=x")); err != nil {
+		t.Fatal(err)
+	}
+	for _, nextLink := range []string{foreign.URL + "/v1.0/me/drive/root/search(q='movie')", "//" + strings.TrimPrefix(foreign.URL, "http://") + "/v1.0"} {
+		if _, err := od.SearchMicrosoftGraphDriveItem("movie", &SearchFilter{}, 0, useCursor(nextLink)); err != ErrSearchCursorInvalid {
+			t.Errorf("%s got %v", nextLink, err)
+		}
+	}
+	if foreignRequests != 0 {
+		t.Errorf("got %d requests to the foreign host", foreignRequests)
+	}
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/sharing"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+var (
+	ErrSharingLinkTypeInvalid   = errors.New("SharingLinkTypeInvalid")
+	ErrSharingLinkScopeInvalid  = errors.New("SharingLinkScopeInvalid")
+	ErrSharingRoleInvalid       = errors.New("SharingRoleInvalid")
+	ErrSharingRecipientsEmpty   = errors.New("SharingRecipientsEmpty")
+	ErrSharingExpirationInvalid = errors.New("SharingExpirationInvalid")
+	ErrSharingNotSupported      = errors.New("SharingNotSupported")
+)
+
+// SharingCacheMaxAge is the lifetime of the cached permissions of an item
+var SharingCacheMaxAge = 10 * time.Minute
+
+var (
+	sharingLinkTypes  = []string{"view", "edit", "embed"}
+	sharingLinkScopes = []string{"", "anonymous", "organization", "users"}
+	sharingRoles      = []string{"read", "write"}
+)
+
+// ParseSharingExpiration parses the expiration of a sharing link, either an
+// RFC 3339 time or a duration from now like 168h, no expiration if empty
+func ParseSharingExpiration(str string, now time.Time) (*time.Time, error) {
+	if str == "" {
+		return nil, nil
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, str); err == nil {
+		if !expiresAt.After(now) {
+			return nil, ErrSharingExpirationInvalid
+		}
+		return &expiresAt, nil
+	}
+	duration, err := time.ParseDuration(str)
+	if err != nil || duration <= 0 {
+		return nil, ErrSharingExpirationInvalid
+	}
+	expiresAt := now.Add(duration).UTC()
+	return &expiresAt, nil
+}
+
+// InitSharingCache creates the in-memory permission cache of the drive
+func (od *OneDrive) InitSharingCache() {
+	if od.SharingCache == nil {
+		od.SharingCache = sharing.NewCache()
+	}
+}
+
+// GetMicrosoftGraphDriveItemPermissions returns the permissions of the item at
+// path of the drive itself, which are cached unless force is set
+func (od *OneDrive) GetMicrosoftGraphDriveItemPermissions(path string, force bool) ([]graphapi.MicrosoftGraphPermission, error) {
+	if od.IsNamespace() || od.SharingCache == nil {
+		return nil, ErrSharingNotSupported
+	}
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	if !force {
+		if permissions, ok := od.SharingCache.Get(newPath); ok {
+			return permissions.Value, nil
+		}
+	}
+	microsoftGraphPermissions, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDrivePermissions(&odd, odd.RelativePathToDriveRootPath(newPath))
+	if err != nil {
+		return nil, err
+	}
+	od.SharingCache.Put(newPath, microsoftGraphPermissions, time.Now().Add(SharingCacheMaxAge))
+	return microsoftGraphPermissions, nil
+}
+
+// HitMicrosoftGraphDriveItemPermissionsCache returns the cached permissions of
+// the item at path without requesting Microsoft Graph
+func (od *OneDrive) HitMicrosoftGraphDriveItemPermissionsCache(path string) ([]graphapi.MicrosoftGraphPermission, bool) {
+	if od.SharingCache == nil {
+		return nil, false
+	}
+	permissions, ok := od.SharingCache.Get(utils.RegularPath(path))
+	if !ok {
+		return nil, false
+	}
+	return permissions.Value, true
+}
+
+// CreateMicrosoftGraphDriveItemLink creates a sharing link of linkType, one of
+// view, edit and embed, to the item at path, the scope defaults to the policy
+// of the drive and password and expiresAt are optional
+func (od *OneDrive) CreateMicrosoftGraphDriveItemLink(path, linkType, scope, password string, expiresAt *time.Time) (*graphapi.MicrosoftGraphPermission, error) {
+	if !isStringIn(linkType, sharingLinkTypes) {
+		return nil, ErrSharingLinkTypeInvalid
+	}
+	if !isStringIn(scope, sharingLinkScopes) {
+		return nil, ErrSharingLinkScopeInvalid
+	}
+	if od.IsNamespace() {
+		return nil, ErrSharingNotSupported
+	}
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	microsoftGraphPermission, err := od.MicrosoftGraphAPI.PostMicrosoftGraphAPIMeDriveCreateLink(&odd, odd.RelativePathToDriveRootPath(newPath), linkType, scope, password, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	od.removeSharingCache(newPath)
+	return microsoftGraphPermission, nil
+}
+
+// InviteMicrosoftGraphDriveItem grants roles, read or write, on the item at
+// path to the recipients by email
+func (od *OneDrive) InviteMicrosoftGraphDriveItem(path string, emails, roles []string, message string, requireSignIn, sendInvitation bool) ([]graphapi.MicrosoftGraphPermission, error) {
+	newEmails := []string{}
+	for _, email := range emails {
+		if email = strings.TrimSpace(email); email != "" {
+			newEmails = append(newEmails, email)
+		}
+	}
+	if len(newEmails) == 0 {
+		return nil, ErrSharingRecipientsEmpty
+	}
+	if len(roles) == 0 {
+		roles = []string{"read"}
+	}
+	for _, role := range roles {
+		if !isStringIn(role, sharingRoles) {
+			return nil, ErrSharingRoleInvalid
+		}
+	}
+	if od.IsNamespace() {
+		return nil, ErrSharingNotSupported
+	}
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	microsoftGraphPermissions, err := od.MicrosoftGraphAPI.PostMicrosoftGraphAPIMeDriveInvite(&odd, odd.RelativePathToDriveRootPath(newPath), newEmails, roles, message, requireSignIn, sendInvitation)
+	if err != nil {
+		return nil, err
+	}
+	od.removeSharingCache(newPath)
+	return microsoftGraphPermissions, nil
+}
+
+// DeleteMicrosoftGraphDriveItemPermission revokes the permission id of the
+// item at path, a sharing link stops working at once
+func (od *OneDrive) DeleteMicrosoftGraphDriveItemPermission(path, id string) error {
+	if id == "" {
+		return errors.New("od.DeleteMicrosoftGraphDriveItemPermission InvalidID")
+	}
+	if od.IsNamespace() {
+		return ErrSharingNotSupported
+	}
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	if err := od.MicrosoftGraphAPI.DeleteMicrosoftGraphAPIMeDrivePermission(&odd, odd.RelativePathToDriveRootPath(newPath), id); err != nil {
+		return err
+	}
+	od.removeSharingCache(newPath)
+	return nil
+}
+
+func (od *OneDrive) removeSharingCache(path string) {
+	if od.SharingCache != nil {
+		od.SharingCache.Remove(path)
+	}
+}
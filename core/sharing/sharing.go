@@ -0,0 +1,71 @@
+package sharing
+
+import (
+	"sync"
+	"time"
+
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// Permissions are the permissions of an item as listed by Microsoft Graph
+type Permissions struct {
+	Value     []graphapi.MicrosoftGraphPermission
+	ExpiresAt time.Time
+}
+
+// IsExpired reports whether the permissions must be listed again
+func (p *Permissions) IsExpired() bool {
+	return !time.Now().Before(p.ExpiresAt)
+}
+
+// Cache keeps the permissions of items in memory by path
+type Cache struct {
+	mutex   sync.Mutex
+	entries map[string]Permissions
+}
+
+// NewCache returns an empty cache
+func NewCache() *Cache {
+	return &Cache{
+		entries: map[string]Permissions{},
+	}
+}
+
+// Get returns the permissions of key unless expired
+func (sc *Cache) Get(key string) (*Permissions, bool) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	permissions, ok := sc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if permissions.IsExpired() {
+		delete(sc.entries, key)
+		return nil, false
+	}
+	return &permissions, true
+}
+
+// Put stores the permissions of key until expiresAt
+func (sc *Cache) Put(key string, value []graphapi.MicrosoftGraphPermission, expiresAt time.Time) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.entries[key] = Permissions{
+		Value:     value,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// Remove forgets the permissions of key
+func (sc *Cache) Remove(key string) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	delete(sc.entries, key)
+}
+
+// Len returns the number of cached items
+func (sc *Cache) Len() int {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	return len(sc.entries)
+}
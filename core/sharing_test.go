@@ -0,0 +1,43 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSharingExpiration(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if expiresAt, err := ParseSharingExpiration("", now); err != nil || expiresAt != nil {
+		t.Errorf("got %v %v", expiresAt, err)
+	}
+	if expiresAt, err := ParseSharingExpiration("168h", now); err != nil || !expiresAt.Equal(now.Add(168*time.Hour)) {
+		t.Errorf("got %v %v", expiresAt, err)
+	}
+	if expiresAt, err := ParseSharingExpiration("2020-02-01T00:00:00Z", now); err != nil || expiresAt.Month() != time.February {
+		t.Errorf("got %v %v", expiresAt, err)
+	}
+	for _, str := range []string{"2019-12-31T00:00:00Z", "-1h", "tomorrow"} {
+		if _, err := ParseSharingExpiration(str, now); err != ErrSharingExpirationInvalid {
+			t.Errorf("%s got %v", str, err)
+		}
+	}
+}
+
+func TestSharingValidation(t *testing.T) {
+	od := &OneDrive{}
+	if _, err := od.CreateMicrosoftGraphDriveItemLink("/a", "blocks", "", "", nil); err != ErrSharingLinkTypeInvalid {
+		t.Errorf("got %v", err)
+	}
+	if _, err := od.CreateMicrosoftGraphDriveItemLink("/a", "view", "everyone", "", nil); err != ErrSharingLinkScopeInvalid {
+		t.Errorf("got %v", err)
+	}
+	if _, err := od.InviteMicrosoftGraphDriveItem("/a", []string{" "}, nil, "", true, true); err != ErrSharingRecipientsEmpty {
+		t.Errorf("got %v", err)
+	}
+	if _, err := od.InviteMicrosoftGraphDriveItem("/a", []string{"a@example.com"}, []string{"owner"}, "", true, true); err != ErrSharingRoleInvalid {
+		t.Errorf("got %v", err)
+	}
+	if _, ok := od.HitMicrosoftGraphDriveItemPermissionsCache("/a"); ok {
+		t.Error("hit without a cache")
+	}
+}
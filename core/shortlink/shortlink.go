@@ -0,0 +1,249 @@
+package shortlink
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLinkNotFound  = errors.New("LinkNotFound")
+	ErrLinkExpired   = errors.New("LinkExpired")
+	ErrLinkExhausted = errors.New("LinkExhausted")
+)
+
+// AccessLogMaxSize bounds the access logs kept for each link, the oldest are
+// dropped first
+var AccessLogMaxSize = 100
+
+// Link is a short link to the path of a drive, the limits are optional
+type Link struct {
+	Token        string      `json:"token"`
+	Drive        string      `json:"drive,omitempty"`
+	Path         string      `json:"path"`
+	FileOnly     bool        `json:"fileOnly,omitempty"` // the path itself only, nothing below it
+	ExpiresAt    *time.Time  `json:"expiresAt,omitempty"`
+	MaxDownloads int64       `json:"maxDownloads,omitempty"`
+	Downloads    int64       `json:"downloads"`
+	PasswordSalt string      `json:"passwordSalt,omitempty"`
+	PasswordHash string      `json:"passwordHash,omitempty"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	CreatedBy    string      `json:"createdBy,omitempty"`
+	AccessLogs   []AccessLog `json:"accessLogs,omitempty"`
+}
+
+// AccessLog records a request of a link
+type AccessLog struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+}
+
+// IsExpired reports whether the link expired at now
+func (l *Link) IsExpired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// IsExhausted reports whether the link reached its maximum downloads
+func (l *Link) IsExhausted() bool {
+	return l.MaxDownloads > 0 && l.Downloads >= l.MaxDownloads
+}
+
+// HasPassword reports whether the link requires a password
+func (l *Link) HasPassword() bool {
+	return l.PasswordHash != ""
+}
+
+// SetPassword stores the salted hash of password, an empty password removes it
+func (l *Link) SetPassword(password string) error {
+	if password == "" {
+		l.PasswordSalt, l.PasswordHash = "", ""
+		return nil
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	l.PasswordSalt = hex.EncodeToString(salt)
+	l.PasswordHash = hashPassword(l.PasswordSalt, password)
+	return nil
+}
+
+// VerifyPassword reports whether password opens the link
+func (l *Link) VerifyPassword(password string) bool {
+	if !l.HasPassword() {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(hashPassword(l.PasswordSalt, password)), []byte(l.PasswordHash)) == 1
+}
+
+func hashPassword(salt, password string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// Store keeps the links in a JSON file
+type Store struct {
+	Filename string
+
+	mutex sync.Mutex
+	links map[string]*Link
+}
+
+// NewStore returns an empty store saved to filename
+func NewStore(filename string) *Store {
+	return &Store{
+		Filename: filename,
+		links:    map[string]*Link{},
+	}
+}
+
+// Load reads the links from the file of the store, a missing file is empty
+func (s *Store) Load() error {
+	log.Println("Loading short link file from " + s.Filename)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	bytes, err := ioutil.ReadFile(s.Filename)
+	if _, ok := err.(*os.PathError); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	links := struct {
+		Links []*Link `json:"links"`
+	}{}
+	if err := json.Unmarshal(bytes, &links); err != nil {
+		return err
+	}
+	s.links = map[string]*Link{}
+	for _, link := range links.Links {
+		s.links[link.Token] = link
+	}
+	return nil
+}
+
+func (s *Store) save() error {
+	links := struct {
+		Links []*Link `json:"links"`
+	}{
+		s.list(),
+	}
+	bytes, err := json.Marshal(links)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Filename, bytes, 0600)
+}
+
+func (s *Store) list() []*Link {
+	links := []*Link{}
+	for _, link := range s.links {
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].CreatedAt.Before(links[j].CreatedAt)
+	})
+	return links
+}
+
+// Create mints a random token for link and saves it
+func (s *Store) Create(link *Link) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for {
+		token := make([]byte, 9)
+		if _, err := rand.Read(token); err != nil {
+			return err
+		}
+		link.Token = base64.RawURLEncoding.EncodeToString(token)
+		if _, ok := s.links[link.Token]; !ok {
+			break
+		}
+	}
+	s.links[link.Token] = link
+	return s.save()
+}
+
+// Get returns a copy of the link of token
+func (s *Store) Get(token string) (*Link, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	link, ok := s.links[token]
+	if !ok {
+		return nil, false
+	}
+	newLink := *link
+	newLink.AccessLogs = append([]AccessLog{}, link.AccessLogs...)
+	return &newLink, true
+}
+
+// List returns copies of all links by creation time, without access logs
+func (s *Store) List() []Link {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	links := []Link{}
+	for _, link := range s.list() {
+		newLink := *link
+		newLink.AccessLogs = nil
+		links = append(links, newLink)
+	}
+	return links
+}
+
+// Delete removes the link of token
+func (s *Store) Delete(token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.links[token]; !ok {
+		return ErrLinkNotFound
+	}
+	delete(s.links, token)
+	return s.save()
+}
+
+// Download counts a download of the link of token unless it expired or
+// reached its maximum downloads at now, the count is saved with the next log
+func (s *Store) Download(token string, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	link, ok := s.links[token]
+	if !ok {
+		return ErrLinkNotFound
+	}
+	if link.IsExpired(now) {
+		return ErrLinkExpired
+	}
+	if link.IsExhausted() {
+		return ErrLinkExhausted
+	}
+	link.Downloads++
+	return nil
+}
+
+// Log appends accessLog to the link of token and saves the store
+func (s *Store) Log(token string, accessLog AccessLog) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	link, ok := s.links[token]
+	if !ok {
+		return ErrLinkNotFound
+	}
+	link.AccessLogs = append(link.AccessLogs, accessLog)
+	if over := len(link.AccessLogs) - AccessLogMaxSize; over > 0 {
+		link.AccessLogs = append([]AccessLog{}, link.AccessLogs[over:]...)
+	}
+	return s.save()
+}
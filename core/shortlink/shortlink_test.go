@@ -0,0 +1,69 @@
+package shortlink
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shortlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := NewStore(filepath.Join(dir, "links.json"))
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	link := &Link{Path: "/a.mp4", MaxDownloads: 2, CreatedAt: now}
+	if err := link.SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create(link); err != nil || len(link.Token) != 12 {
+		t.Fatalf("got %q %v", link.Token, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Download(link.Token, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Download(link.Token, now); err != ErrLinkExhausted {
+		t.Errorf("got %v", err)
+	}
+	defer func(accessLogMaxSize int) { AccessLogMaxSize = accessLogMaxSize }(AccessLogMaxSize)
+	AccessLogMaxSize = 2
+	for status := 200; status < 203; status++ {
+		if err := s.Log(link.Token, AccessLog{Time: now, Path: "/", Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The downloads and logs are saved with the last log
+	s = NewStore(s.Filename)
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+	loadedLink, ok := s.Get(link.Token)
+	if !ok || loadedLink.Downloads != 2 || len(loadedLink.AccessLogs) != 2 || loadedLink.AccessLogs[0].Status != 201 {
+		t.Fatalf("got %+v", loadedLink)
+	}
+	if !loadedLink.VerifyPassword("secret") || loadedLink.VerifyPassword("Secret") {
+		t.Error("password mismatch")
+	}
+	if err := s.Delete(link.Token); err != nil || len(s.List()) != 0 {
+		t.Errorf("got %v", err)
+	}
+	if err := s.Delete(link.Token); err != ErrLinkNotFound {
+		t.Errorf("got %v", err)
+	}
+
+	expiresAt := now.Add(-time.Second)
+	expiredLink := &Link{Path: "/", ExpiresAt: &expiresAt}
+	if !expiredLink.IsExpired(now) || !expiredLink.VerifyPassword("") {
+		t.Errorf("got %+v", expiredLink)
+	}
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+// StatMicrosoftGraphDriveItem returns the item at the virtual path with its
+// children, the path is resolved through the volume mounts and the volume
+// mounts inside a folder are listed as its children
+func (od *OneDrive) StatMicrosoftGraphDriveItem(path string) (*cache.MicrosoftGraphDriveItemCache, error) {
+	newPath := utils.RegularPath(path)
+	hops, err := od.ResolveDriveVolumeMountHops(newPath)
+	if err != nil {
+		return nil, err
+	}
+	driveVolumeMountRule := useDriveVolumeMountHopsRule(hops)
+	if driveVolumeMountRule.GetType() == description.DriveVolumeMountRedirect {
+		return nil, ErrDriveVolumeMountRedirect
+	}
+	sourceOneDrive, sourcePath := hops[len(hops)-1].SourceOneDrive, hops[len(hops)-1].SourcePath
+	var microsoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache
+	if sourceOneDrive.IsNamespace() {
+		microsoftGraphDriveItemCache, err = sourceOneDrive.statNamespaceFolder(sourcePath)
+	} else {
+		microsoftGraphDriveItemCache, err = sourceOneDrive.statMicrosoftGraphDriveItem(sourcePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if microsoftGraphDriveItemCache.Folder == nil {
+		return microsoftGraphDriveItemCache, nil
+	}
+	if driveVolumeMountRule.GetType() == description.DriveVolumeMountFileOnly {
+		return nil, ErrDriveVolumeMountFileOnly
+	}
+	microsoftGraphDriveItemCache.Children = useDriveVolumeMountHopsChildren(hops, microsoftGraphDriveItemCache.Children)
+	return microsoftGraphDriveItemCache, nil
+}
+
+// statMicrosoftGraphDriveItem returns the item at path of the drive itself from
+// the drive cache, an uncached item is requested from Microsoft Graph directly
+func (od *OneDrive) statMicrosoftGraphDriveItem(path string) (*cache.MicrosoftGraphDriveItemCache, error) {
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	microsoftGraphDriveItemCache, err := od.DriveCacheCollection.HitMicrosoftGraphDriveItemCache(&odd, newPath)
+	if err != nil || microsoftGraphDriveItemCache == nil {
+		microsoftGraphDriveItem, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveItem(&odd, odd.RelativePathToDriveRootPath(newPath))
+		if err != nil {
+			return nil, err
+		}
+		if microsoftGraphDriveItem.Folder == nil {
+			return cache.DriveItemToCache(microsoftGraphDriveItem)
+		}
+		microsoftGraphDriveItemCache, err = od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveChildrenRequest(&odd, odd.RelativePathToDriveRootPath(newPath))
+		if err != nil {
+			return nil, err
+		}
+	}
+	microsoftGraphDriveItemCache.Children = od.filterHiddenChildren(newPath, microsoftGraphDriveItemCache.Children)
+	return microsoftGraphDriveItemCache, nil
+}
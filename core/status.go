@@ -0,0 +1,212 @@
+package core
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// Statuses of the drives, only degraded drives fail the status endpoint
+const (
+	DriveStatusOK       = "ok"
+	DriveStatusWarning  = "warning"
+	DriveStatusDegraded = "degraded"
+)
+
+// DriveStatusRefreshLagFactor is how many refresh intervals the stalest
+// cached folder may be overdue before the drive warns, a drive failing the
+// requests to Microsoft Graph warns and degrades after DriveStatusGraphFailurePeriod
+// without success
+var (
+	DriveStatusRefreshLagFactor   = int64(2)
+	DriveStatusGraphFailurePeriod = 5 * time.Minute
+)
+
+var statusMutex sync.Mutex
+
+// DriveStatus reports the health of a drive, the problems are named like
+// TokenExpired
+type DriveStatus struct {
+	Drive            string                        `json:"drive"`
+	Status           string                        `json:"status"` // ok, warning, degraded
+	Problems         []string                      `json:"problems,omitempty"`
+	Token            DriveTokenStatus              `json:"token"`
+	Graph            DriveGraphStatus              `json:"graph"`
+	Quota            *graphapi.MicrosoftGraphQuota `json:"quota,omitempty"`
+	QuotaRefreshedAt *time.Time                    `json:"quotaRefreshedAt,omitempty"`
+	Cache            DriveCacheStatus              `json:"cache"`
+	ActiveUploads    int                           `json:"activeUploads"`
+}
+
+// DriveTokenStatus reports the access token of a drive
+type DriveTokenStatus struct {
+	State       string     `json:"state"` // valid, expired, missing
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	RefreshedAt *time.Time `json:"refreshedAt,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// DriveGraphStatus reports the last requests to Microsoft Graph
+type DriveGraphStatus struct {
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+	LastFailureAt *time.Time `json:"lastFailureAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
+
+// DriveCacheStatus reports the cache of a drive, the refresh lag is how many
+// seconds the stalest cached folder is overdue for its refresh
+type DriveCacheStatus struct {
+	cache.Stat
+	RefreshLag   int64 `json:"refreshLag"`
+	ContentBytes int64 `json:"contentBytes,omitempty"`
+}
+
+// StatusPayload reports the drives, its status is the worst of theirs
+type StatusPayload struct {
+	Status string         `json:"status"`
+	Drives []*DriveStatus `json:"drives"`
+}
+
+// RefreshMicrosoftGraphDriveQuota requests the quota of the drive
+func (od *OneDrive) RefreshMicrosoftGraphDriveQuota() error {
+	odd := od.OneDriveDescription
+	quota, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveQuota(&odd)
+	if err != nil {
+		return err
+	}
+	od.setQuota(quota, time.Now())
+	return nil
+}
+
+func (od *OneDrive) setQuota(quota *graphapi.MicrosoftGraphQuota, now time.Time) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	od.quota = quota
+	od.quotaRefreshedAt = now
+}
+
+// GetDriveStatuses reports the drive and the drives mounted into it, all
+// drives behind the virtual drive
+func (od *OneDrive) GetDriveStatuses(now time.Time) []*DriveStatus {
+	driveStatuses := []*DriveStatus{}
+	for _, source := range od.useSearchSources("/") {
+		driveStatuses = append(driveStatuses, source.od.GetDriveStatus(now))
+	}
+	return driveStatuses
+}
+
+// GetDriveStatus reports the token, the requests to Microsoft Graph, the
+// quota, the cache and the uploads of the drive at now
+func (od *OneDrive) GetDriveStatus(now time.Time) *DriveStatus {
+	driveStatus := &DriveStatus{Status: DriveStatusOK}
+	if od.OneDriveDescription.OneDriveName != nil {
+		driveStatus.Drive = *od.OneDriveDescription.OneDriveName
+	}
+	addProblem := func(status, problem string) {
+		driveStatus.Problems = append(driveStatus.Problems, problem)
+		if driveStatus.Status != DriveStatusDegraded {
+			driveStatus.Status = status
+		}
+	}
+
+	apiStatus := od.MicrosoftGraphAPI.Status.Snapshot()
+	driveStatus.Token = DriveTokenStatus{
+		State:       "valid",
+		ExpiresAt:   useStatusTime(apiStatus.TokenExpiresAt),
+		RefreshedAt: useStatusTime(apiStatus.TokenRefreshedAt),
+		Error:       apiStatus.TokenError,
+	}
+	if token := od.MicrosoftGraphAPI.MicrosoftGraphAPIToken; token == nil || token.AccessToken == "" || od.OneDriveDescription.DriveDescription == nil {
+		driveStatus.Token.State = "missing"
+		addProblem(DriveStatusDegraded, "TokenMissing")
+	} else if !apiStatus.TokenExpiresAt.IsZero() && !now.Before(apiStatus.TokenExpiresAt) {
+		driveStatus.Token.State = "expired"
+		addProblem(DriveStatusDegraded, "TokenExpired")
+	} else if apiStatus.TokenError != "" {
+		addProblem(DriveStatusWarning, "TokenRefreshFailed")
+	}
+
+	driveStatus.Graph = DriveGraphStatus{
+		LastSuccessAt: useStatusTime(apiStatus.LastSuccessAt),
+		LastFailureAt: useStatusTime(apiStatus.LastFailureAt),
+		LastError:     apiStatus.LastError,
+	}
+	if apiStatus.LastFailureAt.After(apiStatus.LastSuccessAt) {
+		if now.Sub(apiStatus.LastSuccessAt) > DriveStatusGraphFailurePeriod {
+			addProblem(DriveStatusDegraded, "MicrosoftGraphRequestFailed")
+		} else {
+			addProblem(DriveStatusWarning, "MicrosoftGraphRequestFailed")
+		}
+	}
+
+	statusMutex.Lock()
+	driveStatus.Quota = od.quota
+	driveStatus.QuotaRefreshedAt = useStatusTime(od.quotaRefreshedAt)
+	statusMutex.Unlock()
+	if driveStatus.Quota != nil {
+		switch driveStatus.Quota.State {
+		case "critical":
+			addProblem(DriveStatusWarning, "QuotaCritical")
+		case "exceeded":
+			addProblem(DriveStatusWarning, "QuotaExceeded")
+		}
+	}
+
+	driveStatus.Cache.Stat = od.DriveCacheCollection.Stat()
+	if oldestUpdateAt := driveStatus.Cache.OldestUpdateAt; oldestUpdateAt > 0 {
+		refreshInterval := od.OneDriveDescription.GetRefreshInterval()
+		// The cron refreshes the folders older than this, see cache.IsCacheNeedUpdate
+		refreshAge := graphapi.AtMicrosoftGraphDownloadURLAvailableSafePeriod - refreshInterval
+		if lag := now.Unix() - oldestUpdateAt - refreshAge; lag > 0 {
+			driveStatus.Cache.RefreshLag = lag
+		}
+		if driveStatus.Cache.RefreshLag > DriveStatusRefreshLagFactor*refreshInterval {
+			addProblem(DriveStatusWarning, "CacheRefreshLagging")
+		}
+	}
+	if od.ContentCache != nil {
+		driveStatus.Cache.ContentBytes = od.ContentCache.Size()
+	}
+
+	for _, uploader := range od.UploaderCollection.List() {
+		if uploader.IsActive() {
+			driveStatus.ActiveUploads++
+		}
+	}
+	return driveStatus
+}
+
+// SumUpDriveStatuses returns the worst status of the drives
+func SumUpDriveStatuses(driveStatuses []*DriveStatus) string {
+	status := DriveStatusOK
+	for _, driveStatus := range driveStatuses {
+		switch driveStatus.Status {
+		case DriveStatusDegraded:
+			return DriveStatusDegraded
+		case DriveStatusWarning:
+			status = DriveStatusWarning
+		}
+	}
+	return status
+}
+
+// initQuota takes the quota reported along with the drive at start
+func (od *OneDrive) initQuota() {
+	if driveDescription := od.OneDriveDescription.DriveDescription; driveDescription != nil && driveDescription.Quota != nil {
+		od.setQuota(driveDescription.Quota, time.Now())
+		return
+	}
+	if err := od.RefreshMicrosoftGraphDriveQuota(); err != nil {
+		log.Println("od.initQuota", err)
+	}
+}
+
+func useStatusTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestDriveStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1.0/me/drive" {
+			w.Write([]byte(`{"quota":{"remaining":10,"state":"critical","total":100,"used":90}}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	name := "drive"
+	od := &OneDrive{}
+	od.OneDriveDescription.OneDriveName = &name
+	od.MicrosoftGraphAPI.MicrosoftEndPoints.MicrosoftGraphAPIEndPointURL = server.URL
+	od.MicrosoftGraphAPI.Status = &graphapi.MicrosoftGraphAPIStatus{}
+
+	// The drive never finished auth
+	if driveStatus := od.GetDriveStatus(time.Now()); driveStatus.Status != DriveStatusDegraded || driveStatus.Token.State != "missing" {
+		t.Errorf("got %+v", driveStatus)
+	}
+
+	od.OneDriveDescription.DriveDescription = &graphapi.MicrosoftGraphDrive{}
+	od.MicrosoftGraphAPI.MicrosoftGraphAPIToken = &graphapi.MicrosoftGraphAPIToken{TokenType: "Bearer", AccessToken: "token"}
+	if err := od.RefreshMicrosoftGraphDriveQuota(); err != nil {
+		t.Fatal(err)
+	}
+	driveStatus := od.GetDriveStatus(time.Now())
+	if driveStatus.Status != DriveStatusWarning || driveStatus.Quota == nil || driveStatus.Quota.Used != 90 || driveStatus.Graph.LastSuccessAt == nil {
+		t.Errorf("got %+v", driveStatus)
+	}
+
+	// A failure right after a success only warns
+	if _, err := od.MicrosoftGraphAPI.UseMicrosoftGraphAPIGet("/me/drive/root"); err == nil {
+		t.Fatal("got no error")
+	}
+	driveStatus = od.GetDriveStatus(time.Now())
+	if driveStatus.Status != DriveStatusWarning || driveStatus.Graph.LastError != http.StatusText(http.StatusServiceUnavailable) {
+		t.Errorf("got %+v", driveStatus)
+	}
+	driveStatus = od.GetDriveStatus(time.Now().Add(DriveStatusGraphFailurePeriod + time.Minute))
+	if driveStatus.Status != DriveStatusDegraded {
+		t.Errorf("got %+v", driveStatus)
+	}
+	if status := SumUpDriveStatuses([]*DriveStatus{{Status: DriveStatusOK}, driveStatus}); status != DriveStatusDegraded {
+		t.Errorf("got %s", status)
+	}
+}
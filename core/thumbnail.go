@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/thumbnail"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+var (
+	ErrThumbnailSizeInvalid = errors.New("ThumbnailSizeInvalid")
+	ErrThumbnailNotFound    = errors.New("ThumbnailNotFound")
+)
+
+// ThumbnailURLMaxAge and ThumbnailContentMaxAge are the lifetimes of cached
+// thumbnail URLs and contents, ThumbnailCacheMaxSize bounds the contents kept
+// in memory for each drive and ThumbnailMaxSize bounds a single content
+var (
+	ThumbnailURLMaxAge     = 30 * time.Minute
+	ThumbnailContentMaxAge = 24 * time.Hour
+	ThumbnailCacheMaxSize  = int64(64 << 20)
+	ThumbnailMaxSize       = int64(8 << 20)
+)
+
+var thumbnailSizeRegexp = regexp.MustCompile(`^c[1-9][0-9]{0,3}x[1-9][0-9]{0,3}(_crop)?$`)
+
+// ParseThumbnailSize validates size, small, medium, large or a custom size
+// like c300x400 or c300x400_crop, medium by default
+func ParseThumbnailSize(size string) (string, error) {
+	switch size {
+	case "":
+		return "medium", nil
+	case "small", "medium", "large":
+		return size, nil
+	}
+	if !thumbnailSizeRegexp.MatchString(size) {
+		return "", ErrThumbnailSizeInvalid
+	}
+	return size, nil
+}
+
+// InitThumbnailCache creates the in-memory thumbnail cache of the drive
+func (od *OneDrive) InitThumbnailCache() {
+	if od.ThumbnailCache == nil {
+		od.ThumbnailCache = thumbnail.NewCache(ThumbnailCacheMaxSize)
+		od.ThumbnailCache.OnEvict = od.useCacheEviction("thumbnail")
+	}
+}
+
+// UseThumbnailURL returns the URL of the thumbnail of size of the item at
+// the virtual path, served through the thumbnail API
+func UseThumbnailURL(drive, path, size string) string {
+	query := url.Values{}
+	if drive != "" {
+		query.Set("drive", drive)
+	}
+	query.Set("path", path)
+	query.Set("size", size)
+	return "/api/onedrive/thumbnail?" + query.Encode()
+}
+
+// GetMicrosoftGraphDriveItemThumbnailURL returns the thumbnail of size of the
+// item at path of the drive itself, the URL from Microsoft Graph is cached
+func (od *OneDrive) GetMicrosoftGraphDriveItemThumbnailURL(path, size string) (*thumbnail.Thumbnail, error) {
+	if od.IsNamespace() || od.ThumbnailCache == nil {
+		return nil, ErrThumbnailNotFound
+	}
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	key := od.useThumbnailKey(newPath, size)
+	if cachedThumbnail, ok := od.ThumbnailCache.Get(key); ok && !cachedThumbnail.IsURLExpired() {
+		return cachedThumbnail, nil
+	}
+	microsoftGraphThumbnail, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveThumbnail(&odd, odd.RelativePathToDriveRootPath(newPath), size)
+	if err != nil {
+		return nil, err
+	}
+	if microsoftGraphThumbnail.URL == "" {
+		return nil, ErrThumbnailNotFound
+	}
+	newThumbnail := &thumbnail.Thumbnail{}
+	if cachedThumbnail, ok := od.ThumbnailCache.Get(key); ok {
+		newThumbnail = cachedThumbnail
+	}
+	newThumbnail.URL = microsoftGraphThumbnail.URL
+	newThumbnail.Width = microsoftGraphThumbnail.Width
+	newThumbnail.Height = microsoftGraphThumbnail.Height
+	newThumbnail.URLExpiresAt = time.Now().Add(ThumbnailURLMaxAge)
+	od.ThumbnailCache.Put(key, newThumbnail)
+	return newThumbnail, nil
+}
+
+// useThumbnailKey keys the thumbnails by the cTag of the cached item as well,
+// so a changed content gets a new thumbnail
+func (od *OneDrive) useThumbnailKey(path, size string) string {
+	odd := od.OneDriveDescription
+	key := path + "?" + size
+	if microsoftGraphDriveItemCache, err := od.DriveCacheCollection.HitMicrosoftGraphDriveContentURLCache(&odd, path); err == nil {
+		key += "&" + microsoftGraphDriveItemCache.CTag
+	}
+	return key
+}
+
+// GetMicrosoftGraphDriveItemThumbnail returns the thumbnail of size of the
+// item at path of the drive itself with its content, which is cached
+func (od *OneDrive) GetMicrosoftGraphDriveItemThumbnail(path, size string) (*thumbnail.Thumbnail, error) {
+	if od.IsNamespace() || od.ThumbnailCache == nil {
+		return nil, ErrThumbnailNotFound
+	}
+	newPath := utils.RegularPath(path)
+	key := od.useThumbnailKey(newPath, size)
+	cachedThumbnail, ok := od.ThumbnailCache.Get(key)
+	od.countCacheLookup("thumbnail", ok && !cachedThumbnail.IsContentExpired())
+	if ok && !cachedThumbnail.IsContentExpired() {
+		return cachedThumbnail, nil
+	}
+	newThumbnail, err := od.GetMicrosoftGraphDriveItemThumbnailURL(newPath, size)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(newThumbnail.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("od.GetMicrosoftGraphDriveItemThumbnail UnexpectedStatus " + resp.Status)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, ThumbnailMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > ThumbnailMaxSize {
+		return nil, errors.New("od.GetMicrosoftGraphDriveItemThumbnail TooLarge " + newPath)
+	}
+	newThumbnail.ContentType = resp.Header.Get("Content-Type")
+	if newThumbnail.ContentType == "" {
+		newThumbnail.ContentType = http.DetectContentType(content)
+	}
+	newThumbnail.Content = content
+	newThumbnail.ExpiresAt = time.Now().Add(ThumbnailContentMaxAge)
+	od.ThumbnailCache.Put(key, newThumbnail)
+	return newThumbnail, nil
+}
@@ -0,0 +1,104 @@
+package thumbnail
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Thumbnail is the URL of a thumbnail from Microsoft Graph and its content
+// once fetched, both expire on their own
+type Thumbnail struct {
+	URL          string
+	Width        int32
+	Height       int32
+	URLExpiresAt time.Time
+
+	ContentType string
+	Content     []byte
+	ExpiresAt   time.Time
+}
+
+// IsURLExpired reports whether the URL must be requested again
+func (t *Thumbnail) IsURLExpired() bool {
+	return t.URL == "" || !time.Now().Before(t.URLExpiresAt)
+}
+
+// IsContentExpired reports whether the content must be fetched again
+func (t *Thumbnail) IsContentExpired() bool {
+	return t.Content == nil || !time.Now().Before(t.ExpiresAt)
+}
+
+// Cache keeps thumbnails in memory, the least recently used are evicted once
+// the total size of the contents exceeds MaxSize
+type Cache struct {
+	MaxSize int64
+	OnEvict func() // called for each thumbnail evicted, with the cache locked
+
+	mutex   sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key       string
+	thumbnail Thumbnail
+}
+
+// NewCache returns an empty cache
+func NewCache(maxSize int64) *Cache {
+	return &Cache{
+		MaxSize: maxSize,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get returns the thumbnail of key unless both its URL and content expired
+func (tc *Cache) Get(key string) (*Thumbnail, bool) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	element, ok := tc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	thumbnail := element.Value.(*cacheEntry).thumbnail
+	if thumbnail.IsURLExpired() && thumbnail.IsContentExpired() {
+		tc.remove(element)
+		return nil, false
+	}
+	tc.lru.MoveToFront(element)
+	return &thumbnail, true
+}
+
+// Put stores the thumbnail of key and evicts the least recently used
+func (tc *Cache) Put(key string, thumbnail *Thumbnail) {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if element, ok := tc.entries[key]; ok {
+		tc.remove(element)
+	}
+	tc.entries[key] = tc.lru.PushFront(&cacheEntry{key, *thumbnail})
+	tc.size += int64(len(thumbnail.Content))
+	for tc.size > tc.MaxSize && tc.lru.Len() > 1 {
+		tc.remove(tc.lru.Back())
+		if tc.OnEvict != nil {
+			tc.OnEvict()
+		}
+	}
+}
+
+// Len returns the count of cached thumbnails
+func (tc *Cache) Len() int {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	return tc.lru.Len()
+}
+
+func (tc *Cache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	tc.lru.Remove(element)
+	delete(tc.entries, entry.key)
+	tc.size -= int64(len(entry.thumbnail.Content))
+}
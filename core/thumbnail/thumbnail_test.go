@@ -0,0 +1,31 @@
+package thumbnail
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	tc := NewCache(10)
+	expiresAt := time.Now().Add(time.Hour)
+	tc.Put("a", &Thumbnail{URL: "https://a", URLExpiresAt: expiresAt, Content: make([]byte, 6), ExpiresAt: expiresAt})
+	tc.Put("b", &Thumbnail{URL: "https://b", URLExpiresAt: expiresAt})
+	if _, ok := tc.Get("a"); !ok {
+		t.Fatal("a got evicted")
+	}
+	// The least recently used b goes first, then a exceeds the size alone
+	tc.Put("c", &Thumbnail{Content: make([]byte, 6), ExpiresAt: expiresAt})
+	if _, ok := tc.Get("b"); ok || tc.Len() != 1 {
+		t.Errorf("got %d thumbnails", tc.Len())
+	}
+
+	// A thumbnail with an expired URL serves its content still
+	tc.Put("d", &Thumbnail{URL: "https://d", URLExpiresAt: time.Now(), Content: []byte{1}, ExpiresAt: expiresAt})
+	if thumbnail, ok := tc.Get("d"); !ok || !thumbnail.IsURLExpired() || thumbnail.IsContentExpired() {
+		t.Errorf("got %+v", thumbnail)
+	}
+	tc.Put("e", &Thumbnail{URL: "https://e", URLExpiresAt: time.Now()})
+	if _, ok := tc.Get("e"); ok {
+		t.Error("e got")
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/activity"
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+var ErrTombstoneNotFound = errors.New("TombstoneNotFound")
+
+// ListDriveItemTombstones lists the items deleted lately from the drives
+// behind the virtual drive below the virtual folder path, the latest deleted
+// first, with the virtual paths they had
+func (od *OneDrive) ListDriveItemTombstones(path string) []cache.Tombstone {
+	filterPath := utils.RegularPath(path)
+	tombstones := []cache.Tombstone{}
+	for _, source := range od.useSearchSources(path) {
+		odd := source.od.OneDriveDescription
+		for _, tombstone := range source.od.DriveCacheCollection.ListTombstones() {
+			if !isSearchDriveRootPath(&odd, tombstone.Path) {
+				continue
+			}
+			sourcePath := odd.DriveRootPathToRelativePath(tombstone.Path)
+			for _, virtualPath := range od.UseDriveVolumeMountVirtualPaths(source.od, sourcePath) {
+				if IsSubPath(virtualPath, filterPath) {
+					newTombstone := tombstone
+					newTombstone.Path = virtualPath
+					tombstones = append(tombstones, newTombstone)
+				}
+			}
+		}
+	}
+	sort.SliceStable(tombstones, func(i, j int) bool {
+		return tombstones[i].DeletedAt.After(tombstones[j].DeletedAt)
+	})
+	return tombstones
+}
+
+// UseDriveItemTombstonePaths returns the virtual paths the deleted item id of
+// the drive itself had, none if no tombstone of it is kept
+func (od *OneDrive) UseDriveItemTombstonePaths(id string) []string {
+	odd := od.OneDriveDescription
+	paths := []string{}
+	for _, tombstone := range od.DriveCacheCollection.ListTombstones() {
+		if tombstone.ID != id || !isSearchDriveRootPath(&odd, tombstone.Path) {
+			continue
+		}
+		paths = append(paths, od.UseDriveVolumeMountVirtualPaths(od, odd.DriveRootPathToRelativePath(tombstone.Path))...)
+	}
+	return paths
+}
+
+// RestoreDriveItemTombstone restores the deleted item id, which had the path
+// of the drive itself, to its original location
+func (od *OneDrive) RestoreDriveItemTombstone(path, id string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	drivePath := od.OneDriveDescription.RelativePathToDriveRootPath(utils.RegularPath(path))
+	for _, tombstone := range od.DriveCacheCollection.ListTombstones() {
+		if tombstone.ID == id && tombstone.Path == drivePath {
+			return od.RestoreMicrosoftGraphDriveItem(id, "", "")
+		}
+	}
+	return nil, ErrTombstoneNotFound
+}
+
+// addTombstone records the item deleted from the drive root path and drops
+// it from the cache and the index
+func (od *OneDrive) addTombstone(drivePath string, tombstone cache.Tombstone) {
+	tombstone.Path = drivePath
+	od.DriveCacheCollection.AddTombstone(tombstone)
+	odd := od.OneDriveDescription
+	if isSearchDriveRootPath(&odd, drivePath) {
+		od.removeDriveIndexItem(odd.DriveRootPathToRelativePath(drivePath))
+	}
+}
+
+// applyTombstones records the deletions of a page of changes of the delta
+// stream, the items deleted along with their folder are left out, and
+// forgets the tombstones of the items back, it reports whether the drive
+// cache changed
+func (od *OneDrive) applyTombstones(changes []graphapi.MicrosoftGraphDriveItem, activities []activity.Activity) bool {
+	changed := false
+	for _, change := range changes {
+		if change.Deleted == nil && od.DriveCacheCollection.RemoveTombstone(change.ID) {
+			changed = true
+		}
+	}
+	deletedPaths := []string{}
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].Path < activities[j].Path
+	})
+	for _, deleteActivity := range activities {
+		if deleteActivity.Action != activity.ActionDelete {
+			continue
+		}
+		isDeletedWithFolder := false
+		for _, deletedPath := range deletedPaths {
+			if IsSubPath(deleteActivity.Path, deletedPath) {
+				isDeletedWithFolder = true
+				break
+			}
+		}
+		if isDeletedWithFolder {
+			continue
+		}
+		deletedPaths = append(deletedPaths, deleteActivity.Path)
+		od.addTombstone(deleteActivity.Path, cache.Tombstone{
+			ID:        deleteActivity.ItemID,
+			Name:      deleteActivity.Name,
+			IsFolder:  deleteActivity.IsFolder,
+			Size:      deleteActivity.Size,
+			DeletedAt: deleteActivity.Time,
+		})
+		changed = true
+	}
+	return changed
+}
+
+// newTombstone returns the tombstone of the item deleted at now
+func newTombstone(microsoftGraphDriveItem *graphapi.MicrosoftGraphDriveItem, now time.Time) cache.Tombstone {
+	return cache.Tombstone{
+		ID:        microsoftGraphDriveItem.ID,
+		Name:      microsoftGraphDriveItem.Name,
+		IsFolder:  microsoftGraphDriveItem.Folder != nil,
+		Size:      microsoftGraphDriveItem.Size,
+		DeletedAt: now,
+	}
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"log"
+
+	"github.com/AirWSW/onedrive/core/integrity"
+	"github.com/AirWSW/onedrive/core/upload"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// UploadMicrosoftGraphDriveItem uploads size bytes of content to path, a
+// content implementing io.Seeker is uploaded again on hash mismatch
+func (od *OneDrive) UploadMicrosoftGraphDriveItem(path string, size int64, content io.Reader) (*graphapi.MicrosoftGraphDriveItem, error) {
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	_, filename := utils.RegularPathToPathFilename(newPath)
+	if filename == "" {
+		return nil, errors.New("od.UploadMicrosoftGraphDriveItem InvalidPath " + path)
+	}
+	if size == 0 {
+		// Upload sessions do NOT accept empty files
+		microsoftGraphDriveItem, err := od.MicrosoftGraphAPI.PutMicrosoftGraphAPIMeDriveContent(&odd, newPath, content)
+		if err != nil {
+			return nil, err
+		}
+		od.patchMicrosoftGraphDriveItemCache(newPath, microsoftGraphDriveItem)
+		return microsoftGraphDriveItem, nil
+	}
+	driveType := ""
+	if odd.DriveDescription != nil {
+		driveType = odd.DriveDescription.DriveType
+	}
+	hashVerification, retry := false, 0
+	if odd.HashVerification != nil {
+		hashVerification, retry = odd.HashVerification.Upload, odd.HashVerification.Retry
+	}
+	atMicrosoftGraphConflictBehavior := "replace"
+	for attempt := 0; ; attempt++ {
+		uploader, err := upload.NewUploader(&upload.UploaderDescription{
+			HashVerification: hashVerification,
+			UploaderReference: &upload.UploaderReference{
+				DriveType: driveType,
+				Name:      filename,
+				Size:      size,
+				Path:      odd.RelativePathToDriveRootPath(newPath),
+			},
+			UploadableProperties: &graphapi.MicrosoftGraphDriveItemUploadableProperties{
+				Name:                             filename,
+				AtMicrosoftGraphConflictBehavior: &atMicrosoftGraphConflictBehavior,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		od.UploaderCollection.Add(uploader)
+		od.SaveUploaderCollection()
+		microsoftGraphDriveItem, err := uploader.Start(&od.MicrosoftGraphAPI, &uploadCountingReader{content, od.useMetricsDrive()})
+		od.SaveUploaderCollection()
+		if err == nil {
+			od.patchMicrosoftGraphDriveItemCache(newPath, microsoftGraphDriveItem)
+			return microsoftGraphDriveItem, nil
+		}
+		seeker, ok := content.(io.Seeker)
+		if !integrity.IsHashMismatch(err) || !ok || attempt >= retry {
+			return nil, err
+		}
+		log.Println("od.UploadMicrosoftGraphDriveItem", err, "retrying", newPath)
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// CopyMicrosoftGraphDriveItem starts copying the item at path to destination,
+// the returned uploader tracks the async job
+func (od *OneDrive) CopyMicrosoftGraphDriveItem(path, destination string) (*upload.Uploader, error) {
+	sourcePath := od.OneDriveDescription.RelativePathToDriveRootPath(utils.RegularPath(path))
+	return od.startMicrosoftGraphDriveItemCopy(destination, &sourcePath, nil)
+}
+
+// ImportMicrosoftGraphDriveItem starts uploading the content of sourceURL to
+// path, which is only supported by personal drives
+func (od *OneDrive) ImportMicrosoftGraphDriveItem(path, sourceURL string) (*upload.Uploader, error) {
+	return od.startMicrosoftGraphDriveItemCopy(path, nil, &sourceURL)
+}
+
+func (od *OneDrive) startMicrosoftGraphDriveItemCopy(destination string, sourcePath, sourceURL *string) (*upload.Uploader, error) {
+	odd := od.OneDriveDescription
+	newDestination := utils.RegularPath(destination)
+	parentPath, filename := utils.RegularPathToPathFilename(newDestination)
+	if filename == "" {
+		return nil, errors.New("od.startMicrosoftGraphDriveItemCopy InvalidPath " + destination)
+	}
+	parent, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveItem(&odd, odd.RelativePathToDriveRootPath(parentPath))
+	if err != nil {
+		return nil, err
+	}
+	if parent.Folder == nil {
+		return nil, errors.New("od.startMicrosoftGraphDriveItemCopy ParentIsNotFolder " + parentPath)
+	}
+	driveType := ""
+	var driveID *string = nil
+	if odd.DriveDescription != nil {
+		driveType = odd.DriveDescription.DriveType
+		driveID = &odd.DriveDescription.ID
+	}
+	uploader, err := upload.NewUploader(&upload.UploaderDescription{
+		UploaderReference: &upload.UploaderReference{
+			DriveType:  driveType,
+			Name:       filename,
+			Path:       odd.RelativePathToDriveRootPath(newDestination),
+			SourcePath: sourcePath,
+			ParentID:   &parent.ID,
+			DriveID:    driveID,
+		},
+		UploadableProperties: &graphapi.MicrosoftGraphDriveItemUploadableProperties{
+			Name:                      filename,
+			AtMicrosoftGraphSourceURL: sourceURL,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	od.UploaderCollection.Add(uploader)
+	od.SaveUploaderCollection()
+	go func() {
+		err := uploader.Copy(&od.MicrosoftGraphAPI)
+		od.SaveUploaderCollection()
+		if err != nil {
+			return
+		}
+		if err := od.ForceGetMicrosoftGraphDriveItem(newDestination, "copy"); err != nil {
+			log.Println("od.startMicrosoftGraphDriveItemCopy", err)
+		}
+	}()
+	return uploader, nil
+}
+
+// CancelUploader cancels the active upload or copy job with id
+func (od *OneDrive) CancelUploader(id string) error {
+	uploader := od.UploaderCollection.Get(id)
+	if uploader == nil {
+		return errors.New("od.CancelUploader NoUploader " + id)
+	}
+	if err := uploader.Close(); err != nil {
+		return err
+	}
+	od.SaveUploaderCollection()
+	return nil
+}
+
+// CleanUploaderCollection purges orphaned and expired upload sessions
+func (od *OneDrive) CleanUploaderCollection() {
+	od.UploaderCollection.Clean()
+	od.SaveUploaderCollection()
+}
+
+func (od *OneDrive) SaveUploaderCollection() {
+	if od.OneDriveDescription.DriveDescription == nil {
+		return
+	}
+	if err := od.UploaderCollection.Save(od.OneDriveDescription.DriveDescription.ID); err != nil {
+		log.Println("od.SaveUploaderCollection", err)
+	}
+}
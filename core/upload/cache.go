@@ -7,6 +7,8 @@ import (
 	"os"
 )
 
+// Load adds the uploaders of the upload cache file, the uploaders running in
+// this process are kept as they are, such as on restart
 func (uc *UploaderCollection) Load(driveID string) error {
 	uploadCacheFile := driveID + ".upload.json"
 	log.Println("Loading OneDrive upload cache file from " + uploadCacheFile)
@@ -20,10 +22,25 @@ func (uc *UploaderCollection) Load(driveID string) error {
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(bytes, uc)
+	loaded := UploaderCollection{}
+	if err := json.Unmarshal(bytes, &loaded); err != nil {
+		return err
+	}
+	ids := map[string]bool{}
+	for _, uploader := range uc.Uploaders {
+		ids[uploader.UploaderDescription.ID] = true
+	}
+	for _, uploader := range loaded.Uploaders {
+		if uploader.UploaderDescription != nil && !ids[uploader.UploaderDescription.ID] {
+			uc.Uploaders = append(uc.Uploaders, uploader)
+		}
+	}
+	return nil
 }
 
 func (uc *UploaderCollection) Save(driveID string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
 	uploadCache := struct {
 		Uploaders []*Uploader `json:"uploaders"`
 	}{
@@ -37,7 +54,5 @@ func (uc *UploaderCollection) Save(driveID string) error {
 	}
 
 	log.Println("Saving OneDrive upload cache file to " + uploadCacheFile)
-	mutex.Lock()
-	defer mutex.Unlock()
 	return ioutil.WriteFile(uploadCacheFile, bytes, 0644)
 }
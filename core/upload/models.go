@@ -1,6 +1,9 @@
 package upload
 
 import (
+	"context"
+	"sync"
+
 	"github.com/AirWSW/onedrive/graphapi"
 )
 
@@ -8,22 +11,41 @@ type UploaderCollection struct {
 	Uploaders []*Uploader `json:"uploaders"`
 }
 
+// Uploader is changed by its running upload or copy while read by others,
+// the fields are accessed under mutex, see MarshalJSON
 type Uploader struct {
 	UploaderDescription *UploaderDescription `json:"uploaderDescription"`
 	UploadSessions      []UploadSession      `json:"uploadSessions,omitempty"`
+
+	mutex sync.Mutex
+
+	// ctx is nil for uploaders loaded from the upload cache file, which
+	// are orphaned by a previous process
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type UploaderDescription struct {
+	ID                   string                                                `json:"id"`
+	Status               string                                                `json:"status"` // Wait, Uploading, Copying, Finished, Failed, Cancelled
+	CreatedAt            int64                                                 `json:"createdAt"`
+	LastUpdateAt         int64                                                 `json:"lastUpdateAt"`
+	HashVerification     bool                                                  `json:"hashVerification"`
 	UploaderReference    *UploaderReference                                    `json:"uploaderReference"`
 	UploadableProperties *graphapi.MicrosoftGraphDriveItemUploadableProperties `json:"uploadableProperties"`
+	AsyncJobStatus       *graphapi.MicrosoftGraphAsyncJobStatus                `json:"asyncJobStatus,omitempty"`
 }
 
 type UploaderReference struct {
-	DriveType string  `json:"driveType"` // personal, business, documentLibrary
-	Name      string  `json:"name,omitempty"`
-	Size      int64   `json:"size"`
-	Path      string  `json:"path"`
-	UploadURL *string `json:"uploadUrl"`
+	DriveType  string  `json:"driveType"` // personal, business, documentLibrary
+	Name       string  `json:"name,omitempty"`
+	Size       int64   `json:"size"`
+	Path       string  `json:"path"`
+	UploadURL  *string `json:"uploadUrl"`
+	SourcePath *string `json:"sourcePath,omitempty"`
+	ParentID   *string `json:"parentId,omitempty"`
+	DriveID    *string `json:"driveId,omitempty"`
+	MonitorURL *string `json:"monitorUrl,omitempty"`
 }
 
 type UploadSession struct {
@@ -2,125 +2,291 @@ package upload
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/AirWSW/onedrive/core/integrity"
 	"github.com/AirWSW/onedrive/graphapi"
+	uuid "github.com/satori/go.uuid"
 )
 
 var mutex sync.Mutex
 
+// AsyncJobMaxWait bounds the polling of the monitor URL of a copy, the job
+// may still complete on the server afterwards
+var AsyncJobMaxWait = time.Hour
+
 type MicrosoftGraphAPI interface {
 	UseMicrosoftGraphAPIGet(string) ([]byte, error)
 	UseMicrosoftGraphAPIPost(string, io.Reader) ([]byte, error)
 	UseMicrosoftGraphAPIPut(string, io.Reader) ([]byte, error)
+	UseMicrosoftGraphAPIPostAsync(string, io.Reader) (string, error)
 }
 
-func (uc *UploaderCollection) Init(api MicrosoftGraphAPI) error {
-	filename := "01"
-	uploaderReference := &UploaderReference{
-		DriveType: "business",
-		Size:      629145600,
-		Name:      filename,
-		Path:      "/drive/root:/cdn/post/uploader/test/" + filename,
-	}
-	atMicrosoftGraphConflictBehavior := "replace"
-	uploadableProperties := &graphapi.MicrosoftGraphDriveItemUploadableProperties{
-		Name:                             filename,
-		AtMicrosoftGraphConflictBehavior: &atMicrosoftGraphConflictBehavior,
-	}
-	input := &UploaderDescription{
-		UploaderReference:    uploaderReference,
-		UploadableProperties: uploadableProperties,
+func (uc *UploaderCollection) Init(driveID string) error {
+	return uc.Load(driveID)
+}
+
+func (uc *UploaderCollection) Add(u *Uploader) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	uc.Uploaders = append(uc.Uploaders, u)
+}
+
+// List returns a snapshot of all uploaders
+func (uc *UploaderCollection) List() []*Uploader {
+	mutex.Lock()
+	defer mutex.Unlock()
+	uploaders := make([]*Uploader, len(uc.Uploaders))
+	copy(uploaders, uc.Uploaders)
+	return uploaders
+}
+
+// Clean purges orphaned, expired and long finished uploaders, the upload
+// sessions of purged unfinished uploaders are deleted
+func (uc *UploaderCollection) Clean() {
+	now := time.Now()
+	mutex.Lock()
+	uploaders, purged := []*Uploader{}, []*Uploader{}
+	for _, uploader := range uc.Uploaders {
+		if uploader.IsExpired(now) {
+			purged = append(purged, uploader)
+		} else {
+			uploaders = append(uploaders, uploader)
+		}
 	}
-	uploader, err := NewUploader(input)
-	if err != nil {
-		return err
+	uc.Uploaders = uploaders
+	mutex.Unlock()
+	for _, uploader := range purged {
+		status := uploader.useStatus()
+		log.Println("uc.Clean purging uploader", uploader.UploaderDescription.ID, status)
+		if uploader.IsActive() {
+			uploader.Close()
+		} else if status != "Finished" {
+			uploader.deleteUploadSession()
+		}
 	}
-	uploader.Start(api)
-	defer uploader.Close(api)
+}
 
+func (uc *UploaderCollection) Get(id string) *Uploader {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, uploader := range uc.Uploaders {
+		if uploader.UploaderDescription.ID == id {
+			return uploader
+		}
+	}
 	return nil
 }
 
 func NewUploader(input *UploaderDescription) (*Uploader, error) {
+	if input.UploaderReference == nil || input.UploadableProperties == nil {
+		return nil, errors.New("NewUploader InvalidUploaderDescription")
+	}
+	now := time.Now().Unix()
 	uploaderDescription := &UploaderDescription{
+		ID:                   uuid.Must(uuid.NewV4(), nil).String(),
+		Status:               "Wait",
+		CreatedAt:            now,
+		LastUpdateAt:         now,
+		HashVerification:     input.HashVerification,
 		UploaderReference:    input.UploaderReference,
 		UploadableProperties: input.UploadableProperties,
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	uploader := &Uploader{
 		UploaderDescription: uploaderDescription,
+		ctx:                 ctx,
+		cancel:              cancel,
 	}
 	return uploader, nil
 }
 
-func (u *Uploader) Start(api MicrosoftGraphAPI) {
-	uploaderDescription := u.UploaderDescription
-	path := UseMicrosoftGraphAPIMeDrivecreateUploadSessionPath(uploaderDescription.UploaderReference.Path)
-	data, err := json.Marshal(uploaderDescription.UploadableProperties)
-	if err != nil {
-		log.Println(err)
+// MarshalJSON marshals the uploader under its mutex
+func (u *Uploader) MarshalJSON() ([]byte, error) {
+	type uploader Uploader // without MarshalJSON
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return json.Marshal((*uploader)(u))
+}
+
+func (u *Uploader) setStatus(status string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.UploaderDescription.Status = status
+	u.UploaderDescription.LastUpdateAt = time.Now().Unix()
+}
+
+func (u *Uploader) useStatus() string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.UploaderDescription.Status
+}
+
+// setUploadSession records a copy of the upload session of the chunk being
+// uploaded, the copy is NOT changed by the upload
+func (u *Uploader) setUploadSession(uploadSession *UploadSession) {
+	uploadSessionDescription := *uploadSession.UploadSessionDescription
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.UploadSessions = []UploadSession{{&uploadSessionDescription, uploadSession.UploadSessionReference}}
+}
+
+// IsActive reports whether the uploader is still running in this process
+func (u *Uploader) IsActive() bool {
+	if u.ctx == nil || u.ctx.Err() != nil {
+		return false
 	}
-	postBody := bytes.NewReader(data)
-	respBody, err := api.UseMicrosoftGraphAPIPost(path, postBody)
-	if err != nil {
-		log.Println(err)
+	status := u.useStatus()
+	return status == "Wait" || status == "Uploading" || status == "Copying"
+}
+
+// IsExpired reports whether the uploader should be purged, uploaders are
+// kept for an hour after they stopped to let clients query the status
+func (u *Uploader) IsExpired(now time.Time) bool {
+	if u.ctx == nil {
+		return true
 	}
-	log.Println(string(respBody))
-	microsoftGraphUploadSession := &graphapi.MicrosoftGraphUploadSession{}
-	if err := json.Unmarshal(respBody, microsoftGraphUploadSession); err != nil {
-		log.Println(err)
+	u.mutex.Lock()
+	lastUpdateAt := u.UploaderDescription.LastUpdateAt
+	for _, uploadSession := range u.UploadSessions {
+		uploadSessionReference := uploadSession.UploadSessionReference
+		if uploadSessionReference != nil && !uploadSessionReference.ExpirationDateTime.IsZero() && uploadSessionReference.ExpirationDateTime.Before(now) {
+			u.mutex.Unlock()
+			return true
+		}
 	}
-	uploadURL := microsoftGraphUploadSession.UploadURL
-	size := u.UploaderDescription.UploaderReference.Size
-	u.UploaderDescription.UploaderReference.UploadURL = uploadURL
-	uploadSession, err := NewUploadSession(size, microsoftGraphUploadSession)
+	u.mutex.Unlock()
+	if u.IsActive() {
+		return false
+	}
+	return now.Unix()-lastUpdateAt > 3600
+}
+
+// Close cancels the running uploader and deletes its upload session
+func (u *Uploader) Close() error {
+	if !u.IsActive() {
+		return errors.New("u.Close UploaderNotActive " + u.UploaderDescription.ID)
+	}
+	u.cancel()
+	u.setStatus("Cancelled")
+	return u.deleteUploadSession()
+}
+
+func (u *Uploader) deleteUploadSession() error {
+	u.mutex.Lock()
+	uploadURL := u.UploaderDescription.UploaderReference.UploadURL
+	u.mutex.Unlock()
+	if uploadURL == nil {
+		return nil
+	}
+	if err := DeleteUploadSession(*uploadURL); err != nil {
+		log.Println("u.deleteUploadSession", err)
+		return err
+	}
+	return nil
+}
+
+// Start uploads UploaderReference.Size bytes read from content through an
+// upload session and returns the completed item
+func (u *Uploader) Start(api MicrosoftGraphAPI, content io.Reader) (*graphapi.MicrosoftGraphDriveItem, error) {
+	if !u.IsActive() {
+		return nil, errors.New("u.Start UploaderNotActive " + u.UploaderDescription.ID)
+	}
+	u.setStatus("Uploading")
+	microsoftGraphDriveItem, err := u.start(api, content)
 	if err != nil {
-		log.Println(err)
+		if u.ctx.Err() != nil {
+			return nil, errors.New("u.Start Cancelled " + u.UploaderDescription.ID)
+		}
+		u.setStatus("Failed")
+		if microsoftGraphDriveItem == nil {
+			// Never leave an incomplete upload session on the server
+			u.deleteUploadSession()
+		}
+		return nil, err
 	}
-	payload := strings.NewReader(randSeq(uploadSession.UploadSessionDescription.GetContentChunkSizeInt64()))
-	microsoftGraphUploadSession, err = uploadSession.Put(*uploadURL, payload)
+	u.setStatus("Finished")
+	return microsoftGraphDriveItem, nil
+}
+
+func (u *Uploader) start(api MicrosoftGraphAPI, content io.Reader) (*graphapi.MicrosoftGraphDriveItem, error) {
+	uploaderReference := u.UploaderDescription.UploaderReference
+	microsoftGraphUploadSession, err := u.CreateUploadSession(api)
 	if err != nil {
-		log.Println(err)
+		return nil, err
+	}
+	uploadURL := microsoftGraphUploadSession.UploadURL
+	if uploadURL == nil {
+		return nil, errors.New("u.Start NoUploadURL " + uploaderReference.Path)
 	}
+	u.mutex.Lock()
+	uploaderReference.UploadURL = uploadURL
+	u.mutex.Unlock()
+
+	hasher := integrity.NewHasher()
+	content = io.TeeReader(content, hasher)
+	size := uploaderReference.Size
+	offset := int64(0)
 	for {
-		func() {
-			uploadSessions, err := NewUploadSessionsFromRange(size, microsoftGraphUploadSession)
-			if err != nil {
-				log.Println(err)
-			}
-			for _, innerUploadSession := range uploadSessions {
-				innerPayload := strings.NewReader(randSeq(innerUploadSession.UploadSessionDescription.GetContentChunkSizeInt64()))
-				microsoftGraphUploadSession, err = innerUploadSession.Put(*uploadURL, innerPayload)
-				if err != nil {
-					log.Println(err)
+		uploadSession, err := NewUploadSession(size, microsoftGraphUploadSession)
+		if err != nil {
+			return nil, err
+		}
+		usd := uploadSession.UploadSessionDescription
+		if usd.ContentRange.From != offset {
+			return nil, errors.New("u.Start UnexpectedContentRange " + usd.GetContentRange())
+		}
+		u.setUploadSession(uploadSession)
+		payload := io.LimitReader(content, usd.GetContentChunkSizeInt64())
+		newMicrosoftGraphUploadSession, microsoftGraphDriveItem, err := uploadSession.Put(u.ctx, *uploadURL, payload)
+		u.setUploadSession(uploadSession)
+		if err != nil {
+			return nil, err
+		}
+		offset = usd.ContentRange.To + 1
+		if microsoftGraphDriveItem != nil {
+			if u.UploaderDescription.HashVerification && microsoftGraphDriveItem.File != nil {
+				if err := hasher.Verify(microsoftGraphDriveItem.File.Hashes); err != nil {
+					return microsoftGraphDriveItem, err
 				}
 			}
-		}()
+			return microsoftGraphDriveItem, nil
+		}
+		microsoftGraphUploadSession = newMicrosoftGraphUploadSession
 	}
-	log.Println("v")
-
 }
 
-func randSeq(n int64) string {
-	str := "0123456789abcdefghijklmnopqrstuvwxyz"
-	bytes := []byte(str)
-	result := []byte{}
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	for i := int64(0); i < n; i++ {
-		result = append(result, bytes[r.Intn(len(bytes))])
+func (u *Uploader) CreateUploadSession(api MicrosoftGraphAPI) (*graphapi.MicrosoftGraphUploadSession, error) {
+	uploaderDescription := u.UploaderDescription
+	path := UseMicrosoftGraphAPIMeDrivecreateUploadSessionPath(uploaderDescription.UploaderReference.Path)
+	data, err := json.Marshal(struct {
+		Item *graphapi.MicrosoftGraphDriveItemUploadableProperties `json:"item"`
+	}{
+		uploaderDescription.UploadableProperties,
+	})
+	if err != nil {
+		return nil, err
 	}
-	return string(result)
+	respBody, err := api.UseMicrosoftGraphAPIPost(path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	microsoftGraphUploadSession := &graphapi.MicrosoftGraphUploadSession{}
+	if err := json.Unmarshal(respBody, microsoftGraphUploadSession); err != nil {
+		return nil, err
+	}
+	return microsoftGraphUploadSession, nil
 }
 
 func NewUploadSession(size int64, microsoftGraphUploadSession *graphapi.MicrosoftGraphUploadSession) (*UploadSession, error) {
@@ -128,6 +294,9 @@ func NewUploadSession(size int64, microsoftGraphUploadSession *graphapi.Microsof
 	if err != nil {
 		return nil, err
 	}
+	if len(uploadSessions) == 0 {
+		return nil, errors.New("NewUploadSession NoNextExpectedRanges")
+	}
 	return &uploadSessions[0], nil
 }
 
@@ -140,7 +309,7 @@ func NewUploadSessionsFromRange(size int64, microsoftGraphUploadSession *graphap
 			return nil, err
 		}
 		to := int64(-1)
-		if rangeStr[1] != "" {
+		if len(rangeStr) > 1 && rangeStr[1] != "" {
 			to, err = strconv.ParseInt(rangeStr[1], 10, 64)
 			if err != nil {
 				return nil, err
@@ -165,52 +334,195 @@ func NewUploadSessionsFromRange(size int64, microsoftGraphUploadSession *graphap
 	return uploadSessions, nil
 }
 
-func (us *UploadSession) Put(url string, payload io.Reader) (*graphapi.MicrosoftGraphUploadSession, error) {
-	req, err := http.NewRequest("PUT", url, payload)
+// Put uploads one chunk, the upload session is returned while more ranges
+// are expected and the drive item is returned once the upload completed
+func (us *UploadSession) Put(ctx context.Context, url string, payload io.Reader) (*graphapi.MicrosoftGraphUploadSession, *graphapi.MicrosoftGraphDriveItem, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, payload)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	usd := us.UploadSessionDescription
 	log.Println("Content-Length: "+usd.GetContentChunkSize(), "Content-Range: "+usd.GetContentRange())
-	req.Header.Add("Content-Length", usd.GetContentChunkSize())
+	req.ContentLength = usd.GetContentChunkSizeInt64()
 	req.Header.Add("Content-Range", usd.GetContentRange())
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+		microsoftGraphDriveItem := graphapi.MicrosoftGraphDriveItem{}
+		if err := json.Unmarshal(body, &microsoftGraphDriveItem); err != nil {
+			return nil, nil, err
+		}
+		us.UploadSessionDescription.Status = "Finished"
+		return nil, &microsoftGraphDriveItem, nil
 	}
-	log.Println(string(body))
 	if resp.StatusCode < http.StatusBadRequest {
 		microsoftGraphUploadSession := graphapi.MicrosoftGraphUploadSession{}
 		if err := json.Unmarshal(body, &microsoftGraphUploadSession); err != nil {
-			log.Println(err)
+			return nil, nil, err
 		}
 		us.UploadSessionDescription.Status = "Finished"
-		return &microsoftGraphUploadSession, nil
+		return &microsoftGraphUploadSession, nil, nil
 	}
-	if resp.StatusCode < http.StatusInternalServerError {
-		return nil, errors.New(http.StatusText(resp.StatusCode))
-	}
-	return nil, errors.New(http.StatusText(resp.StatusCode))
+	us.UploadSessionDescription.Status = "Failed"
+	log.Println("us.Put PUT "+http.StatusText(resp.StatusCode)+", error payload: ", string(body))
+	return nil, nil, errors.New(http.StatusText(resp.StatusCode))
 }
 
-func (u *Uploader) Copy(api MicrosoftGraphAPI) {
+// Copy copies the item at UploaderReference.SourcePath, or imports the
+// UploadableProperties.AtMicrosoftGraphSourceURL on personal drives, into
+// UploaderReference.ParentID and waits until the async job finished
+func (u *Uploader) Copy(api MicrosoftGraphAPI) error {
+	if !u.IsActive() {
+		return errors.New("u.Copy UploaderNotActive " + u.UploaderDescription.ID)
+	}
+	u.setStatus("Copying")
+	if err := u.copy(api); err != nil {
+		log.Println("u.Copy", err)
+		if u.ctx.Err() == nil {
+			u.setStatus("Failed")
+		}
+		return err
+	}
+	u.setStatus("Finished")
+	return nil
+}
 
+func (u *Uploader) copy(api MicrosoftGraphAPI) error {
+	uploaderReference := u.UploaderDescription.UploaderReference
+	uploadableProperties := u.UploaderDescription.UploadableProperties
+	if uploaderReference.ParentID == nil {
+		return errors.New("u.Copy NoParentID " + uploaderReference.Path)
+	}
+	path, data := "", []byte{}
+	var err error = nil
+	if uploadableProperties.AtMicrosoftGraphSourceURL != nil {
+		if uploaderReference.DriveType != "personal" {
+			return errors.New("u.Copy SourceURLOnlySupportedByPersonalDrive " + uploaderReference.DriveType)
+		}
+		path = UseMicrosoftGraphAPIMeDriveItemChildrenPath(*uploaderReference.ParentID)
+		data, err = json.Marshal(struct {
+			AtMicrosoftGraphSourceURL string                       `json:"@microsoft.graph.sourceUrl"`
+			Name                      string                       `json:"name"`
+			File                      *graphapi.MicrosoftGraphFile `json:"file"`
+		}{
+			*uploadableProperties.AtMicrosoftGraphSourceURL,
+			uploadableProperties.Name,
+			&graphapi.MicrosoftGraphFile{},
+		})
+	} else if uploaderReference.SourcePath != nil {
+		parentReference := struct {
+			DriveID *string `json:"driveId,omitempty"`
+			ID      string  `json:"id"`
+		}{
+			uploaderReference.DriveID,
+			*uploaderReference.ParentID,
+		}
+		path = UseMicrosoftGraphAPIMeDriveCopyPath(*uploaderReference.SourcePath)
+		data, err = json.Marshal(struct {
+			ParentReference interface{} `json:"parentReference"`
+			Name            string      `json:"name"`
+		}{
+			parentReference,
+			uploadableProperties.Name,
+		})
+	} else {
+		return errors.New("u.Copy NoSource " + uploaderReference.Path)
+	}
+	if err != nil {
+		return err
+	}
+	monitorURL, err := api.UseMicrosoftGraphAPIPostAsync(path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	u.mutex.Lock()
+	uploaderReference.MonitorURL = &monitorURL
+	u.mutex.Unlock()
+	return u.WaitAsyncJob(monitorURL)
 }
 
-func (u *Uploader) Close(api MicrosoftGraphAPI) {
+// WaitAsyncJob polls the monitor URL until the async job completed or failed,
+// for AsyncJobMaxWait at most, closing the uploader stops polling but can NOT
+// stop the job on the server
+func (u *Uploader) WaitAsyncJob(monitorURL string) error {
+	ctx := u.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, AsyncJobMaxWait)
+	defer cancel()
+	interval := time.Second
+	for {
+		microsoftGraphAsyncJobStatus, err := graphapi.GetMicrosoftGraphAsyncJobStatus(monitorURL)
+		if err != nil {
+			return err
+		}
+		u.mutex.Lock()
+		u.UploaderDescription.AsyncJobStatus = microsoftGraphAsyncJobStatus
+		u.mutex.Unlock()
+		switch microsoftGraphAsyncJobStatus.Status {
+		case "completed":
+			return nil
+		case "failed", "deleteFailed":
+			if microsoftGraphAsyncJobStatus.StatusDescription != nil {
+				return errors.New("u.WaitAsyncJob Failed " + *microsoftGraphAsyncJobStatus.StatusDescription)
+			}
+			return errors.New("u.WaitAsyncJob Failed " + monitorURL)
+		}
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return errors.New("u.WaitAsyncJob TimedOut " + monitorURL)
+			}
+			return errors.New("u.WaitAsyncJob Cancelled " + monitorURL)
+		case <-time.After(interval):
+		}
+		if interval < 10*time.Second {
+			interval *= 2
+		}
+	}
+}
 
+// DeleteUploadSession cancels an upload session, the upload URL is
+// pre-authenticated and must NOT receive the Authorization header
+func DeleteUploadSession(uploadURL string) error {
+	req, err := http.NewRequest("DELETE", uploadURL, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusBadRequest || resp.StatusCode == http.StatusNotFound {
+		log.Println("DeleteUploadSession DELETE " + uploadURL)
+		return nil
+	}
+	return errors.New(http.StatusText(resp.StatusCode))
 }
 
 func UseMicrosoftGraphAPIMeDrivecreateUploadSessionPath(str string) string {
 	return "/me" + str + ":/createUploadSession"
 }
 
+func UseMicrosoftGraphAPIMeDriveCopyPath(str string) string {
+	return "/me" + str + ":/copy"
+}
+
+func UseMicrosoftGraphAPIMeDriveItemChildrenPath(id string) string {
+	return "/me/drive/items/" + id + "/children"
+}
+
 func (usd *UploadSessionDescription) SetContentRangTo() int64 {
 	cr := usd.ContentRange
 	if cr.To < 0 {
@@ -0,0 +1,123 @@
+package upload
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestNewUploadSessionsFromRange(t *testing.T) {
+	microsoftGraphUploadSession := &graphapi.MicrosoftGraphUploadSession{
+		NextExpectedRanges: []string{"0-", "20971520-20971529"},
+	}
+	uploadSessions, err := NewUploadSessionsFromRange(52428800, microsoftGraphUploadSession)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(uploadSessions) != 2 {
+		t.Fatalf("got %d upload sessions, want 2", len(uploadSessions))
+	}
+	if got := uploadSessions[0].UploadSessionDescription.GetContentRange(); got != "bytes 0-20971519/52428800" {
+		t.Errorf("got %s", got)
+	}
+	if got := uploadSessions[1].UploadSessionDescription.GetContentChunkSize(); got != "10" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestUploaderIsExpired(t *testing.T) {
+	uploader, err := NewUploader(&UploaderDescription{
+		UploaderReference:    &UploaderReference{},
+		UploadableProperties: &graphapi.MicrosoftGraphDriveItemUploadableProperties{},
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	now := time.Now()
+	if uploader.IsExpired(now) {
+		t.Errorf("new uploader should not expire")
+	}
+	uploader.UploadSessions = []UploadSession{{
+		UploadSessionReference: &graphapi.MicrosoftGraphUploadSession{
+			ExpirationDateTime: now.Add(-time.Minute),
+		},
+	}}
+	if !uploader.IsExpired(now) {
+		t.Errorf("uploader with expired upload session should expire")
+	}
+	if !(&Uploader{UploaderDescription: &UploaderDescription{Status: "Uploading"}}).IsExpired(now) {
+		t.Errorf("orphaned uploader should expire")
+	}
+	if err := uploader.Close(); err != nil {
+		t.Errorf("%s", err)
+	}
+	if uploader.IsActive() || uploader.UploaderDescription.Status != "Cancelled" {
+		t.Errorf("closed uploader should be cancelled")
+	}
+}
+
+func TestUploaderWaitAsyncJob(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"inProgress","percentageComplete":50}`))
+	}))
+	defer server.Close()
+	uploader, err := NewUploader(&UploaderDescription{
+		UploaderReference:    &UploaderReference{},
+		UploadableProperties: &graphapi.MicrosoftGraphDriveItemUploadableProperties{},
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func(asyncJobMaxWait time.Duration) { AsyncJobMaxWait = asyncJobMaxWait }(AsyncJobMaxWait)
+	AsyncJobMaxWait = 50 * time.Millisecond
+
+	// The uploader is marshalled while the job is polled
+	done := make(chan error)
+	go func() { done <- uploader.WaitAsyncJob(server.URL) }()
+	for i := 0; i < 10; i++ {
+		if _, err := json.Marshal(uploader); err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "TimedOut") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestUploaderCollectionLoad(t *testing.T) {
+	driveID := filepath.Join(t.TempDir(), "drive")
+	running, err := NewUploader(&UploaderDescription{
+		UploaderReference:    &UploaderReference{},
+		UploadableProperties: &graphapi.MicrosoftGraphDriveItemUploadableProperties{},
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	uc := &UploaderCollection{}
+	uc.Add(running)
+	uc.Add(&Uploader{UploaderDescription: &UploaderDescription{ID: "orphaned", Status: "Uploading"}})
+	if err := uc.Save(driveID); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Loading again keeps the running uploader
+	if err := uc.Load(driveID); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if uploaders := uc.List(); len(uploaders) != 2 || uploaders[0] != running || !running.IsActive() {
+		t.Errorf("got %v", uploaders)
+	}
+	loaded := &UploaderCollection{}
+	if err := loaded.Load(driveID); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if uploader := loaded.Get("orphaned"); uploader == nil || uploader.IsActive() {
+		t.Errorf("got %v", uploader)
+	}
+}
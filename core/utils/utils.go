@@ -70,3 +70,52 @@ func RegularRootPath(str string) (path string) {
 	}
 	return path
 }
+
+// NaturalLess compares a and b case-insensitively with runs of digits compared
+// by their numeric values, so "Episode 2" sorts before "Episode 10"
+func NaturalLess(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := digitsPrefixLength(a), digitsPrefixLength(b)
+			numberA, numberB := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(numberA) != len(numberB) {
+				return len(numberA) < len(numberB)
+			}
+			if numberA != numberB {
+				return numberA < numberB
+			}
+			if i != j {
+				return i < j
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func digitsPrefixLength(str string) int {
+	i := 0
+	for i < len(str) && isDigit(str[i]) {
+		i++
+	}
+	return i
+}
+
+// EscapePath escapes each segment of path for use in a URL
+func EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+var (
+	ErrVersionIDInvalid    = errors.New("VersionIDInvalid")
+	ErrVersionNotSupported = errors.New("VersionNotSupported")
+)
+
+// GetMicrosoftGraphDriveItemVersions lists the versions of the file at path of
+// the drive itself, the current version first
+func (od *OneDrive) GetMicrosoftGraphDriveItemVersions(path string) ([]graphapi.MicrosoftGraphDriveItemVersion, error) {
+	if od.IsNamespace() {
+		return nil, ErrVersionNotSupported
+	}
+	odd := od.OneDriveDescription
+	return od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveVersions(&odd, odd.RelativePathToDriveRootPath(utils.RegularPath(path)))
+}
+
+// GetMicrosoftGraphDriveItemVersionContentURL returns the short-lived download
+// URL of the version id of the file at path of the drive itself
+func (od *OneDrive) GetMicrosoftGraphDriveItemVersionContentURL(path, id string) (string, error) {
+	if id == "" {
+		return "", ErrVersionIDInvalid
+	}
+	if od.IsNamespace() {
+		return "", ErrVersionNotSupported
+	}
+	odd := od.OneDriveDescription
+	return od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveVersionContentURL(&odd, odd.RelativePathToDriveRootPath(utils.RegularPath(path)), id)
+}
+
+// GetMicrosoftGraphDriveItemVersionContentResponse requests the content of the
+// version id of the file at path with the ProxyRequestHeaders of header, the
+// content of versions is NOT verified as their hashes are unknown
+func (od *OneDrive) GetMicrosoftGraphDriveItemVersionContentResponse(path, id string, header http.Header) (*http.Response, error) {
+	downloadURL, err := od.GetMicrosoftGraphDriveItemVersionContentURL(path, id)
+	if err != nil {
+		return nil, err
+	}
+	return requestMicrosoftGraphDownloadURL(downloadURL, header)
+}
+
+// RestoreMicrosoftGraphDriveItemVersion makes the version id the current
+// version of the file at path, which is a new version itself, and returns the
+// restored item put into the cache
+func (od *OneDrive) RestoreMicrosoftGraphDriveItemVersion(path, id string) (*graphapi.MicrosoftGraphDriveItem, error) {
+	if id == "" {
+		return nil, ErrVersionIDInvalid
+	}
+	if od.IsNamespace() {
+		return nil, ErrVersionNotSupported
+	}
+	odd := od.OneDriveDescription
+	newPath := utils.RegularPath(path)
+	drivePath := odd.RelativePathToDriveRootPath(newPath)
+	if err := od.MicrosoftGraphAPI.PostMicrosoftGraphAPIMeDriveVersionRestore(&odd, drivePath, id); err != nil {
+		return nil, err
+	}
+	microsoftGraphDriveItem, err := od.MicrosoftGraphAPI.GetMicrosoftGraphAPIMeDriveItem(&odd, drivePath)
+	if err != nil {
+		return nil, err
+	}
+	od.patchMicrosoftGraphDriveItemCache(newPath, microsoftGraphDriveItem)
+	return microsoftGraphDriveItem, nil
+}
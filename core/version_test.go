@@ -0,0 +1,54 @@
+package core
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestMicrosoftGraphDriveItemVersions(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" && r.URL.Path != "/download" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1.0/me/drive/root:/notes.txt:/versions":
+			w.Write([]byte(`{"value":[{"id":"2.0","size":5},{"id":"1.0","size":3}]}`))
+		case "/v1.0/me/drive/root:/notes.txt:/versions/1.0/content":
+			http.Redirect(w, r, server.URL+"/download", http.StatusFound)
+		case "/download":
+			w.Write([]byte("old"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	od := &OneDrive{OneDriveDescription: description.OneDriveDescription{RootPath: "root"}}
+	od.MicrosoftGraphAPI.MicrosoftEndPoints.MicrosoftGraphAPIEndPointURL = server.URL
+	od.MicrosoftGraphAPI.MicrosoftGraphAPIToken = &graphapi.MicrosoftGraphAPIToken{TokenType: "Bearer", AccessToken: "token"}
+
+	versions, err := od.GetMicrosoftGraphDriveItemVersions("/notes.txt")
+	if err != nil || len(versions) != 2 || versions[1].ID != "1.0" || versions[1].Size != 3 {
+		t.Fatalf("got %+v %v", versions, err)
+	}
+	resp, err := od.GetMicrosoftGraphDriveItemVersionContentResponse("/notes.txt", "1.0", http.Header{})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer resp.Body.Close()
+	if content, _ := ioutil.ReadAll(resp.Body); string(content) != "old" {
+		t.Errorf("got %s", content)
+	}
+	if _, err := od.GetMicrosoftGraphDriveItemVersionContentURL("/notes.txt", "9.0"); err == nil {
+		t.Error("got no error")
+	}
+	if _, err := od.RestoreMicrosoftGraphDriveItemVersion("/notes.txt", ""); err != ErrVersionIDInvalid {
+		t.Errorf("got %v", err)
+	}
+}
@@ -16,10 +16,11 @@ type NewMicrosoftGraphAPIInput struct {
 }
 
 type MicrosoftGraphAPI struct {
-	MicrosoftEndPoints     MicrosoftEndPoints      `json:"microsoftEndPoints"`
-	AzureADAppRegistration AzureADAppRegistration  `json:"azureAdAppRegistration"`
-	AzureADAuthFlowContext AzureADAuthFlowContext  `json:"azureAdAuthFlowContext"`
-	MicrosoftGraphAPIToken *MicrosoftGraphAPIToken `json:"microsoftGraphApiToken,omitempty"`
+	MicrosoftEndPoints     MicrosoftEndPoints       `json:"microsoftEndPoints"`
+	AzureADAppRegistration AzureADAppRegistration   `json:"azureAdAppRegistration"`
+	AzureADAuthFlowContext AzureADAuthFlowContext   `json:"azureAdAuthFlowContext"`
+	MicrosoftGraphAPIToken *MicrosoftGraphAPIToken  `json:"microsoftGraphApiToken,omitempty"`
+	Status                 *MicrosoftGraphAPIStatus `json:"-"`
 }
 
 type MicrosoftEndPoints struct {
@@ -456,6 +457,12 @@ type MicrosoftGraphVersionAction struct {
 	NewVersion string `json:"newVersion"`
 }
 
+// MicrosoftGraphItemActivityCollection is a page of item activities
+type MicrosoftGraphItemActivityCollection struct {
+	Value           []MicrosoftGraphItemActivity `json:"value"`
+	AtODataNextLink *string                      `json:"@odata.nextLink,omitempty"`
+}
+
 // MicrosoftGraphListItem "@odata.type": "microsoft.graph.listItem"
 type MicrosoftGraphListItem struct {
 	ContentType   *MicrosoftGraphContentTypeInfo `json:"contentType,omitempty"`
@@ -520,6 +527,14 @@ type MicrosoftGraphPermission struct {
 	Link                *MicrosoftGraphSharingLink       `json:"link,omitempty"`
 	Roles               []string                         `json:"roles"` // read, write, sp.owner, sp.member
 	ShareID             string                           `json:"shareId"`
+	ExpirationDateTime  *time.Time                       `json:"expirationDateTime,omitempty"`
+	HasPassword         *bool                            `json:"hasPassword,omitempty"`
+}
+
+// MicrosoftGraphPermissionCollection is a page of permissions
+type MicrosoftGraphPermissionCollection struct {
+	Value           []MicrosoftGraphPermission `json:"value"`
+	AtODataNextLink *string                    `json:"@odata.nextLink,omitempty"`
 }
 
 // MicrosoftGraphSharingInvitation "@odata.type": "microsoft.graph.sharingInvitation"
@@ -531,11 +546,12 @@ type MicrosoftGraphSharingInvitation struct {
 
 // MicrosoftGraphSharingLink "@odata.type": "microsoft.graph.sharingLink"
 type MicrosoftGraphSharingLink struct {
-	Application *MicrosoftGraphIdentity `json:"application,omitempty"`
-	Type        string                  `json:"type"`  // view, edit, embed
-	Scope       string                  `json:"scope"` // anonymous, organization
-	WebHTML     string                  `json:"webHtml"`
-	WebURL      string                  `json:"webUrl"`
+	Application      *MicrosoftGraphIdentity `json:"application,omitempty"`
+	Type             string                  `json:"type"`  // view, edit, embed
+	Scope            string                  `json:"scope"` // anonymous, organization, users
+	WebHTML          string                  `json:"webHtml"`
+	WebURL           string                  `json:"webUrl"`
+	PreventsDownload bool                    `json:"preventsDownload,omitempty"`
 }
 
 // MicrosoftGraphThumbnailSet "@odata.type": "microsoft.graph.thumbnailSet"
@@ -563,7 +579,13 @@ type MicrosoftGraphDriveItemVersion struct {
 	LastModifiedBy       *MicrosoftGraphIdentitySet      `json:"lastModifiedBy,omitempty"`
 	LastModifiedDateTime *time.Time                      `json:"lastModifiedDateTime,omitempty"`
 	Publication          *MicrosoftGraphPublicationFacet `json:"publication,omitempty"`
-	Height               int32                           `json:"height"`
+	Size                 int64                           `json:"size"`
+}
+
+// MicrosoftGraphDriveItemVersionCollection is a page of versions
+type MicrosoftGraphDriveItemVersionCollection struct {
+	Value           []MicrosoftGraphDriveItemVersion `json:"value"`
+	AtODataNextLink *string                          `json:"@odata.nextLink,omitempty"`
 }
 
 // MicrosoftGraphDrive  "@odata.type": "microsoft.graph.drive"
@@ -615,13 +637,22 @@ type MicrosoftGraphUploadSession struct {
 	UploadURL          *string   `json:"uploadUrl"`
 }
 
+// MicrosoftGraphAsyncJobStatus "@odata.type": "microsoft.graph.asyncJobStatus"
+type MicrosoftGraphAsyncJobStatus struct {
+	Operation          string  `json:"operation"` // itemCopy, download
+	PercentageComplete float64 `json:"percentageComplete"`
+	ResourceID         string  `json:"resourceId"`
+	Status             string  `json:"status"` // notStarted, inProgress, completed, updating, failed, deletePending, deleteFailed, waiting
+	StatusDescription  *string `json:"statusDescription,omitempty"`
+}
+
 // MicrosoftGraphDriveItemUploadableProperties  "@odata.type": "microsoft.graph.driveItemUploadableProperties"
 type MicrosoftGraphDriveItemUploadableProperties struct {
 	Description    *string                       `json:"description,omitempty"`
-	FileSize       *int64                        `json:"fileSize"`
+	FileSize       *int64                        `json:"fileSize,omitempty"`
 	FileSystemInfo *MicrosoftGraphFileSystemInfo `json:"fileSystemInfo,omitempty"`
 	Name           string                        `json:"name"`
 
-	AtMicrosoftGraphConflictBehavior *string `json:"@microsoft.graph.conflictBehavior"` // rename, fail, replace
-	AtMicrosoftGraphSourceURL        *string `json:"@microsoft.graph.sourceUrl"`
+	AtMicrosoftGraphConflictBehavior *string `json:"@microsoft.graph.conflictBehavior,omitempty"` // rename, fail, replace
+	AtMicrosoftGraphSourceURL        *string `json:"@microsoft.graph.sourceUrl,omitempty"`
 }
@@ -9,12 +9,16 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
+
+	"github.com/AirWSW/onedrive/metrics"
 )
 
 // NewMicrosoftGraphAPI validates NewMicrosoftGraphAPIInput and assigns to api
 func NewMicrosoftGraphAPI(input *NewMicrosoftGraphAPIInput) (*MicrosoftGraphAPI, error) {
 	api := &MicrosoftGraphAPI{
 		MicrosoftGraphAPIToken: &MicrosoftGraphAPIToken{},
+		Status:                 &MicrosoftGraphAPIStatus{},
 	}
 
 	// Validation input MicrosoftEndPoints and assign to api
@@ -162,6 +166,7 @@ func (api *MicrosoftGraphAPI) getMicrosoftGraphAPITokenRequest(str string) error
 			if err := api.MicrosoftGraphAPIToken.Set(newMicrosoftGraphAPIToken); err != nil {
 				return err
 			}
+			api.Status.setToken(newMicrosoftGraphAPIToken.ExpiresIn, time.Now())
 			log.Println("api.getMicrosoftGraphAPITokenRequest GET " + postAzureADTokenEndPointURL)
 			// Bind api.MicrosoftGraphAPIToken.RefreshToken to api.AzureADAuthFlowContext.RefreshToken
 			return api.AzureADAuthFlowContext.SetRefreshToken(api.MicrosoftGraphAPIToken.RefreshToken)
@@ -182,9 +187,13 @@ func (api *MicrosoftGraphAPI) GetMicrosoftGraphAPIToken() error {
 	azureADAppRegistration := api.AzureADAppRegistration
 	if azureADAuthFlowContext.RefreshToken != nil || azureADAuthFlowContext.Code != nil {
 		for _, redirectURI := range azureADAppRegistration.RedirectURIs {
-			if err := api.getMicrosoftGraphAPITokenRequest(redirectURI); err == nil {
+			err := api.getMicrosoftGraphAPITokenRequest(redirectURI)
+			if err == nil {
+				metrics.TokenRefreshes.Inc("success")
 				return nil
 			}
+			metrics.TokenRefreshes.Inc("failure")
+			api.Status.setTokenError(err)
 		}
 	}
 	// If both RefreshToken and Code are invalid, log error and return authorize urls
@@ -210,14 +219,14 @@ func (api *MicrosoftGraphAPI) newMicrosoftGraphAPIRequest(method, reqURL string,
 		return nil, err
 	}
 	req.Header.Add("Authorization", api.MicrosoftGraphAPIToken.GetAuthorizationString())
-	if method == "POST" {
+	if method == "POST" || method == "PATCH" {
 		req.Header.Add("Content-Type", "application/json")
 	}
 	return req, nil
 }
 
 func (api *MicrosoftGraphAPI) useMicrosoftGraphAPIRequest(method, reqURL string, payload io.Reader) ([]byte, error) {
-	if !(method == "GET" || method == "POST" || method == "PUT") {
+	if !(method == "GET" || method == "POST" || method == "PUT" || method == "PATCH" || method == "DELETE") {
 		return nil, errors.New("NotSupportMicrosoftGraphAPIRequestMethod")
 	}
 	req, err := api.newMicrosoftGraphAPIRequest(method, reqURL, payload)
@@ -226,7 +235,7 @@ func (api *MicrosoftGraphAPI) useMicrosoftGraphAPIRequest(method, reqURL string,
 	}
 
 	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := api.doMicrosoftGraphAPIRequest(client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -303,3 +312,166 @@ func (api *MicrosoftGraphAPI) useMicrosoftGraphAPIPutRequest(str string, payload
 func (api *MicrosoftGraphAPI) UseMicrosoftGraphAPIPut(str string, payload io.Reader) ([]byte, error) {
 	return api.useMicrosoftGraphAPIPutRequest(str, payload)
 }
+
+func (api *MicrosoftGraphAPI) useMicrosoftGraphAPIPatchRequest(str string, payload io.Reader) ([]byte, error) {
+	// New request
+	reqURL := api.MicrosoftEndPoints.UseMicrosoftGraphAPIEndPointURL(str)
+	strURL, err := url.Parse(str)
+	if err != nil {
+		return nil, err
+	}
+	if strURL.Scheme == "https" {
+		reqURL = str
+	}
+	return api.useMicrosoftGraphAPIRequest("PATCH", reqURL, payload)
+}
+
+func (api *MicrosoftGraphAPI) UseMicrosoftGraphAPIPatch(str string, payload io.Reader) ([]byte, error) {
+	return api.useMicrosoftGraphAPIPatchRequest(str, payload)
+}
+
+func (api *MicrosoftGraphAPI) useMicrosoftGraphAPIDeleteRequest(str string) ([]byte, error) {
+	// New request
+	reqURL := api.MicrosoftEndPoints.UseMicrosoftGraphAPIEndPointURL(str)
+	strURL, err := url.Parse(str)
+	if err != nil {
+		return nil, err
+	}
+	if strURL.Scheme == "https" {
+		reqURL = str
+	}
+	return api.useMicrosoftGraphAPIRequest("DELETE", reqURL, nil)
+}
+
+func (api *MicrosoftGraphAPI) UseMicrosoftGraphAPIDelete(str string) ([]byte, error) {
+	return api.useMicrosoftGraphAPIDeleteRequest(str)
+}
+
+func (api *MicrosoftGraphAPI) useMicrosoftGraphAPIPostAsyncRequest(str string, payload io.Reader) (string, error) {
+	// New request
+	reqURL := api.MicrosoftEndPoints.UseMicrosoftGraphAPIEndPointURL(str)
+	strURL, err := url.Parse(str)
+	if err != nil {
+		return "", err
+	}
+	if strURL.Scheme == "https" {
+		reqURL = str
+	}
+	req, err := api.newMicrosoftGraphAPIRequest("POST", reqURL, payload)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Prefer", "respond-async")
+
+	client := &http.Client{}
+	resp, err := api.doMicrosoftGraphAPIRequest(client, req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		log.Println("api.useMicrosoftGraphAPIPostAsyncRequest POST " + reqURL)
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return "", errors.New("api.useMicrosoftGraphAPIPostAsyncRequest POST NoLocationFrom " + reqURL)
+		}
+		return location, nil
+	}
+	log.Println("api.useMicrosoftGraphAPIPostAsyncRequest POST " + http.StatusText(resp.StatusCode) + " " + reqURL + ", error payload: " + string(body))
+	return "", errors.New(http.StatusText(resp.StatusCode))
+}
+
+// UseMicrosoftGraphAPIPostAsync posts a long running action and returns the
+// monitor URL from the Location header
+func (api *MicrosoftGraphAPI) UseMicrosoftGraphAPIPostAsync(str string, payload io.Reader) (string, error) {
+	return api.useMicrosoftGraphAPIPostAsyncRequest(str, payload)
+}
+
+func (api *MicrosoftGraphAPI) useMicrosoftGraphAPIGetRedirectRequest(str string) (string, error) {
+	// New request
+	reqURL := api.MicrosoftEndPoints.UseMicrosoftGraphAPIEndPointURL(str)
+	strURL, err := url.Parse(str)
+	if err != nil {
+		return "", err
+	}
+	if strURL.Scheme == "https" {
+		reqURL = str
+	}
+	req, err := api.newMicrosoftGraphAPIRequest("GET", reqURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := api.doMicrosoftGraphAPIRequest(client, req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusFound || resp.StatusCode == http.StatusSeeOther || resp.StatusCode == http.StatusTemporaryRedirect {
+		log.Println("api.useMicrosoftGraphAPIGetRedirectRequest GET " + reqURL)
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return "", errors.New("api.useMicrosoftGraphAPIGetRedirectRequest GET NoLocationFrom " + reqURL)
+		}
+		return location, nil
+	}
+	log.Println("api.useMicrosoftGraphAPIGetRedirectRequest GET " + http.StatusText(resp.StatusCode) + " " + reqURL + ", error payload: " + string(body))
+	return "", errors.New(http.StatusText(resp.StatusCode))
+}
+
+// UseMicrosoftGraphAPIGetRedirect gets a content and returns the pre-authenticated
+// download URL from the Location header instead of following it
+func (api *MicrosoftGraphAPI) UseMicrosoftGraphAPIGetRedirect(str string) (string, error) {
+	return api.useMicrosoftGraphAPIGetRedirectRequest(str)
+}
+
+// GetMicrosoftGraphAsyncJobStatus gets the status of a long running action,
+// the monitor URL does NOT require authentication
+func GetMicrosoftGraphAsyncJobStatus(monitorURL string) (*MicrosoftGraphAsyncJobStatus, error) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// The completed job redirects to the item which requires authentication
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(monitorURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		log.Println("GetMicrosoftGraphAsyncJobStatus GET " + http.StatusText(resp.StatusCode) + " " + monitorURL + ", error payload: " + string(body))
+		return nil, errors.New(http.StatusText(resp.StatusCode))
+	}
+	microsoftGraphAsyncJobStatus := &MicrosoftGraphAsyncJobStatus{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, microsoftGraphAsyncJobStatus); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode == http.StatusSeeOther {
+		microsoftGraphAsyncJobStatus.Status = "completed"
+		microsoftGraphAsyncJobStatus.PercentageComplete = 100
+	}
+	return microsoftGraphAsyncJobStatus, nil
+}
@@ -1,6 +1,11 @@
 package graphapi
 
-import uuid "github.com/satori/go.uuid"
+import (
+	"net/url"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
 
 func (e *MicrosoftEndPoints) Set(input *MicrosoftEndPoints) error {
 	e.AzureADPortalEndPointURL = input.AzureADPortalEndPointURL
@@ -25,6 +30,22 @@ func (e *MicrosoftEndPoints) UseMicrosoftGraphAPIEndPointURL(str string) string
 	return e.GetMicrosoftGraphAPIEndPointURL() + str
 }
 
+// IsMicrosoftGraphAPIEndPointURL reports whether str is an absolute URL on
+// the Microsoft Graph endpoint, the only host the access token may be sent to
+func (e *MicrosoftEndPoints) IsMicrosoftGraphAPIEndPointURL(str string) bool {
+	strURL, err := url.Parse(str)
+	if err != nil || e.MicrosoftGraphAPIEndPointURL == "" {
+		return false
+	}
+	return strings.EqualFold(strURL.Scheme+"://"+strURL.Host, e.MicrosoftGraphAPIEndPointURL) && strURL.User == nil
+}
+
+// UseMicrosoftGraphAPIBetaEndPointURL addresses str on the beta endpoint, for
+// the APIs missing from v1.0
+func (e *MicrosoftEndPoints) UseMicrosoftGraphAPIBetaEndPointURL(str string) string {
+	return e.MicrosoftGraphAPIEndPointURL + "/beta" + str
+}
+
 func (r *AzureADAppRegistration) Set(input *AzureADAppRegistration) error {
 	r.DisplayName = input.DisplayName
 	r.ClientID = input.ClientID
@@ -0,0 +1,77 @@
+package graphapi
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MicrosoftGraphAPIStatus records the outcome of the token requests and the
+// requests to Microsoft Graph, the copies of an api share it, a nil status
+// records nothing
+type MicrosoftGraphAPIStatus struct {
+	mutex    sync.Mutex
+	snapshot MicrosoftGraphAPIStatusSnapshot
+}
+
+// MicrosoftGraphAPIStatusSnapshot is the status at a time, zero times are
+// never
+type MicrosoftGraphAPIStatusSnapshot struct {
+	TokenRefreshedAt time.Time `json:"tokenRefreshedAt"`
+	TokenExpiresAt   time.Time `json:"tokenExpiresAt"`
+	TokenError       string    `json:"tokenError,omitempty"` // of the last token request, cleared by a success
+	LastSuccessAt    time.Time `json:"lastSuccessAt"`
+	LastFailureAt    time.Time `json:"lastFailureAt"`
+	LastError        string    `json:"lastError,omitempty"`
+}
+
+// Snapshot returns a copy of the status
+func (s *MicrosoftGraphAPIStatus) Snapshot() MicrosoftGraphAPIStatusSnapshot {
+	if s == nil {
+		return MicrosoftGraphAPIStatusSnapshot{}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.snapshot
+}
+
+func (s *MicrosoftGraphAPIStatus) setToken(expiresIn int32, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snapshot.TokenRefreshedAt = now
+	s.snapshot.TokenExpiresAt = now.Add(time.Duration(expiresIn) * time.Second)
+	s.snapshot.TokenError = ""
+}
+
+func (s *MicrosoftGraphAPIStatus) setTokenError(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.snapshot.TokenError = err.Error()
+}
+
+// setResponse records a request, reaching Microsoft Graph with a valid token
+// is a success even if the item is missing, throttled requests, expired tokens
+// and server errors are failures
+func (s *MicrosoftGraphAPIStatus) setResponse(resp *http.Response, err error, now time.Time) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case err != nil:
+		s.snapshot.LastFailureAt = now
+		s.snapshot.LastError = err.Error()
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		s.snapshot.LastFailureAt = now
+		s.snapshot.LastError = http.StatusText(resp.StatusCode)
+	default:
+		s.snapshot.LastSuccessAt = now
+	}
+}
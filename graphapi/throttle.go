@@ -0,0 +1,86 @@
+package graphapi
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AirWSW/onedrive/metrics"
+)
+
+// microsoftGraphAPIPathIDs are the path segments followed by an identifier
+var microsoftGraphAPIPathIDs = map[string]bool{
+	"drives":        true,
+	"items":         true,
+	"permissions":   true,
+	"subscriptions": true,
+	"thumbnails":    true,
+	"versions":      true,
+}
+
+// doMicrosoftGraphAPIRequest sends the request and records its outcome in
+// the status of the api and the metrics
+func (api *MicrosoftGraphAPI) doMicrosoftGraphAPIRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	method, path := req.Method, UseMicrosoftGraphAPIPathTemplate(req.URL)
+	start := time.Now()
+	resp, err := client.Do(req)
+	metrics.GraphRequestDuration.Observe(time.Since(start).Seconds(), method, path)
+	api.Status.setResponse(resp, err, time.Now())
+	if err != nil {
+		metrics.GraphRequests.Inc(method, path, "error")
+		return nil, err
+	}
+	metrics.GraphRequests.Inc(method, path, strconv.Itoa(resp.StatusCode))
+	if isMicrosoftGraphAPIThrottled(resp) {
+		metrics.GraphThrottles.Inc(method, path)
+	}
+	return resp, nil
+}
+
+// isMicrosoftGraphAPIThrottled reports whether the response is throttled, 429
+// Too Many Requests or 503 Service Unavailable along with Retry-After
+func isMicrosoftGraphAPIThrottled(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		return resp.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// UseMicrosoftGraphAPIPathTemplate returns the path of a request to Microsoft
+// Graph without the version, the query and the identifiers, like
+// /me/drive/items/{id}/children or /me/drive/root:{path}:/content
+func UseMicrosoftGraphAPIPathTemplate(u *url.URL) string {
+	path := u.Path
+	for _, version := range []string{"/v1.0", "/beta"} {
+		if strings.HasPrefix(path, version+"/") {
+			path = strings.TrimPrefix(path, version)
+			break
+		}
+	}
+	// The item paths are addressed like /root:/path/to:/action
+	if i := strings.Index(path, "root:"); i >= 0 {
+		rest := path[i+len("root:"):]
+		if j := strings.Index(rest, ":"); j >= 0 {
+			path = path[:i] + "root:{path}" + rest[j:]
+		} else {
+			path = path[:i] + "root:{path}"
+		}
+	}
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if microsoftGraphAPIPathIDs[segments[i-1]] && segments[i] != "" {
+			segments[i] = "{id}"
+		} else if i > 1 && segments[i-2] == "thumbnails" && segments[i] != "" {
+			segments[i] = "{size}"
+		}
+		if strings.HasPrefix(segments[i], "search(") {
+			segments[i] = "search(q={q})"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,58 @@
+package graphapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/AirWSW/onedrive/metrics"
+)
+
+func TestMicrosoftGraphAPIPathTemplate(t *testing.T) {
+	for str, path := range map[string]string{
+		"https://graph.microsoft.com/v1.0/me/drive/root:/a/b.txt:/content": "/me/drive/root:{path}:/content",
+		"/v1.0/me/drive/root:/a":                        "/me/drive/root:{path}",
+		"/v1.0/me/drive/items/0123/children?$top=10":    "/me/drive/items/{id}/children",
+		"/v1.0/me/drive/root:/a:/thumbnails/0/c300x400": "/me/drive/root:{path}:/thumbnails/{id}/{size}",
+		"/v1.0/me/drive/root/search(q='x')":             "/me/drive/root/search(q={q})",
+		"/beta/me/drive/root/delta?token=1":             "/me/drive/root/delta",
+	} {
+		u, err := url.Parse(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := UseMicrosoftGraphAPIPathTemplate(u); got != path {
+			t.Errorf("%s got %s", str, got)
+		}
+	}
+}
+
+func TestMicrosoftGraphAPIThrottle(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	api := &MicrosoftGraphAPI{
+		MicrosoftEndPoints:     MicrosoftEndPoints{MicrosoftGraphAPIEndPointURL: server.URL},
+		MicrosoftGraphAPIToken: &MicrosoftGraphAPIToken{TokenType: "Bearer", AccessToken: "token"},
+		Status:                 &MicrosoftGraphAPIStatus{},
+	}
+	throttles := metrics.GraphThrottles.Value("GET", "/me/drive/throttled")
+	// A throttled request is NOT sent again
+	if _, err := api.UseMicrosoftGraphAPIGet("/me/drive/throttled"); err == nil || requests != 1 {
+		t.Fatalf("got %d requests %v", requests, err)
+	}
+	if metrics.GraphThrottles.Value("GET", "/me/drive/throttled") != throttles+1 {
+		t.Errorf("got no throttle")
+	}
+	if metrics.GraphRequests.Value("GET", "/me/drive/throttled", "429") == 0 {
+		t.Errorf("got no request")
+	}
+	if api.Status.Snapshot().LastFailureAt.IsZero() {
+		t.Errorf("got no failure")
+	}
+}
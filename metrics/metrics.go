@@ -0,0 +1,262 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text format written by
+// Write
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds in seconds of the latency histograms
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	mutex   sync.Mutex
+	metrics = map[string]metric{}
+)
+
+func register(name string, m metric) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := metrics[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	metrics[name] = m
+}
+
+// Write writes all metrics in the Prometheus text format, sorted by name and
+// by label values
+func Write(w io.Writer) error {
+	mutex.Lock()
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	mutex.Unlock()
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		mutex.Lock()
+		m := metrics[name]
+		mutex.Unlock()
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mutex  sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounterVec registers a counter named name with the label names
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	cv := &CounterVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     map[string]*counterValue{},
+	}
+	register(name, cv)
+	return cv
+}
+
+// Add adds value, which must NOT be negative, to the counter of the label
+// values given in the order of the label names
+func (cv *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	key := useLabelValuesKey(cv.labelNames, labelValues)
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+	v, ok := cv.values[key]
+	if !ok {
+		v = &counterValue{labelValues: append([]string{}, labelValues...)}
+		cv.values[key] = v
+	}
+	v.value += value
+}
+
+// Inc adds one to the counter of the label values
+func (cv *CounterVec) Inc(labelValues ...string) {
+	cv.Add(1, labelValues...)
+}
+
+// Value returns the counter of the label values
+func (cv *CounterVec) Value(labelValues ...string) float64 {
+	key := useLabelValuesKey(cv.labelNames, labelValues)
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+	if v, ok := cv.values[key]; ok {
+		return v.value
+	}
+	return 0
+}
+
+func (cv *CounterVec) write(w *bufio.Writer) {
+	writeHeader(w, cv.name, cv.help, "counter")
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+	keys := []string{}
+	for key := range cv.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := cv.values[key]
+		writeSample(w, cv.name, cv.labelNames, v.labelValues, "", "", v.value)
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+
+	mutex  sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labelValues []string
+	counts      []uint64 // of each bucket, NOT cumulative
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec registers a histogram named name with the upper bounds of
+// the buckets in increasing order and the label names
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	hv := &HistogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		values:     map[string]*histogramValue{},
+	}
+	register(name, hv)
+	return hv
+}
+
+// Observe adds value to the histogram of the label values
+func (hv *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := useLabelValuesKey(hv.labelNames, labelValues)
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+	v, ok := hv.values[key]
+	if !ok {
+		v = &histogramValue{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(hv.buckets)),
+		}
+		hv.values[key] = v
+	}
+	if i := sort.SearchFloat64s(hv.buckets, value); i < len(hv.buckets) {
+		v.counts[i]++
+	}
+	v.count++
+	v.sum += value
+}
+
+// Count returns the count of the values observed of the label values
+func (hv *HistogramVec) Count(labelValues ...string) uint64 {
+	key := useLabelValuesKey(hv.labelNames, labelValues)
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+	if v, ok := hv.values[key]; ok {
+		return v.count
+	}
+	return 0
+}
+
+func (hv *HistogramVec) write(w *bufio.Writer) {
+	writeHeader(w, hv.name, hv.help, "histogram")
+	hv.mutex.Lock()
+	defer hv.mutex.Unlock()
+	keys := []string{}
+	for key := range hv.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := hv.values[key]
+		cumulative := uint64(0)
+		for i, bucket := range hv.buckets {
+			cumulative += v.counts[i]
+			writeSample(w, hv.name+"_bucket", hv.labelNames, v.labelValues, "le", formatFloat(bucket), float64(cumulative))
+		}
+		writeSample(w, hv.name+"_bucket", hv.labelNames, v.labelValues, "le", "+Inf", float64(v.count))
+		writeSample(w, hv.name+"_sum", hv.labelNames, v.labelValues, "", "", v.sum)
+		writeSample(w, hv.name+"_count", hv.labelNames, v.labelValues, "", "", float64(v.count))
+	}
+}
+
+// useLabelValuesKey panics unless a value is given for each label name, as
+// a mismatch is a bug of the caller
+func useLabelValuesKey(labelNames, labelValues []string) string {
+	if len(labelNames) != len(labelValues) {
+		panic("metrics: expected " + strconv.Itoa(len(labelNames)) + " label values, got " + strconv.Itoa(len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func writeHeader(w *bufio.Writer, name, help, metricType string) {
+	w.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	w.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+func writeSample(w *bufio.Writer, name string, labelNames, labelValues []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 || extraName != "" {
+		labels := []string{}
+		for i, labelName := range labelNames {
+			labels = append(labels, labelName+`="`+labelValueEscaper.Replace(labelValues[i])+`"`)
+		}
+		if extraName != "" {
+			labels = append(labels, extraName+`="`+extraValue+`"`)
+		}
+		w.WriteString("{" + strings.Join(labels, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	counter := NewCounterVec("test_requests_total", "Requests.", "path")
+	counter.Inc(`/a"b`)
+	counter.Add(2, "/c")
+	histogram := NewHistogramVec("test_duration_seconds", "Duration.", []float64{0.1, 1}, "path")
+	histogram.Observe(0.05, "/c")
+	histogram.Observe(5, "/c")
+	if counter.Value("/c") != 2 || histogram.Count("/c") != 2 {
+		t.Fatalf("got %v %v", counter.Value("/c"), histogram.Count("/c"))
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	text := buffer.String()
+	for _, line := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{path="/a\"b"} 1` + "\n",
+		`test_requests_total{path="/c"} 2` + "\n",
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{path="/c",le="0.1"} 1` + "\n",
+		`test_duration_seconds_bucket{path="/c",le="1"} 1` + "\n",
+		`test_duration_seconds_bucket{path="/c",le="+Inf"} 2` + "\n",
+		`test_duration_seconds_sum{path="/c"} 5.05` + "\n",
+		`test_duration_seconds_count{path="/c"} 2` + "\n",
+		"# HELP onedrive_graph_requests_total ",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("missing %q in %s", line, text)
+		}
+	}
+	if strings.Index(text, "test_duration_seconds") > strings.Index(text, "test_requests_total") {
+		t.Errorf("not sorted %s", text)
+	}
+}
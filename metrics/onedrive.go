@@ -0,0 +1,58 @@
+package metrics
+
+// The metrics of the server, the names and labels are stable, see the
+// Metrics section of the README
+var (
+	// GraphRequests counts the requests to Microsoft Graph by method, path
+	// template like /me/drive/items/{id}/children and status code, error if
+	// no response was received
+	GraphRequests = NewCounterVec("onedrive_graph_requests_total",
+		"Requests to Microsoft Graph by method, path template and status code.",
+		"method", "path", "status")
+	// GraphRequestDuration observes the latency of the requests to Microsoft
+	// Graph
+	GraphRequestDuration = NewHistogramVec("onedrive_graph_request_duration_seconds",
+		"Latency of the requests to Microsoft Graph in seconds.",
+		DefaultBuckets, "method", "path")
+	// GraphThrottles counts the requests Microsoft Graph throttled with 429 Too
+	// Many Requests or 503 Service Unavailable along with Retry-After
+	GraphThrottles = NewCounterVec("onedrive_graph_throttles_total",
+		"Requests to Microsoft Graph throttled.",
+		"method", "path")
+	// TokenRefreshes counts the requests of access tokens, success or failure
+	TokenRefreshes = NewCounterVec("onedrive_token_refreshes_total",
+		"Access token requests by result.",
+		"result")
+	// CacheHits, CacheMisses and CacheEvictions count the lookups and the
+	// evictions of the caches of each drive, the cache is driveitem for the
+	// listings, contenturl for the download URLs, content for the content
+	// blocks and thumbnail for the thumbnails, stale entries served are misses
+	CacheHits = NewCounterVec("onedrive_cache_hits_total",
+		"Cache lookups served from the cache by drive and cache.",
+		"drive", "cache")
+	CacheMisses = NewCounterVec("onedrive_cache_misses_total",
+		"Cache lookups missing or stale by drive and cache.",
+		"drive", "cache")
+	CacheEvictions = NewCounterVec("onedrive_cache_evictions_total",
+		"Entries evicted from the size bounded caches by drive and cache.",
+		"drive", "cache")
+	// CacheRefreshDuration observes the refreshes of the cached folders of
+	// each drive, success or failure
+	CacheRefreshDuration = NewHistogramVec("onedrive_cache_refresh_duration_seconds",
+		"Duration of the refreshes of the cached folders in seconds by drive and result.",
+		DefaultBuckets, "drive", "result")
+	// UploadBytes counts the bytes uploaded to each drive, uploads retried
+	// count again
+	UploadBytes = NewCounterVec("onedrive_upload_bytes_total",
+		"Bytes uploaded to Microsoft Graph by drive.",
+		"drive")
+	// HTTPRequests and HTTPRequestDuration count and observe the requests
+	// served by route template like /api/onedrive/driveitem, none if no route
+	// matched
+	HTTPRequests = NewCounterVec("onedrive_http_requests_total",
+		"Requests served by method, route template and status code.",
+		"method", "route", "status")
+	HTTPRequestDuration = NewHistogramVec("onedrive_http_request_duration_seconds",
+		"Latency of the requests served in seconds by method and route template.",
+		DefaultBuckets, "method", "route")
+)
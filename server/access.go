@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/access"
+	"github.com/AirWSW/onedrive/core/collection"
+	"github.com/AirWSW/onedrive/core/description"
+)
+
+// AccessUserKey is the gin context key of the authenticated *collection.AccessUser
+const AccessUserKey = "accessUser"
+
+// AccessPathKeys are the query parameters naming drive paths, which are
+// checked against hidden paths and volume mount passwords
+var AccessPathKeys = []string{"path", "destination", "parent"}
+
+// UnlockMaxAge is the lifetime of volume mount unlock cookies in seconds
+var UnlockMaxAge = 86400
+
+// useAccessOneDrive resolves the drive of the route the same way handlers do
+func useAccessOneDrive(c *gin.Context) (*core.OneDrive, string) {
+	drive := c.Param("drive")
+	if drive == "" {
+		drive = c.Query("drive")
+	}
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+	} else if od != nil && od.OneDriveDescription.OneDriveName != nil {
+		drive = *od.OneDriveDescription.OneDriveName
+	}
+	return od, drive
+}
+
+func abortAccessUnauthorized(c *gin.Context, realm string) {
+	c.Header("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+// requireAccessRole authenticates the request and requires role on the drive
+// of the route, all paths of the request are authorized as well
+func requireAccessRole(role access.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		od, drive := useAccessOneDrive(c)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		user, ok := ODCollection.AuthenticateAccessUser(c.Request)
+		if !ok {
+			abortAccessUnauthorized(c, "onedrive")
+			return
+		}
+		if ODCollection.UseAccessRole(user, drive) < role {
+			if user == nil {
+				abortAccessUnauthorized(c, "onedrive")
+				return
+			}
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Set(AccessUserKey, user)
+		paths := []string{}
+		if path := c.Param("path"); path != "" {
+			paths = append(paths, path)
+		}
+		for _, key := range AccessPathKeys {
+			if path, ok := c.GetQuery(key); ok {
+				paths = append(paths, path)
+			}
+		}
+		for _, path := range paths {
+			if !authorizeMicrosoftGraphDrivePath(c, od, drive, path, role) {
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// authorizeMicrosoftGraphDrivePath hides hidden paths from everyone but admins
+// and requires the volume mount password to be unlocked, a path mounted from
+// other drives requires role and is checked on each of them as well, the
+// request is aborted if NOT authorized
+func authorizeMicrosoftGraphDrivePath(c *gin.Context, od *core.OneDrive, drive, path string, role access.Role) bool {
+	status, realm := useMicrosoftGraphDrivePathStatus(c, od, drive, path, role)
+	switch status {
+	case http.StatusOK:
+		return true
+	case http.StatusUnauthorized:
+		abortAccessUnauthorized(c, realm)
+	default:
+		c.AbortWithStatus(status)
+	}
+	return false
+}
+
+// isMicrosoftGraphDrivePathReadable reports whether path may be shown to the
+// user of the request without aborting it
+func isMicrosoftGraphDrivePathReadable(c *gin.Context, od *core.OneDrive, drive, path string) bool {
+	status, _ := useMicrosoftGraphDrivePathStatus(c, od, drive, path, access.RoleRead)
+	return status == http.StatusOK
+}
+
+// isMicrosoftGraphDrivePathWritable reports whether path may be written by
+// the user of the request without aborting it
+func isMicrosoftGraphDrivePathWritable(c *gin.Context, od *core.OneDrive, drive, path string) bool {
+	status, _ := useMicrosoftGraphDrivePathStatus(c, od, drive, path, access.RoleWrite)
+	return status == http.StatusOK
+}
+
+// useMicrosoftGraphDrivePathStatus returns the status of the access to path,
+// the realm of the locked volume mount is given with http.StatusUnauthorized
+func useMicrosoftGraphDrivePathStatus(c *gin.Context, od *core.OneDrive, drive, path string, role access.Role) (int, string) {
+	user, _ := c.Get(AccessUserKey)
+	accessUser, _ := user.(*collection.AccessUser)
+	hops, err := od.ResolveDriveVolumeMountHops(path)
+	if err != nil {
+		return http.StatusNotFound, ""
+	}
+	for i, hop := range hops {
+		hopDrive := drive
+		if i > 0 && hop.OneDrive.OneDriveDescription.OneDriveName != nil {
+			hopDrive = *hop.OneDrive.OneDriveDescription.OneDriveName
+		}
+		hopRole := ODCollection.UseAccessRole(accessUser, hopDrive)
+		if hopRole < role {
+			return http.StatusForbidden, ""
+		}
+		if hopRole >= access.RoleAdmin {
+			continue
+		}
+		// Only the requested path is checked as volume mounts may expose hidden sources
+		if hop.OneDrive.IsHiddenPath(hop.Path) {
+			return http.StatusNotFound, ""
+		}
+		if !isDriveVolumeMountUnlocked(c, hopDrive, hop.DriveVolumeMountRule) {
+			return http.StatusUnauthorized, hopDrive + ":" + *hop.DriveVolumeMountRule.Target
+		}
+	}
+	return http.StatusOK, ""
+}
+
+// useLockedDriveVolumeMountHop returns the drive name and the volume mount of
+// the first hop of path requiring a password
+func useLockedDriveVolumeMountHop(od *core.OneDrive, drive, path string) (string, *description.DriveVolumeMount) {
+	hops, err := od.ResolveDriveVolumeMountHops(path)
+	if err != nil {
+		return drive, &description.DriveVolumeMount{}
+	}
+	for i, hop := range hops {
+		if hop.DriveVolumeMountRule.Password == nil || *hop.DriveVolumeMountRule.Password == "" {
+			continue
+		}
+		if i > 0 && hop.OneDrive.OneDriveDescription.OneDriveName != nil {
+			drive = *hop.OneDrive.OneDriveDescription.OneDriveName
+		}
+		return drive, hop.DriveVolumeMountRule
+	}
+	return drive, &description.DriveVolumeMount{}
+}
+
+// isDriveVolumeMountUnlocked accepts the password by the X-OneDrive-Password
+// header, the basic auth password or a signed unlock cookie
+func isDriveVolumeMountUnlocked(c *gin.Context, drive string, driveVolumeMountRule *description.DriveVolumeMount) bool {
+	if driveVolumeMountRule.Password == nil || *driveVolumeMountRule.Password == "" {
+		// A password volume mount without password is misconfigured and stays locked
+		return driveVolumeMountRule.GetType() != description.DriveVolumeMountPassword
+	}
+	password := []byte(*driveVolumeMountRule.Password)
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-OneDrive-Password")), password) == 1 {
+		return true
+	}
+	if _, basicPassword, ok := c.Request.BasicAuth(); ok && subtle.ConstantTimeCompare([]byte(basicPassword), password) == 1 {
+		return true
+	}
+	target := *driveVolumeMountRule.Target
+	token, err := c.Cookie(access.UseUnlockCookieName(drive, target))
+	if err != nil {
+		return false
+	}
+	return access.VerifyUnlockToken(ODCollection.UseAccessSecret(), token, drive, target, *driveVolumeMountRule.Password, time.Now())
+}
+
+// handlePostUnlock checks the password of the volume mount of path, given by
+// the password form value or the X-OneDrive-Password header, and sets a
+// signed unlock cookie
+func handlePostUnlock(c *gin.Context) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	drive, driveVolumeMountRule := useLockedDriveVolumeMountHop(od, drive, c.Query("path"))
+	if driveVolumeMountRule.Password == nil || *driveVolumeMountRule.Password == "" {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	password := c.PostForm("password")
+	if password == "" {
+		password = c.GetHeader("X-OneDrive-Password")
+	}
+	if subtle.ConstantTimeCompare([]byte(password), []byte(*driveVolumeMountRule.Password)) != 1 {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	target := *driveVolumeMountRule.Target
+	expiresAt := time.Now().Add(time.Duration(UnlockMaxAge) * time.Second)
+	token := access.SignUnlockToken(ODCollection.UseAccessSecret(), drive, target, *driveVolumeMountRule.Password, expiresAt)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     access.UseUnlockCookieName(drive, target),
+		Value:    token,
+		Path:     "/",
+		MaxAge:   UnlockMaxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRequireAccessRoleHiddenPath(t *testing.T) {
+	var graphRequests int32
+	_, cleanup := useTestODCollection(t, &graphRequests)
+	defer cleanup()
+	router := newTestRouter()
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/public", http.StatusOK},
+		{"/source", http.StatusNotFound},
+		// Microsoft Graph ignores case, so do the hidden paths
+		{"/SOURCE", http.StatusNotFound},
+		{"/Source/secret.txt", http.StatusNotFound},
+		{"//source/", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := serveTestRequest(router, httptest.NewRequest(http.MethodGet, "/api/onedrive/driveitem?path="+url.QueryEscape(test.path), nil))
+		if w.Code != test.code {
+			t.Errorf("%s got %d", test.path, w.Code)
+		}
+	}
+	if graphRequests != 0 {
+		t.Errorf("got %d requests to Microsoft Graph", graphRequests)
+	}
+}
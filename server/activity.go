@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/activity"
+)
+
+// handleGetMicrosoftGraphDriveItemActivities lists the activities of the drive
+// or the folder at path, the latest first, after and before are RFC 3339 times
+// or durations before now, activities the user may NOT read are left out and
+// so are the old paths the user may NOT read
+func handleGetMicrosoftGraphDriveItemActivities(c *gin.Context) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	now := time.Now()
+	after, err := core.ParseActivityTime(c.Query("after"), now)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	before, err := core.ParseActivityTime(c.Query("before"), now)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	filter := &core.ActivityFilter{
+		Path:   c.Query("path"),
+		After:  after,
+		Before: before,
+		Source: c.Query("source"),
+	}
+	top, _ := strconv.Atoi(c.Query("top"))
+	activityPayload, err := od.GetMicrosoftGraphDriveItemActivities(filter, top, c.Query("cursor"))
+	switch err {
+	case nil:
+	case core.ErrActivityCursorInvalid, core.ErrActivitySourceInvalid:
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	default:
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+	values := []activity.Activity{}
+	for _, value := range activityPayload.Value {
+		if !isMicrosoftGraphDrivePathReadable(c, od, drive, value.Path) {
+			continue
+		}
+		// An item moved out of a path the user may NOT read does NOT reveal it
+		if value.OldPath != "" && !isMicrosoftGraphDrivePathReadable(c, od, drive, value.OldPath) {
+			value.OldPath = ""
+		}
+		values = append(values, value)
+	}
+	activityPayload.Value = values
+	bytes, err := json.Marshal(activityPayload)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
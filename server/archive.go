@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+)
+
+func handleGetMicrosoftGraphDriveArchive(c *gin.Context) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	format := c.DefaultQuery("format", "zip")
+	contentType, extension := "application/zip", ".zip"
+	switch format {
+	case "zip":
+	case "tar.gz", "tgz":
+		contentType, extension = "application/gzip", ".tar.gz"
+	default:
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	// The hidden paths and the locked volume mounts inside the folder are left out
+	archive, err := od.NewMicrosoftGraphDriveArchive(c.Query("path"), c.QueryArray("select"), func(path string) bool {
+		return isMicrosoftGraphDrivePathReadable(c, od, drive, path)
+	})
+	if err != nil {
+		log.Println(err)
+		switch err {
+		case core.ErrArchiveFileOnly:
+			c.AbortWithStatus(http.StatusForbidden)
+		case core.ErrArchiveSizeExceeded, core.ErrArchiveFileCountExceeded:
+			c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		case core.ErrArchiveNotFolder:
+			c.AbortWithStatus(http.StatusBadRequest)
+		default:
+			c.AbortWithStatus(http.StatusNotFound)
+		}
+		return
+	}
+	c.Header("Cache-Control", "private")
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archive.Name + extension}))
+	c.Status(http.StatusOK)
+	// The connection is aborted on error, corrupted or missing entries never
+	// pass for a complete archive
+	if err := archive.Write(c.Writer, format); err != nil {
+		log.Println(err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/feed"
+)
+
+// FeedContentTypes are the content types of the feed formats
+var FeedContentTypes = map[string]string{
+	core.FeedM3U8: "application/vnd.apple.mpegurl; charset=utf-8",
+	core.FeedRSS:  "application/rss+xml; charset=utf-8",
+	core.FeedOPDS: feed.OPDSAcquisitionType + "; charset=utf-8",
+}
+
+// handleGetMicrosoftGraphDriveItemFeed turns the folder at path into an M3U8
+// playlist, a podcast RSS feed or an OPDS catalog, items the user may NOT
+// read are left out
+func handleGetMicrosoftGraphDriveItemFeed(c *gin.Context) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	format := c.Param("format")
+	contentType, ok := FeedContentTypes[format]
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	folderPath := c.Query("path")
+	if _, ok := od.UseDriveVolumeMountRedirectURL(folderPath); ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	driveItemCachePayload, err := od.GetMicrosoftGraphDriveItem(folderPath)
+	if err != nil || driveItemCachePayload == nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	children := []core.DriveItemCachePayload{}
+	for _, child := range driveItemCachePayload.Children {
+		if isMicrosoftGraphDrivePathReadable(c, od, drive, path.Join("/", folderPath, child.Name)) {
+			children = append(children, child)
+		}
+	}
+	driveItemCachePayload.Children = children
+	newFeed, err := core.NewFeed(driveItemCachePayload, format, usePublicBaseURL(c), drive, folderPath)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	buffer := &bytes.Buffer{}
+	switch format {
+	case core.FeedM3U8:
+		err = feed.WriteM3U8(buffer, newFeed)
+	case core.FeedRSS:
+		err = feed.WriteRSS(buffer, newFeed)
+	case core.FeedOPDS:
+		err = feed.WriteOPDS(buffer, newFeed)
+	}
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "private")
+	c.Data(http.StatusOK, contentType, buffer.Bytes())
+}
+
+// usePublicBaseURL returns the configured public base URL, or the scheme and
+// the host of the request
+func usePublicBaseURL(c *gin.Context) string {
+	if ODCollection.PublicBaseURL != "" {
+		return ODCollection.PublicBaseURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if forwardedProto := c.GetHeader("X-Forwarded-Proto"); forwardedProto != "" {
+		scheme = forwardedProto
+	}
+	return scheme + "://" + c.Request.Host
+}
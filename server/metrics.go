@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/metrics"
+)
+
+// handleMetrics counts and times the requests by route template, the
+// requests matching no route are counted as none, whatever their method
+func handleMetrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	method, route := c.Request.Method, c.FullPath()
+	if route == "" {
+		method, route = "none", "none"
+	}
+	metrics.HTTPRequests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+	metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), method, route)
+}
+
+func handleGetMetrics(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", metrics.ContentType)
+	c.Status(http.StatusOK)
+	if err := metrics.Write(c.Writer); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+)
+
+// useDriveVolumeMountSource resolves the virtual path of od through the volume
+// mounts to the drive and path of its source, redirect volume mounts are
+// answered here and writes are refused unless the volume mount is writable
+func useDriveVolumeMountSource(c *gin.Context, od *core.OneDrive, path string, write bool) (*core.OneDrive, string, bool) {
+	if redirectURL, ok := od.UseDriveVolumeMountRedirectURL(path); ok {
+		if write {
+			c.AbortWithStatus(http.StatusForbidden)
+			return nil, "", false
+		}
+		c.Header("Cache-Control", "private")
+		c.Redirect(http.StatusFound, redirectURL)
+		c.Abort()
+		return nil, "", false
+	}
+	sourceOneDrive, sourcePath, driveVolumeMountRule, err := od.ResolveDriveVolumeMount(path)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, "", false
+	}
+	if write && !driveVolumeMountRule.IsWritable() {
+		c.AbortWithStatus(http.StatusForbidden)
+		return nil, "", false
+	}
+	// The folders of the virtual drive above its volume mounts are NOT real items
+	if sourceOneDrive.IsNamespace() {
+		if write {
+			c.AbortWithStatus(http.StatusForbidden)
+		} else {
+			c.AbortWithStatus(http.StatusNotFound)
+		}
+		return nil, "", false
+	}
+	return sourceOneDrive, sourcePath, true
+}
+
+// useDriveVolumeMountSourcePair resolves both paths of a copy or move, which
+// must share the same source drive as well
+func useDriveVolumeMountSourcePair(c *gin.Context, od *core.OneDrive, path, destination string, write bool) (*core.OneDrive, string, string, bool) {
+	sourceOneDrive, sourcePath, ok := useDriveVolumeMountSource(c, od, path, write)
+	if !ok {
+		return nil, "", "", false
+	}
+	destinationOneDrive, sourceDestination, ok := useDriveVolumeMountSource(c, od, destination, true)
+	if !ok {
+		return nil, "", "", false
+	}
+	if sourceOneDrive != destinationOneDrive {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return nil, "", "", false
+	}
+	return sourceOneDrive, sourcePath, sourceDestination, true
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/access"
+	"github.com/AirWSW/onedrive/core/collection"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func handlePostMicrosoftGraphDriveFolder(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	od, path, ok := useDriveVolumeMountSource(c, od, c.Query("path"), true)
+	if !ok {
+		return
+	}
+	microsoftGraphDriveItem, err := od.CreateMicrosoftGraphDriveFolder(path, c.Query("conflictBehavior"))
+	responseMicrosoftGraphDriveItem(c, microsoftGraphDriveItem, err)
+}
+
+func handlePostMicrosoftGraphDriveItemMove(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	od, path, destination, ok := useDriveVolumeMountSourcePair(c, od, c.Query("path"), c.Query("destination"), true)
+	if !ok {
+		return
+	}
+	microsoftGraphDriveItem, err := od.MoveMicrosoftGraphDriveItem(path, destination)
+	responseMicrosoftGraphDriveItem(c, microsoftGraphDriveItem, err)
+}
+
+func handlePostMicrosoftGraphDriveItemRename(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	od, path, ok := useDriveVolumeMountSource(c, od, c.Query("path"), true)
+	if !ok {
+		return
+	}
+	microsoftGraphDriveItem, err := od.RenameMicrosoftGraphDriveItem(path, c.Query("name"))
+	responseMicrosoftGraphDriveItem(c, microsoftGraphDriveItem, err)
+}
+
+func handleDeleteMicrosoftGraphDriveItem(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	od, path, ok := useDriveVolumeMountSource(c, od, c.Query("path"), true)
+	if !ok {
+		return
+	}
+	microsoftGraphDriveItem, err := od.DeleteMicrosoftGraphDriveItem(path)
+	responseMicrosoftGraphDriveItem(c, microsoftGraphDriveItem, err)
+}
+
+func handlePostMicrosoftGraphDriveItemRestore(c *gin.Context) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if !authorizeMicrosoftGraphDriveItemRestore(c, od, drive, c.Query("id")) {
+		return
+	}
+	parent := c.Query("parent")
+	if parent != "" {
+		sourceOneDrive, sourceParent, ok := useDriveVolumeMountSource(c, od, parent, true)
+		if !ok {
+			return
+		}
+		// Deleted items are restored within their own drive only
+		if sourceOneDrive != od {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		parent = sourceParent
+	}
+	microsoftGraphDriveItem, err := od.RestoreMicrosoftGraphDriveItem(c.Query("id"), parent, c.Query("name"))
+	responseMicrosoftGraphDriveItem(c, microsoftGraphDriveItem, err)
+}
+
+// authorizeMicrosoftGraphDriveItemRestore authorizes the restore of the
+// deleted item id by the paths its tombstone had, an item deleted without
+// tombstone may be restored by admins only, the request is aborted if NOT
+// authorized
+func authorizeMicrosoftGraphDriveItemRestore(c *gin.Context, od *core.OneDrive, drive, id string) bool {
+	paths := od.UseDriveItemTombstonePaths(id)
+	if len(paths) == 0 {
+		user, _ := c.Get(AccessUserKey)
+		accessUser, _ := user.(*collection.AccessUser)
+		if ODCollection.UseAccessRole(accessUser, drive) < access.RoleAdmin {
+			c.AbortWithStatus(http.StatusNotFound)
+			return false
+		}
+		return true
+	}
+	for _, path := range paths {
+		if isMicrosoftGraphDrivePathWritable(c, od, drive, path) {
+			return true
+		}
+	}
+	// Aborts with the status of the first path
+	return authorizeMicrosoftGraphDrivePath(c, od, drive, paths[0], access.RoleWrite)
+}
+
+func responseMicrosoftGraphDriveItem(c *gin.Context, microsoftGraphDriveItem *graphapi.MicrosoftGraphDriveItem, err error) {
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	bytes, err := json.Marshal(microsoftGraphDriveItem)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
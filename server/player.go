@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+var playerTemplate = template.Must(template.New("player").Parse(`<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+    <title>{{ .Name }}</title>
+    <style>
+      html,
+      body {
+        margin: 0;
+        height: 100%;
+        background: #000;
+        color: #fff;
+        font-family: -apple-system, BlinkMacSystemFont, Segoe UI, Roboto,
+          Helvetica Neue, Arial, sans-serif;
+      }
+      video {
+        display: block;
+        width: 100%;
+        max-height: calc(100% - 40px);
+      }
+      p {
+        margin: 0;
+        padding: 10px;
+        font-size: 14px;
+      }
+    </style>
+  </head>
+  <body>
+    <video controls preload="metadata" src="{{ .StreamURL }}"{{ if .Covers }} poster="{{ (index .Covers 0).URL }}"{{ else }} poster="{{ .ThumbnailURL }}"{{ end }}>
+      {{- range $i, $subtitle := .Subtitles }}
+      <track kind="subtitles" src="{{ $subtitle.URL }}" label="{{ if $subtitle.Language }}{{ $subtitle.Language }}{{ else }}{{ $subtitle.Name }}{{ end }}"{{ if $subtitle.Language }} srclang="{{ $subtitle.Language }}"{{ end }}{{ if eq $i 0 }} default{{ end }} />
+      {{- end }}
+    </video>
+    <p>{{ .Name }}</p>
+  </body>
+</html>
+`))
+
+// usePlayerManifest returns the player manifest of the file at path from the
+// listing of its folder, siblings the user may NOT read are left out
+func usePlayerManifest(c *gin.Context) (*core.PlayerManifest, bool) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+	parentPath, name := utils.RegularPathToPathFilename(utils.RegularPath(c.Query("path")))
+	driveItemCachePayload, err := od.GetMicrosoftGraphDriveItem(parentPath)
+	if err != nil || driveItemCachePayload == nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+	children := []core.DriveItemCachePayload{}
+	for _, child := range driveItemCachePayload.Children {
+		if isMicrosoftGraphDrivePathReadable(c, od, drive, path.Join("/", parentPath, child.Name)) {
+			children = append(children, child)
+		}
+	}
+	driveItemCachePayload.Children = children
+	playerManifest, err := core.NewPlayerManifest(driveItemCachePayload, drive, parentPath, name)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+	return playerManifest, true
+}
+
+// handleGetPlayerManifest returns the player manifest of a video or audio file
+func handleGetPlayerManifest(c *gin.Context) {
+	playerManifest, ok := usePlayerManifest(c)
+	if !ok {
+		return
+	}
+	bytes, err := json.Marshal(playerManifest)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+// handleGetPlayer serves a minimal HTML player page of a video or audio file
+func handleGetPlayer(c *gin.Context) {
+	playerManifest, ok := usePlayerManifest(c)
+	if !ok {
+		return
+	}
+	buffer := &bytes.Buffer{}
+	if err := playerTemplate.Execute(buffer, playerManifest); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "private")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buffer.Bytes())
+}
+
+// handleGetSubtitle serves the subtitle file at path as WebVTT, SubRip files
+// are converted on the fly
+func handleGetSubtitle(c *gin.Context) {
+	od, _ := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	od, sourcePath, ok := useDriveVolumeMountSource(c, od, c.Query("path"), false)
+	if !ok {
+		return
+	}
+	subtitle, err := od.GetMicrosoftGraphDriveItemSubtitle(sourcePath)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Header("Cache-Control", "private")
+	c.Data(http.StatusOK, "text/vtt; charset=utf-8", subtitle)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+)
+
+func handleGetMicrosoftGraphDriveItemContent(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	path := c.Query("path")
+	if path == "" {
+		path = c.Param("path")
+	}
+	od, sourcePath, ok := useDriveVolumeMountSource(c, od, path, false)
+	if !ok {
+		return
+	}
+	proxyMicrosoftGraphDriveItemContent(c, od, sourcePath)
+}
+
+// proxyMicrosoftGraphDriveItemContent streams the content instead of exposing
+// the short-lived download URL, Range requests are answered with 206
+func proxyMicrosoftGraphDriveItemContent(c *gin.Context, od *core.OneDrive, path string) {
+	if od.UseContentCache(path) {
+		serveCachedMicrosoftGraphDriveItemContent(c, od, path)
+		return
+	}
+	resp, _, err := od.GetMicrosoftGraphDriveItemContentResponse(path, c.Request.Header)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	responseMicrosoftGraphDownloadResponse(c, resp)
+}
+
+// responseMicrosoftGraphDownloadResponse passes the response of a download URL
+// through to the client
+func responseMicrosoftGraphDownloadResponse(c *gin.Context, resp *http.Response) {
+	defer resp.Body.Close()
+	for _, key := range core.ProxyResponseHeaders {
+		if value := resp.Header.Get(key); value != "" {
+			c.Header(key, value)
+		}
+	}
+	if ODCollection.IsDebugMode != nil && *ODCollection.IsDebugMode {
+		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Access-Control-Expose-Headers", "Accept-Ranges,Content-Length,Content-Range,ETag,Last-Modified")
+	}
+	c.Header("Cache-Control", "private")
+	c.Status(resp.StatusCode)
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+	// The status and the headers are sent already, the connection is aborted
+	// on error so clients never take corrupted content as complete
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		log.Println(err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// serveCachedMicrosoftGraphDriveItemContent answers from the on-disk content
+// cache, only the blocks covered by the requested ranges are fetched
+func serveCachedMicrosoftGraphDriveItemContent(c *gin.Context, od *core.OneDrive, path string) {
+	cachedContent, err := od.OpenCachedMicrosoftGraphDriveItemContent(path)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if ODCollection.IsDebugMode != nil && *ODCollection.IsDebugMode {
+		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Access-Control-Expose-Headers", "Accept-Ranges,Content-Length,Content-Range,ETag,Last-Modified")
+	}
+	c.Header("Cache-Control", "private")
+	c.Header("ETag", cachedContent.ETag())
+	if cachedContent.MimeType != "" {
+		c.Header("Content-Type", cachedContent.MimeType)
+	}
+	http.ServeContent(c.Writer, c.Request, cachedContent.Name, cachedContent.LastModifiedAt, cachedContent)
+}
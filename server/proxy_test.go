@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+func TestGetMicrosoftGraphDriveItemContentHashMismatch(t *testing.T) {
+	var graphRequests, downloadRequests int32
+	od, cleanup := useTestODCollection(t, &graphRequests)
+	defer cleanup()
+	download := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the first download is corrupted, its length is unknown to
+		// clients as it is chunked
+		if atomic.AddInt32(&downloadRequests, 1) == 1 {
+			w.Write([]byte("Hello, "))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("World?"))
+			return
+		}
+		w.Write([]byte("Hello, World!"))
+	}))
+	defer download.Close()
+	quickXorHash := "SCgDG9jwBhaA4ApvnQMbyBACAAA="
+	downloadURL := download.URL
+	public := &od.DriveCacheCollection.MicrosoftGraphDriveItemCache[1]
+	public.Children = append(public.Children, cache.MicrosoftGraphDriveItemCache{
+		Name:                        "hello.txt",
+		File:                        &graphapi.MicrosoftGraphFile{Hashes: &graphapi.MicrosoftGraphHashes{QuickXorHash: &quickXorHash}},
+		Size:                        13,
+		AtMicrosoftGraphDownloadURL: &downloadURL,
+		ParentReference:             &graphapi.MicrosoftGraphItemReference{Path: "/drive/root:/public"},
+	})
+	od.OneDriveDescription.HashVerification = &description.DriveHashVerification{Download: true}
+	server := httptest.NewServer(newTestRouter())
+	defer server.Close()
+
+	// The transfer is aborted, before or after the status is sent
+	if resp, err := http.Get(server.URL + "/onedrive/download?path=/public/hello.txt"); err == nil {
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil {
+			t.Errorf("got %d %q", resp.StatusCode, body)
+		}
+	}
+
+	// Retries download again before sending anything
+	od.OneDriveDescription.HashVerification.Retry = 1
+	atomic.StoreInt32(&downloadRequests, 0)
+	resp, err := http.Get(server.URL + "/onedrive/download?path=/public/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || string(body) != "Hello, World!" || atomic.LoadInt32(&downloadRequests) != 2 {
+		t.Errorf("got %d %q %v after %d downloads", resp.StatusCode, body, err, atomic.LoadInt32(&downloadRequests))
+	}
+}
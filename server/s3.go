@@ -0,0 +1,442 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/access"
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/description"
+	"github.com/AirWSW/onedrive/core/integrity"
+	"github.com/AirWSW/onedrive/core/s3"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+const s3XMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+type s3Error struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+type s3ListAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	XMLNS   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type s3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type s3ListBucketResult struct {
+	XMLName               xml.Name           `xml:"ListBucketResult"`
+	XMLNS                 string             `xml:"xmlns,attr"`
+	Name                  string             `xml:"Name"`
+	Prefix                string             `xml:"Prefix"`
+	Delimiter             string             `xml:"Delimiter,omitempty"`
+	MaxKeys               int                `xml:"MaxKeys"`
+	KeyCount              int                `xml:"KeyCount"`
+	IsTruncated           bool               `xml:"IsTruncated"`
+	EncodingType          string             `xml:"EncodingType,omitempty"`
+	ContinuationToken     string             `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string             `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string             `xml:"StartAfter,omitempty"`
+	Contents              []s3Contents       `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefixes `xml:"CommonPrefixes"`
+}
+
+type s3Contents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3CommonPrefixes struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type s3LocationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	XMLNS   string   `xml:"xmlns,attr"`
+}
+
+func responseS3XML(c *gin.Context, status int, v interface{}) {
+	bytes, err := xml.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "application/xml", append([]byte(xml.Header), bytes...))
+}
+
+func abortS3(c *gin.Context, status int, code, message string) {
+	responseS3XML(c, status, s3Error{
+		Code:     code,
+		Message:  message,
+		Resource: c.Request.URL.Path,
+	})
+	c.Abort()
+}
+
+// authorizeS3 verifies the signature version 4 of the request against the
+// configured access keys and returns the access key id
+func authorizeS3(c *gin.Context) (string, bool) {
+	accessKeyID, err := s3.VerifySignatureV4(c.Request, ODCollection.UseS3SecretAccessKey, time.Now())
+	if err != nil {
+		log.Println("authorizeS3", err)
+		switch err {
+		case s3.ErrSignatureV4AccessKey:
+			abortS3(c, http.StatusForbidden, "InvalidAccessKeyId", "The access key id does not exist.")
+		case s3.ErrSignatureV4Expired:
+			abortS3(c, http.StatusForbidden, "RequestTimeTooSkewed", "The request time is too skewed or expired.")
+		case s3.ErrSignatureV4DoesNotMatch:
+			abortS3(c, http.StatusForbidden, "SignatureDoesNotMatch", "The calculated signature does not match.")
+		default:
+			abortS3(c, http.StatusForbidden, "AccessDenied", "Access Denied")
+		}
+		return "", false
+	}
+	return accessKeyID, true
+}
+
+// useS3Bucket authorizes the request and requires role of its access key on
+// the drive of the bucket, the access key id is returned along
+func useS3Bucket(c *gin.Context, role access.Role) (*core.OneDrive, string, bool) {
+	accessKeyID, ok := authorizeS3(c)
+	if !ok {
+		return nil, "", false
+	}
+	od := ODCollection.UseOneDriveByOneDriveName(c.Param("bucket"))
+	if od == nil {
+		abortS3(c, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return nil, "", false
+	}
+	if ODCollection.UseS3AccessRole(accessKeyID, c.Param("bucket")) < role {
+		abortS3(c, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return nil, "", false
+	}
+	return od, accessKeyID, true
+}
+
+// useS3SourcePath resolves the key through the volume mounts to the drive and
+// path of its source, hidden paths, password protected and redirect mounts
+// are NOT accessible through the gateway, the access key needs the role on
+// each drive the key is mounted from as well
+func useS3SourcePath(od *core.OneDrive, accessKeyID, key string, write bool) (*core.OneDrive, string, bool) {
+	hops, err := od.ResolveDriveVolumeMountHops(utils.RegularPath(key))
+	if err != nil {
+		return nil, "", false
+	}
+	role := access.RoleRead
+	if write {
+		role = access.RoleWrite
+	}
+	for i, hop := range hops {
+		if i > 0 && (hop.OneDrive.OneDriveDescription.OneDriveName == nil || ODCollection.UseS3AccessRole(accessKeyID, *hop.OneDrive.OneDriveDescription.OneDriveName) < role) {
+			return nil, "", false
+		}
+		driveVolumeMountRule := hop.DriveVolumeMountRule
+		if driveVolumeMountRule.Password != nil && *driveVolumeMountRule.Password != "" {
+			return nil, "", false
+		}
+		if driveVolumeMountRule.GetType() == description.DriveVolumeMountRedirect || (write && !driveVolumeMountRule.IsWritable()) {
+			return nil, "", false
+		}
+		if hop.OneDrive.IsHiddenPath(hop.Path) {
+			return nil, "", false
+		}
+	}
+	hop := hops[len(hops)-1]
+	if write && hop.SourceOneDrive.IsNamespace() {
+		return nil, "", false
+	}
+	return hop.SourceOneDrive, hop.SourcePath, true
+}
+
+func useS3ETag(microsoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache) string {
+	if strings.HasPrefix(microsoftGraphDriveItemCache.ETag, "\"") {
+		return microsoftGraphDriveItemCache.ETag
+	}
+	return strconv.Quote(microsoftGraphDriveItemCache.ETag)
+}
+
+// handleS3ListBuckets lists the drives the access key may read as buckets
+func handleS3ListBuckets(c *gin.Context) {
+	accessKeyID, ok := authorizeS3(c)
+	if !ok {
+		return
+	}
+	result := s3ListAllMyBucketsResult{
+		XMLNS:   s3XMLNS,
+		Buckets: []s3Bucket{},
+	}
+	for _, od := range ODCollection.OneDrives {
+		if od.OneDriveDescription.OneDriveName == nil || ODCollection.UseS3AccessRole(accessKeyID, *od.OneDriveDescription.OneDriveName) < access.RoleRead {
+			continue
+		}
+		creationDate := time.Time{}
+		if driveDescription := od.OneDriveDescription.DriveDescription; driveDescription != nil {
+			if driveDescription.CreatedDateTime != nil {
+				creationDate = driveDescription.CreatedDateTime.UTC()
+			}
+			if driveDescription.Owner != nil && driveDescription.Owner.User != nil {
+				result.Owner = s3Owner{ID: driveDescription.Owner.User.ID, DisplayName: driveDescription.Owner.User.DisplayName}
+			}
+		}
+		result.Buckets = append(result.Buckets, s3Bucket{
+			Name:         *od.OneDriveDescription.OneDriveName,
+			CreationDate: creationDate.Format("2006-01-02T15:04:05.000Z"),
+		})
+	}
+	responseS3XML(c, http.StatusOK, result)
+}
+
+func handleHeadS3Bucket(c *gin.Context) {
+	if _, _, ok := useS3Bucket(c, access.RoleRead); !ok {
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// handleGetS3Bucket answers ListObjectsV2 and GetBucketLocation
+func handleGetS3Bucket(c *gin.Context) {
+	od, accessKeyID, ok := useS3Bucket(c, access.RoleRead)
+	if !ok {
+		return
+	}
+	if _, ok := c.GetQuery("location"); ok {
+		responseS3XML(c, http.StatusOK, s3LocationConstraint{XMLNS: s3XMLNS})
+		return
+	}
+	if c.Query("list-type") != "2" {
+		abortS3(c, http.StatusNotImplemented, "NotImplemented", "Only ListObjectsV2 is implemented.")
+		return
+	}
+	maxKeys := 1000
+	if value := c.Query("max-keys"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			abortS3(c, http.StatusBadRequest, "InvalidArgument", "Invalid max-keys.")
+			return
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+	startAfter := c.Query("start-after")
+	continuationToken := c.Query("continuation-token")
+	if continuationToken != "" {
+		bytes, err := base64.RawURLEncoding.DecodeString(continuationToken)
+		if err != nil {
+			abortS3(c, http.StatusBadRequest, "InvalidArgument", "Invalid continuation-token.")
+			return
+		}
+		startAfter = string(bytes)
+	}
+	prefix, delimiter := c.Query("prefix"), c.Query("delimiter")
+	list := func(path string) ([]cache.MicrosoftGraphDriveItemCache, error) {
+		if _, _, ok := useS3SourcePath(od, accessKeyID, path, false); !ok {
+			return []cache.MicrosoftGraphDriveItemCache{}, nil
+		}
+		microsoftGraphDriveItemCache, err := od.StatMicrosoftGraphDriveItem(path)
+		if err != nil {
+			return nil, err
+		}
+		return microsoftGraphDriveItemCache.Children, nil
+	}
+	objects, isTruncated, err := s3.ListObjects(list, prefix, delimiter, startAfter, maxKeys)
+	if err == s3.ErrDelimiterNotImplemented {
+		abortS3(c, http.StatusNotImplemented, "NotImplemented", "Only the delimiter / is implemented.")
+		return
+	}
+	if err != nil {
+		// A missing prefix folder is an empty listing
+		log.Println(err)
+		objects, isTruncated = []s3.Object{}, false
+	}
+	encode := func(str string) string { return str }
+	encodingType := c.Query("encoding-type")
+	if encodingType == "url" {
+		encode = func(str string) string { return s3.URIEncode(str, false) }
+	}
+	result := s3ListBucketResult{
+		XMLNS:             s3XMLNS,
+		Name:              c.Param("bucket"),
+		Prefix:            encode(prefix),
+		Delimiter:         encode(delimiter),
+		MaxKeys:           maxKeys,
+		KeyCount:          len(objects),
+		IsTruncated:       isTruncated,
+		EncodingType:      encodingType,
+		ContinuationToken: continuationToken,
+		StartAfter:        encode(c.Query("start-after")),
+		Contents:          []s3Contents{},
+	}
+	for _, object := range objects {
+		if object.IsPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefixes{Prefix: encode(object.Key)})
+			continue
+		}
+		eTag := object.ETag
+		if !strings.HasPrefix(eTag, "\"") {
+			eTag = strconv.Quote(eTag)
+		}
+		result.Contents = append(result.Contents, s3Contents{
+			Key:          encode(object.Key),
+			LastModified: object.LastModified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         eTag,
+			Size:         object.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	if isTruncated && len(objects) > 0 {
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(objects[len(objects)-1].Key))
+	}
+	responseS3XML(c, http.StatusOK, result)
+}
+
+// handleGetS3Object answers HeadObject and GetObject, Range requests are
+// passed through to the download URL
+func handleGetS3Object(c *gin.Context) {
+	if c.Param("key") == "/" {
+		if c.Request.Method == http.MethodHead {
+			handleHeadS3Bucket(c)
+		} else {
+			handleGetS3Bucket(c)
+		}
+		return
+	}
+	od, accessKeyID, ok := useS3Bucket(c, access.RoleRead)
+	if !ok {
+		return
+	}
+	sourceOneDrive, sourcePath, ok := useS3SourcePath(od, accessKeyID, c.Param("key"), false)
+	if !ok {
+		abortS3(c, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+	microsoftGraphDriveItemCache, err := od.StatMicrosoftGraphDriveItem(c.Param("key"))
+	if err != nil || microsoftGraphDriveItemCache.Folder != nil {
+		if c.Request.Method == http.MethodHead {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		abortS3(c, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	if c.Request.Method == http.MethodHead {
+		c.Header("Accept-Ranges", "bytes")
+		c.Header("Content-Length", strconv.FormatInt(microsoftGraphDriveItemCache.Size, 10))
+		c.Header("ETag", useS3ETag(microsoftGraphDriveItemCache))
+		c.Header("Last-Modified", time.Unix(microsoftGraphDriveItemCache.LastModifiedAt, 0).UTC().Format(http.TimeFormat))
+		if microsoftGraphDriveItemCache.File != nil && microsoftGraphDriveItemCache.File.MimeType != "" {
+			c.Header("Content-Type", microsoftGraphDriveItemCache.File.MimeType)
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+	proxyMicrosoftGraphDriveItemContent(c, sourceOneDrive, sourcePath)
+}
+
+// handlePutS3Object uploads the body through the uploader, a signed payload
+// hash is verified before uploading
+func handlePutS3Object(c *gin.Context) {
+	od, accessKeyID, ok := useS3Bucket(c, access.RoleWrite)
+	if !ok {
+		return
+	}
+	od, sourcePath, ok := useS3SourcePath(od, accessKeyID, c.Param("key"), true)
+	if !ok || c.Param("key") == "/" {
+		abortS3(c, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+	if c.GetHeader("X-Amz-Copy-Source") != "" {
+		abortS3(c, http.StatusNotImplemented, "NotImplemented", "CopyObject is not implemented.")
+		return
+	}
+	payloadHash := s3.UsePayloadHash(c.Request)
+	var content io.Reader
+	var size int64
+	if payloadHash == s3.UnsignedPayload {
+		var cleanup func()
+		var err error
+		content, size, cleanup, err = useUploadContent(c, od)
+		if err != nil {
+			log.Println(err)
+			abortS3(c, http.StatusBadRequest, "IncompleteBody", "The request body is incomplete.")
+			return
+		}
+		defer cleanup()
+	} else if len(payloadHash) == sha256.Size*2 {
+		tempFile, err := ioutil.TempFile("", "onedrive-upload-")
+		if err != nil {
+			log.Println(err)
+			abortS3(c, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		defer os.Remove(tempFile.Name())
+		defer tempFile.Close()
+		hash := sha256.New()
+		size, err = io.Copy(io.MultiWriter(tempFile, hash), c.Request.Body)
+		if err != nil {
+			log.Println(err)
+			abortS3(c, http.StatusBadRequest, "IncompleteBody", "The request body is incomplete.")
+			return
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != strings.ToLower(payloadHash) {
+			abortS3(c, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided x-amz-content-sha256 does not match the body.")
+			return
+		}
+		if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+			log.Println(err)
+			abortS3(c, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		content = tempFile
+	} else {
+		abortS3(c, http.StatusNotImplemented, "NotImplemented", "Streaming payloads are not implemented.")
+		return
+	}
+	microsoftGraphDriveItem, err := od.UploadMicrosoftGraphDriveItem(sourcePath, size, content)
+	if err != nil {
+		log.Println(err)
+		if integrity.IsHashMismatch(err) {
+			abortS3(c, http.StatusBadGateway, "BadDigest", err.Error())
+			return
+		}
+		abortS3(c, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	eTag := microsoftGraphDriveItem.ETag
+	if !strings.HasPrefix(eTag, "\"") {
+		eTag = strconv.Quote(eTag)
+	}
+	c.Header("ETag", eTag)
+	c.Status(http.StatusOK)
+}
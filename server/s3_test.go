@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/collection"
+	"github.com/AirWSW/onedrive/core/s3"
+)
+
+// newTestS3Request signs a request without payload by the signature version
+// 4 of the access key id, whose secret is the id reversed
+func newTestS3Request(method, target, accessKeyID string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	now := time.Now().UTC()
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+	r.Header.Set("X-Amz-Date", amzDate)
+	r.Header.Set("X-Amz-Content-Sha256", s3.UnsignedPayload)
+	canonicalRequest := method + "\n" +
+		s3.URIEncode(r.URL.Path, false) + "\n" +
+		"\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:" + s3.UnsignedPayload + "\n" +
+		"x-amz-date:" + amzDate + "\n" +
+		"\n" +
+		"host;x-amz-content-sha256;x-amz-date\n" +
+		s3.UnsignedPayload
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/us-east-1/s3/aws4_request"
+	stringToSign := s3.SignatureV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+	signingKey := []byte("AWS4" + useTestS3SecretAccessKey(accessKeyID))
+	for _, data := range []string{date, "us-east-1", "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, signingKey)
+		mac.Write([]byte(data))
+		signingKey = mac.Sum(nil)
+	}
+	r.Header.Set("Authorization", s3.SignatureV4Algorithm+" Credential="+accessKeyID+"/"+scope+",SignedHeaders=host;x-amz-content-sha256;x-amz-date,Signature="+hex.EncodeToString(signingKey))
+	return r
+}
+
+func useTestS3SecretAccessKey(accessKeyID string) string {
+	runes := []rune(accessKeyID)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func TestS3AccessRoles(t *testing.T) {
+	var graphRequests int32
+	_, cleanup := useTestODCollection(t, &graphRequests)
+	defer cleanup()
+	ODCollection.AccessConfig.Users = []collection.AccessUser{
+		{Name: "reader", Roles: map[string]string{"my media": "read"}},
+		{Name: "stranger", Roles: map[string]string{"other": "admin"}},
+	}
+	ODCollection.S3Config = &collection.S3Config{AllowPut: true}
+	for _, accessKey := range []collection.S3AccessKey{
+		{AccessKeyID: "READERKEY", User: "reader"},
+		{AccessKeyID: "STRANGERKEY", User: "stranger"},
+		{AccessKeyID: "GHOSTKEY", User: "ghost"},
+		// The anonymous users write
+		{AccessKeyID: "ANONYMOUSKEY"},
+	} {
+		accessKey.SecretAccessKey = useTestS3SecretAccessKey(accessKey.AccessKeyID)
+		ODCollection.S3Config.AccessKeys = append(ODCollection.S3Config.AccessKeys, accessKey)
+	}
+	router := newTestRouter()
+
+	tests := []struct {
+		method, target, accessKeyID string
+		code                        int
+	}{
+		{http.MethodHead, "/s3/my%20media/public/a%20b.txt", "READERKEY", http.StatusOK},
+		{http.MethodPut, "/s3/my%20media/public/c.txt", "READERKEY", http.StatusForbidden},
+		{http.MethodHead, "/s3/my%20media", "STRANGERKEY", http.StatusForbidden},
+		{http.MethodGet, "/s3/my%20media/public/a%20b.txt", "STRANGERKEY", http.StatusForbidden},
+		{http.MethodPut, "/s3/my%20media/public/c.txt", "STRANGERKEY", http.StatusForbidden},
+		{http.MethodGet, "/s3/my%20media/public/a%20b.txt", "GHOSTKEY", http.StatusForbidden},
+		{http.MethodHead, "/s3/my%20media/public/a%20b.txt", "ANONYMOUSKEY", http.StatusOK},
+		// Hidden paths stay hidden to writers
+		{http.MethodPut, "/s3/my%20media/source/c.txt", "ANONYMOUSKEY", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if w := serveTestRequest(router, newTestS3Request(test.method, test.target, test.accessKeyID)); w.Code != test.code {
+			t.Errorf("%s %s %s got %d %s", test.accessKeyID, test.method, test.target, w.Code, w.Body)
+		}
+	}
+
+	// The buckets the access key may NOT read are left out
+	for accessKeyID, bucket := range map[string]bool{"READERKEY": true, "STRANGERKEY": false} {
+		w := serveTestRequest(router, newTestS3Request(http.MethodGet, "/s3", accessKeyID))
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "<Name>my media</Name>") != bucket {
+			t.Errorf("%s got %d %s", accessKeyID, w.Code, w.Body)
+		}
+	}
+	if graphRequests != 0 {
+		t.Errorf("got %d requests to Microsoft Graph", graphRequests)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+)
+
+// handleGetMicrosoftGraphDriveItemSearch searches the drive for query by
+// Microsoft Graph, or the cached items with mode offline, results the user
+// may NOT read are left out
+func handleGetMicrosoftGraphDriveItemSearch(c *gin.Context) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	query := c.Query("query")
+	filter, err := useSearchFilter(c)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	top, _ := strconv.Atoi(c.Query("top"))
+	var searchPayload *core.SearchPayload
+	if c.Query("mode") == "offline" {
+		filter.Name = query
+		searchPayload, err = od.SearchDriveCacheCollection(filter, top, c.Query("cursor"))
+	} else {
+		searchPayload, err = od.SearchMicrosoftGraphDriveItem(query, filter, top, c.Query("cursor"))
+	}
+	switch err {
+	case nil:
+	case core.ErrSearchQueryEmpty, core.ErrSearchCursorInvalid:
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	default:
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+	values := []core.DriveItemCachePayload{}
+	for _, value := range searchPayload.Value {
+		if isMicrosoftGraphDrivePathReadable(c, od, drive, path.Join(value.Reference.Path, value.Name)) {
+			values = append(values, value)
+		}
+	}
+	searchPayload.Value = values
+	bytes, err := json.Marshal(searchPayload)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+// handleGetDriveIndexQuery queries the indexes of the cached items with the
+// query language, results the user may NOT read are left out
+func handleGetDriveIndexQuery(c *gin.Context) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	top, _ := strconv.Atoi(c.Query("top"))
+	searchPayload, err := od.QueryDriveIndex(c.Query("query"), c.Query("sort"), c.Query("order"), top, c.Query("cursor"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	values := []core.DriveItemCachePayload{}
+	for _, value := range searchPayload.Value {
+		if isMicrosoftGraphDrivePathReadable(c, od, drive, path.Join(value.Reference.Path, value.Name)) {
+			values = append(values, value)
+		}
+	}
+	searchPayload.Value = values
+	bytes, err := json.Marshal(searchPayload)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+// useSearchFilter parses the filter of a search, ext is a comma separated
+// list, sizes take K, M, G and T suffixes and times are RFC 3339 or dates
+func useSearchFilter(c *gin.Context) (*core.SearchFilter, error) {
+	filter := &core.SearchFilter{
+		Type: c.Query("type"),
+		Path: c.Query("path"),
+	}
+	if ext := c.Query("ext"); ext != "" {
+		filter.Extensions = strings.Split(ext, ",")
+	}
+	var err error
+	if minSize := c.Query("minSize"); minSize != "" {
+		if filter.MinSize, err = core.ParseSearchSize(minSize); err != nil {
+			return nil, err
+		}
+	}
+	if maxSize := c.Query("maxSize"); maxSize != "" {
+		if filter.MaxSize, err = core.ParseSearchSize(maxSize); err != nil {
+			return nil, err
+		}
+		filter.HasMaxSize = true
+	}
+	if modifiedAfter := c.Query("modifiedAfter"); modifiedAfter != "" {
+		if filter.ModifiedAfter, err = core.ParseSearchTime(modifiedAfter); err != nil {
+			return nil, err
+		}
+	}
+	if modifiedBefore := c.Query("modifiedBefore"); modifiedBefore != "" {
+		if filter.ModifiedBefore, err = core.ParseSearchTime(modifiedBefore); err != nil {
+			return nil, err
+		}
+	}
+	filter.Media = c.Query("media")
+	if takenAfter := c.Query("takenAfter"); takenAfter != "" {
+		if filter.TakenAfter, err = core.ParseSearchTime(takenAfter); err != nil {
+			return nil, err
+		}
+	}
+	if takenBefore := c.Query("takenBefore"); takenBefore != "" {
+		if filter.TakenBefore, err = core.ParseSearchTime(takenBefore); err != nil {
+			return nil, err
+		}
+	}
+	if minDuration := c.Query("minDuration"); minDuration != "" {
+		if filter.MinDuration, err = core.ParseSearchDuration(minDuration); err != nil {
+			return nil, err
+		}
+	}
+	if maxDuration := c.Query("maxDuration"); maxDuration != "" {
+		if filter.MaxDuration, err = core.ParseSearchDuration(maxDuration); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// SearchFilterKeys are the query keys of a search filter, a listing with any
+// of them is filtered as well
+var SearchFilterKeys = []string{"type", "ext", "minSize", "maxSize", "modifiedAfter", "modifiedBefore", "media", "takenAfter", "takenBefore", "minDuration", "maxDuration"}
+
+// filterMicrosoftGraphDriveItemChildren filters the children of a listing by
+// the search filter of the request if any
+func filterMicrosoftGraphDriveItemChildren(c *gin.Context, driveItemCachePayload *core.DriveItemCachePayload) error {
+	for _, key := range SearchFilterKeys {
+		if _, ok := c.GetQuery(key); ok {
+			filter, err := useSearchFilter(c)
+			if err != nil {
+				return err
+			}
+			filter.FilterChildren(driveItemCachePayload)
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGetMicrosoftGraphDriveItemSearchForeignCursor(t *testing.T) {
+	var graphRequests, foreignRequests int32
+	_, cleanup := useTestODCollection(t, &graphRequests)
+	defer cleanup()
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&foreignRequests, 1)
+		w.Write([]byte(`{"value":[]}`))
+	}))
+	defer foreign.Close()
+	router := newTestRouter()
+
+	cursor := base64.RawURLEncoding.EncodeToString([]byte(`{"s":0,"n":"` + foreign.URL + `/v1.0/me/drive/root/search(q='movie')"}`))
+	w := serveTestRequest(router, httptest.NewRequest(http.MethodGet, "/onedrive/search?query=movie&cursor="+url.QueryEscape(cursor), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d", w.Code)
+	}
+	if foreignRequests != 0 || graphRequests != 0 {
+		t.Errorf("got %d requests to the foreign host, %d to Microsoft Graph", foreignRequests, graphRequests)
+	}
+}
@@ -8,10 +8,14 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"runtime"
+	"runtime/debug"
+	"time"
 
 	"github.com/DeanThompson/ginpprof"
 	"github.com/gin-gonic/gin"
 
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/access"
 	"github.com/AirWSW/onedrive/core/collection"
 )
 
@@ -21,28 +25,74 @@ func AddDefalutHeaders(c *gin.Context) {
 	if ODCollection.IsDebugMode != nil && *ODCollection.IsDebugMode {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "DNT,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type,Range")
-		c.Header("Access-Control-Expose-Headers", "Content-Length,Content-Range")
+		c.Header("Access-Control-Allow-Headers", "DNT,User-Agent,X-Requested-With,If-Modified-Since,Cache-Control,Content-Type,Range,Authorization,X-OneDrive-Password")
+		c.Header("Access-Control-Expose-Headers", "Accept-Ranges,Content-Length,Content-Range,ETag,Last-Modified")
 	}
 	c.Header("Cache-Control", "private")
 	c.Header("Content-Type", "application/json;charset=utf-8")
 }
 
+// handleGetOneDriveStatus reports the health of the drive, or of all drives,
+// and fails with 503 Service Unavailable if any is degraded, the drives the
+// user may NOT read count toward the status without being listed
 func handleGetOneDriveStatus(c *gin.Context) {
-	drive := c.Query("drive")
-	od := ODCollection.UseDefaultOneDrive()
-	if len(drive) > 0 {
-		od = ODCollection.UseOneDriveByOneDriveName(drive)
+	now := time.Now()
+	driveStatuses := []*core.DriveStatus{}
+	if drive := c.Query("drive"); len(drive) > 0 {
+		od := ODCollection.UseOneDriveByOneDriveName(drive)
 		if od == nil {
 			c.AbortWithStatus(http.StatusNotFound)
 			return
 		}
-		AddDefalutHeaders(c)
-		c.String(http.StatusOK, "%s", []byte(`{"status":"ok","drive":"`+drive+`"}`))
+		driveStatuses = od.GetDriveStatuses(now)
+	} else {
+		for _, oneDrive := range ODCollection.OneDrives {
+			driveStatuses = append(driveStatuses, oneDrive.GetDriveStatus(now))
+		}
+	}
+	statusPayload := &core.StatusPayload{
+		Status: core.SumUpDriveStatuses(driveStatuses),
+		Drives: []*core.DriveStatus{},
+	}
+	// The status needs no access role, only the drives the user may read are
+	// listed
+	accessUser, _ := ODCollection.AuthenticateAccessUser(c.Request)
+	for _, driveStatus := range driveStatuses {
+		if ODCollection.UseAccessRole(accessUser, driveStatus.Drive) >= access.RoleRead {
+			statusPayload.Drives = append(statusPayload.Drives, driveStatus)
+		}
+	}
+	bytes, err := json.Marshal(statusPayload)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
+	code := http.StatusOK
+	if statusPayload.Status == core.DriveStatusDegraded {
+		code = http.StatusServiceUnavailable
+	}
 	AddDefalutHeaders(c)
-	c.String(http.StatusOK, "%s", []byte(`{"status":"ok"}`))
+	c.Header("Cache-Control", "no-store")
+	c.String(code, "%s", bytes)
+}
+
+// handleRecovery answers 500 Internal Server Error to panicking handlers as
+// gin.Recovery does, but passes http.ErrAbortHandler on to net/http, which
+// aborts a response already started
+func handleRecovery(c *gin.Context) {
+	defer func() {
+		err := recover()
+		if err == nil {
+			return
+		}
+		if err == http.ErrAbortHandler {
+			panic(err)
+		}
+		log.Printf("[Recovery] panic recovered: %v\n%s", err, debug.Stack())
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}()
+	c.Next()
 }
 
 func handleGetAzureADAuth(c *gin.Context) {
@@ -79,6 +129,11 @@ func handleGetOneDrive(c *gin.Context) {
 		}
 	}
 	path := c.Query("path")
+	if redirectURL, ok := od.UseDriveVolumeMountRedirectURL(path); ok {
+		c.Header("Cache-Control", "private")
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
 	microsoftGraphDriveItemCache, err := od.GetMicrosoftGraphDriveItem(path)
 	if err != nil {
 		log.Println(err)
@@ -91,6 +146,9 @@ func handleGetOneDrive(c *gin.Context) {
 		}
 	}
 	if microsoftGraphDriveItemCache != nil {
+		if err := addThumbnailURLs(microsoftGraphDriveItemCache, drive, path, "small"); err != nil {
+			log.Println(err)
+		}
 		data, err := json.Marshal(microsoftGraphDriveItemCache)
 		if err != nil {
 			log.Println(err)
@@ -124,6 +182,11 @@ func handleGetMicrosoftGraphDriveItem(c *gin.Context) {
 		}
 	}
 	path := c.Query("path")
+	if redirectURL, ok := od.UseDriveVolumeMountRedirectURL(path); ok {
+		c.Header("Cache-Control", "private")
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
 	microsoftGraphDriveItemCache, err := od.GetMicrosoftGraphDriveItem(path)
 	if err != nil {
 		log.Println(err)
@@ -134,35 +197,18 @@ func handleGetMicrosoftGraphDriveItem(c *gin.Context) {
 				log.Println(err)
 			}
 		}
-		bytes, err := json.Marshal(microsoftGraphDriveItemCache)
-		if err != nil {
+		if err := filterMicrosoftGraphDriveItemChildren(c, microsoftGraphDriveItemCache); err != nil {
 			log.Println(err)
-			c.AbortWithStatus(http.StatusNotFound)
+			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		AddDefalutHeaders(c)
-		c.String(http.StatusOK, "%s", bytes)
-		return
-	}
-	c.AbortWithStatus(http.StatusNotFound)
-}
-
-func handleGetMicrosoftGraphDriveItemSearch(c *gin.Context) {
-	drive := c.Query("drive")
-	od := ODCollection.UseDefaultOneDrive()
-	if len(drive) > 0 {
-		od = ODCollection.UseOneDriveByOneDriveName(drive)
-		if od == nil {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
+		if thumbnails := c.Query("thumbnails"); thumbnails != "" {
+			if err := addThumbnailURLs(microsoftGraphDriveItemCache, drive, path, thumbnails); err != nil {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
 		}
-	}
-	query := c.Query("query")
-	microsoftGraphDriveItemCache, err := od.GetMicrosoftGraphDriveItem(query)
-	if err != nil {
-		log.Println(err)
-	}
-	if microsoftGraphDriveItemCache != nil {
+		addPermissions(c, microsoftGraphDriveItemCache, path)
 		bytes, err := json.Marshal(microsoftGraphDriveItemCache)
 		if err != nil {
 			log.Println(err)
@@ -190,7 +236,21 @@ func handleGetMicrosoftGraphDriveItemContentURL(c *gin.Context) {
 	if path == "" {
 		path = c.Param("path")
 	}
-	microsoftGraphDriveItemCache, err := od.GetMicrosoftGraphAPIMeDriveContentURL(path)
+	responseMicrosoftGraphDriveItemContentURL(c, od, path)
+}
+
+// responseMicrosoftGraphDriveItemContentURL redirects to the download URL of
+// the file at the virtual path, or proxies its content if configured so
+func responseMicrosoftGraphDriveItemContentURL(c *gin.Context, od *core.OneDrive, path string) {
+	sourceOneDrive, sourcePath, ok := useDriveVolumeMountSource(c, od, path, false)
+	if !ok {
+		return
+	}
+	if sourceOneDrive.UseContentCache(sourcePath) || od.UseContentMode(path) == "proxy" {
+		proxyMicrosoftGraphDriveItemContent(c, sourceOneDrive, sourcePath)
+		return
+	}
+	microsoftGraphDriveItemCache, err := sourceOneDrive.UseMicrosoftGraphDriveItemContentURL(sourcePath)
 	if err != nil {
 		log.Println(err)
 		c.AbortWithStatus(http.StatusNotFound)
@@ -236,30 +296,102 @@ func main() {
 	} else {
 		gin.SetMode(gin.ReleaseMode)
 	}
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Logger(), handleRecovery, handleMetrics)
+	reader := router.Group("", requireAccessRole(access.RoleRead))
+	writer := router.Group("", requireAccessRole(access.RoleWrite))
+	admin := router.Group("", requireAccessRole(access.RoleAdmin))
 	if ODCollection.IsDebugMode != nil && *ODCollection.IsDebugMode {
-		ginpprof.Wrap(router)
-		router.GET("/onedrive/raw", handleGetMicrosoftGraphAPIMeDriveRaw)
-		router.POST("/onedrive/raw", handlePostMicrosoftGraphAPIMeDriveRaw)
-		router.PUT("/onedrive/raw", handlePutMicrosoftGraphAPIMeDriveRaw)
+		ginpprof.WrapGroup(admin)
+		admin.GET("/onedrive/raw", handleGetMicrosoftGraphAPIMeDriveRaw)
+		admin.POST("/onedrive/raw", handlePostMicrosoftGraphAPIMeDriveRaw)
+		admin.PUT("/onedrive/raw", handlePutMicrosoftGraphAPIMeDriveRaw)
 	}
+	admin.GET("/api/onedrive/permissions", handleGetMicrosoftGraphDriveItemPermissions)
+	admin.DELETE("/api/onedrive/permissions", handleDeleteMicrosoftGraphDriveItemPermission)
+	admin.POST("/api/onedrive/link", handlePostMicrosoftGraphDriveItemLink)
+	admin.POST("/api/onedrive/invite", handlePostMicrosoftGraphDriveItemInvite)
+	admin.GET("/api/onedrive/shortlinks", handleGetShortLinks)
+	admin.POST("/api/onedrive/shortlinks", handlePostShortLink)
+	admin.DELETE("/api/onedrive/shortlinks", handleDeleteShortLink)
+	writer.PUT("/onedrive/upload", handlePutMicrosoftGraphDriveItemContent)
+	writer.PUT("/api/onedrive/upload", handlePutMicrosoftGraphDriveItemContent)
+	writer.POST("/api/onedrive/copy", handlePostMicrosoftGraphDriveItemCopy)
+	writer.POST("/api/onedrive/import", handlePostMicrosoftGraphDriveItemImport)
+	writer.GET("/api/onedrive/job", handleGetUploader)
+	writer.DELETE("/api/onedrive/job", handleDeleteUploader)
+	writer.GET("/api/onedrive/uploads", handleGetUploaderCollection)
+	writer.POST("/api/onedrive/folder", handlePostMicrosoftGraphDriveFolder)
+	writer.POST("/api/onedrive/move", handlePostMicrosoftGraphDriveItemMove)
+	writer.POST("/api/onedrive/rename", handlePostMicrosoftGraphDriveItemRename)
+	writer.POST("/api/onedrive/restore", handlePostMicrosoftGraphDriveItemRestore)
+	writer.POST("/api/onedrive/deleted/restore", handlePostDriveItemTombstoneRestore)
+	writer.POST("/api/onedrive/versions/restore", handlePostMicrosoftGraphDriveItemVersionRestore)
+	writer.DELETE("/api/onedrive/driveitem", handleDeleteMicrosoftGraphDriveItem)
 	if ODCollection.PageTemplate != nil {
 		router.LoadHTMLFiles(*ODCollection.PageTemplate)
-		router.GET("/onedrive", handleGetOneDrive)
+		reader.GET("/onedrive", handleGetOneDrive)
 	}
+	reader.GET("/onedrive/archive", handleGetMicrosoftGraphDriveArchive)
 	router.GET("/onedrive/auth", handleGetAzureADAuth)
-	router.GET("/onedrive/content", handleGetMicrosoftGraphDriveItemContentURL)
-	router.GET("/onedrive/driveitem", handleGetMicrosoftGraphDriveItem)
-	router.GET("/onedrive/search", handleGetMicrosoftGraphDriveItemSearch)
+	reader.GET("/onedrive/content", handleGetMicrosoftGraphDriveItemContentURL)
+	reader.HEAD("/onedrive/content", handleGetMicrosoftGraphDriveItemContentURL)
+	reader.GET("/onedrive/download", handleGetMicrosoftGraphDriveItemContent)
+	reader.HEAD("/onedrive/download", handleGetMicrosoftGraphDriveItemContent)
+	reader.GET("/onedrive/driveitem", handleGetMicrosoftGraphDriveItem)
+	reader.GET("/onedrive/feed/:format", handleGetMicrosoftGraphDriveItemFeed)
+	reader.GET("/onedrive/player", handleGetPlayer)
+	reader.GET("/onedrive/search", handleGetMicrosoftGraphDriveItemSearch)
+	reader.GET("/onedrive/query", handleGetDriveIndexQuery)
 	router.GET("/onedrive/status", handleGetOneDriveStatus)
+	reader.GET("/metrics", handleGetMetrics)
 	router.POST("/onedrive/notification", handlePostMicrosoftGraphNotification)
+	router.POST("/onedrive/unlock", handlePostUnlock)
+	reader.GET("/api/onedrive/activities", handleGetMicrosoftGraphDriveItemActivities)
+	reader.GET("/api/onedrive/archive", handleGetMicrosoftGraphDriveArchive)
 	router.GET("/api/onedrive/auth", handleGetAzureADAuth)
-	router.GET("/api/onedrive/content", handleGetMicrosoftGraphDriveItemContentURL)
-	router.GET("/api/onedrive/driveitem", handleGetMicrosoftGraphDriveItem)
-	router.GET("/onedrive/file", handleGetMicrosoftGraphDriveItemContentURL)
-	router.GET("/onedrive/stream/*path", handleGetMicrosoftGraphDriveItemContentURL)
-	router.GET("/api/onedrive/file", handleGetMicrosoftGraphDriveItemContentURL)
-	router.GET("/api/onedrive/stream/*path", handleGetMicrosoftGraphDriveItemContentURL)
+	reader.GET("/api/onedrive/content", handleGetMicrosoftGraphDriveItemContentURL)
+	reader.HEAD("/api/onedrive/content", handleGetMicrosoftGraphDriveItemContentURL)
+	reader.GET("/api/onedrive/deleted", handleGetDriveItemTombstones)
+	reader.GET("/api/onedrive/download", handleGetMicrosoftGraphDriveItemContent)
+	reader.HEAD("/api/onedrive/download", handleGetMicrosoftGraphDriveItemContent)
+	reader.GET("/api/onedrive/driveitem", handleGetMicrosoftGraphDriveItem)
+	reader.GET("/api/onedrive/player", handleGetPlayerManifest)
+	reader.GET("/api/onedrive/subtitle", handleGetSubtitle)
+	reader.GET("/api/onedrive/thumbnail", handleGetMicrosoftGraphDriveItemThumbnail)
+	reader.GET("/api/onedrive/versions", handleGetMicrosoftGraphDriveItemVersions)
+	reader.GET("/api/onedrive/versions/content", handleGetMicrosoftGraphDriveItemVersionContent)
+	router.POST("/api/onedrive/unlock", handlePostUnlock)
+	router.GET("/s/:token", handleGetShortLink)
+	router.GET("/s/:token/*path", handleGetShortLink)
+	router.HEAD("/s/:token", handleGetShortLink)
+	router.HEAD("/s/:token/*path", handleGetShortLink)
+	reader.GET("/onedrive/file", handleGetMicrosoftGraphDriveItemContentURL)
+	reader.GET("/onedrive/stream/*path", handleGetMicrosoftGraphDriveItemContentURL)
+	reader.GET("/api/onedrive/file", handleGetMicrosoftGraphDriveItemContentURL)
+	reader.GET("/api/onedrive/stream/*path", handleGetMicrosoftGraphDriveItemContentURL)
+	reader.OPTIONS("/dav/:drive/*path", handleWebDAVOptions)
+	reader.Handle("PROPFIND", "/dav/:drive/*path", handleWebDAVPropfind)
+	reader.GET("/dav/:drive/*path", handleWebDAVGet)
+	reader.HEAD("/dav/:drive/*path", handleWebDAVGet)
+	writer.PUT("/dav/:drive/*path", handleWebDAVPut)
+	writer.Handle("MKCOL", "/dav/:drive/*path", handleWebDAVMkcol)
+	writer.Handle("MOVE", "/dav/:drive/*path", handleWebDAVMove)
+	writer.Handle("COPY", "/dav/:drive/*path", handleWebDAVCopy)
+	writer.DELETE("/dav/:drive/*path", handleWebDAVDelete)
+	writer.Handle("LOCK", "/dav/:drive/*path", handleWebDAVLock)
+	writer.Handle("UNLOCK", "/dav/:drive/*path", handleWebDAVUnlock)
+	if ODCollection.S3Config != nil {
+		router.GET("/s3", handleS3ListBuckets)
+		router.GET("/s3/", handleS3ListBuckets)
+		router.HEAD("/s3/:bucket", handleHeadS3Bucket)
+		router.GET("/s3/:bucket", handleGetS3Bucket)
+		router.HEAD("/s3/:bucket/*key", handleGetS3Object)
+		router.GET("/s3/:bucket/*key", handleGetS3Object)
+		if ODCollection.S3Config.AllowPut {
+			router.PUT("/s3/:bucket/*key", handlePutS3Object)
+		}
+	}
 	if err := router.Run("localhost:8081"); err != nil {
 		log.Panicln(err)
 	}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/access"
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/collection"
+	"github.com/AirWSW/onedrive/core/shortlink"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// newTestCachedFolder returns the cache of the folder at path of the drive
+// root, refreshed now
+func newTestCachedFolder(path string, children ...cache.MicrosoftGraphDriveItemCache) cache.MicrosoftGraphDriveItemCache {
+	for i := range children {
+		children[i].ParentReference = &graphapi.MicrosoftGraphItemReference{Path: path}
+	}
+	return cache.MicrosoftGraphDriveItemCache{
+		CacheDescription: &cache.CacheDescription{Path: path, LastUpdateAt: time.Now().Unix(), Status: "Cached"},
+		Folder:           &graphapi.MicrosoftGraphFolder{ChildCount: int32(len(children))},
+		Children:         children,
+	}
+}
+
+// useTestODCollection serves the drive "my media" hiding /Source, the folder
+// source of the drive, and short links stored in a temporary directory through
+// ODCollection, anonymous users write, graphRequests counts the requests
+// reaching Microsoft Graph
+func useTestODCollection(t *testing.T, graphRequests *int32) (*core.OneDrive, func()) {
+	graph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(graphRequests, 1)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":"itemNotFound"}}`))
+	}))
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "my media"
+	od := &core.OneDrive{}
+	od.OneDriveDescription.OneDriveName = &name
+	od.OneDriveDescription.HiddenPaths = []string{"/Source"}
+	od.MicrosoftGraphAPI.MicrosoftEndPoints.MicrosoftGraphAPIEndPointURL = graph.URL
+	od.MicrosoftGraphAPI.MicrosoftGraphAPIToken = &graphapi.MicrosoftGraphAPIToken{TokenType: "Bearer", AccessToken: "token"}
+	od.DriveCacheCollection.MicrosoftGraphDriveItemCache = []cache.MicrosoftGraphDriveItemCache{
+		newTestCachedFolder("/drive/root:",
+			cache.MicrosoftGraphDriveItemCache{Name: "public", Folder: &graphapi.MicrosoftGraphFolder{ChildCount: 1}},
+			cache.MicrosoftGraphDriveItemCache{Name: "source", Folder: &graphapi.MicrosoftGraphFolder{ChildCount: 1}},
+		),
+		newTestCachedFolder("/drive/root:/public",
+			cache.MicrosoftGraphDriveItemCache{Name: "a b.txt", File: &graphapi.MicrosoftGraphFile{}, Size: 1},
+		),
+		newTestCachedFolder("/drive/root:/source",
+			cache.MicrosoftGraphDriveItemCache{Name: "secret.txt", File: &graphapi.MicrosoftGraphFile{}, Size: 1},
+		),
+	}
+	shortLinks := shortlink.NewStore(filepath.Join(dir, "shortlinks.json"))
+	if err := shortLinks.Load(); err != nil {
+		t.Fatal(err)
+	}
+	odCollection := ODCollection
+	ODCollection = &collection.OneDriveCollection{
+		AccessConfig: &collection.AccessConfig{AnonymousRoles: map[string]string{"*": "write"}},
+		OneDrives:    []*core.OneDrive{od},
+		ShortLinks:   shortLinks,
+	}
+	return od, func() {
+		ODCollection = odCollection
+		graph.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// newTestRouter routes the handlers under test as main does
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(handleRecovery)
+	reader := router.Group("", requireAccessRole(access.RoleRead))
+	writer := router.Group("", requireAccessRole(access.RoleWrite))
+	reader.GET("/api/onedrive/driveitem", handleGetMicrosoftGraphDriveItem)
+	reader.GET("/onedrive/download", handleGetMicrosoftGraphDriveItemContent)
+	reader.GET("/onedrive/search", handleGetMicrosoftGraphDriveItemSearch)
+	router.GET("/s/:token", handleGetShortLink)
+	router.GET("/s/:token/*path", handleGetShortLink)
+	writer.Handle("MOVE", "/dav/:drive/*path", handleWebDAVMove)
+	router.GET("/s3", handleS3ListBuckets)
+	router.HEAD("/s3/:bucket", handleHeadS3Bucket)
+	router.HEAD("/s3/:bucket/*key", handleGetS3Object)
+	router.GET("/s3/:bucket/*key", handleGetS3Object)
+	router.PUT("/s3/:bucket/*key", handlePutS3Object)
+	return router
+}
+
+func serveTestRequest(router *gin.Engine, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
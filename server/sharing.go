@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/access"
+	"github.com/AirWSW/onedrive/core/collection"
+	"github.com/AirWSW/onedrive/core/utils"
+	"github.com/AirWSW/onedrive/graphapi"
+)
+
+// useSharingSource resolves the drive and the path of the sharing routes to
+// their source, sharing that lets others write the item requires a writable
+// volume mount
+func useSharingSource(c *gin.Context, write bool) (*core.OneDrive, string, bool) {
+	od, _ := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, "", false
+	}
+	return useDriveVolumeMountSource(c, od, c.Query("path"), write)
+}
+
+// handleGetMicrosoftGraphDriveItemPermissions lists the sharing links and
+// invitations of the item at path, force skips the permission cache
+func handleGetMicrosoftGraphDriveItemPermissions(c *gin.Context) {
+	od, sourcePath, ok := useSharingSource(c, false)
+	if !ok {
+		return
+	}
+	microsoftGraphPermissions, err := od.GetMicrosoftGraphDriveItemPermissions(sourcePath, c.Query("force") != "")
+	responseMicrosoftGraphPermissions(c, microsoftGraphPermissions, err)
+}
+
+// handlePostMicrosoftGraphDriveItemLink creates a sharing link of type view,
+// edit or embed, the password is taken from the form values only
+func handlePostMicrosoftGraphDriveItemLink(c *gin.Context) {
+	expiresAt, err := core.ParseSharingExpiration(c.Query("expiration"), time.Now())
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	linkType := c.DefaultQuery("type", "view")
+	od, sourcePath, ok := useSharingSource(c, linkType == "edit")
+	if !ok {
+		return
+	}
+	microsoftGraphPermission, err := od.CreateMicrosoftGraphDriveItemLink(sourcePath, linkType, c.Query("scope"), c.PostForm("password"), expiresAt)
+	responseMicrosoftGraphPermissions(c, microsoftGraphPermission, err)
+}
+
+// handlePostMicrosoftGraphDriveItemInvite invites the email form values, which
+// may be separated by commas as well, with the roles of the query
+func handlePostMicrosoftGraphDriveItemInvite(c *gin.Context) {
+	roles, write := []string{}, false
+	if str := c.Query("roles"); str != "" {
+		roles = strings.Split(str, ",")
+	}
+	for _, role := range roles {
+		write = write || role == "write"
+	}
+	od, sourcePath, ok := useSharingSource(c, write)
+	if !ok {
+		return
+	}
+	emails := []string{}
+	for _, email := range c.PostFormArray("email") {
+		emails = append(emails, strings.Split(email, ",")...)
+	}
+	requireSignIn := c.DefaultQuery("requireSignIn", "true") == "true"
+	sendInvitation := c.DefaultQuery("sendInvitation", "true") == "true"
+	microsoftGraphPermissions, err := od.InviteMicrosoftGraphDriveItem(sourcePath, emails, roles, c.PostForm("message"), requireSignIn, sendInvitation)
+	responseMicrosoftGraphPermissions(c, microsoftGraphPermissions, err)
+}
+
+// handleDeleteMicrosoftGraphDriveItemPermission revokes the permission id of
+// the item at path
+func handleDeleteMicrosoftGraphDriveItemPermission(c *gin.Context) {
+	od, sourcePath, ok := useSharingSource(c, false)
+	if !ok {
+		return
+	}
+	if err := od.DeleteMicrosoftGraphDriveItemPermission(sourcePath, c.Query("id")); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func responseMicrosoftGraphPermissions(c *gin.Context, v interface{}, err error) {
+	if err != nil {
+		log.Println(err)
+		if err == core.ErrSharingNotSupported {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+// addPermissions sets the cached permissions of the item at the virtual path
+// and its children, only for the items the user of the request administers,
+// Microsoft Graph is NOT requested for listings
+func addPermissions(c *gin.Context, driveItemCachePayload *core.DriveItemCachePayload, itemPath string) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		return
+	}
+	user, _ := c.Get(AccessUserKey)
+	if accessUser, _ := user.(*collection.AccessUser); ODCollection.UseAccessRole(accessUser, drive) < access.RoleAdmin {
+		return
+	}
+	itemPath = utils.RegularPath(itemPath)
+	driveItemCachePayload.Permissions = useCachedPermissions(c, od, drive, itemPath)
+	for i := range driveItemCachePayload.Children {
+		childPath := path.Join(itemPath, driveItemCachePayload.Children[i].Name)
+		driveItemCachePayload.Children[i].Permissions = useCachedPermissions(c, od, drive, childPath)
+	}
+}
+
+func useCachedPermissions(c *gin.Context, od *core.OneDrive, drive, itemPath string) []graphapi.MicrosoftGraphPermission {
+	if status, _ := useMicrosoftGraphDrivePathStatus(c, od, drive, itemPath, access.RoleAdmin); status != http.StatusOK {
+		return nil
+	}
+	sourceOneDrive, sourcePath, _, err := od.ResolveDriveVolumeMount(itemPath)
+	if err != nil {
+		return nil
+	}
+	microsoftGraphPermissions, _ := sourceOneDrive.HitMicrosoftGraphDriveItemPermissionsCache(sourcePath)
+	return microsoftGraphPermissions
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/access"
+	"github.com/AirWSW/onedrive/core/collection"
+	"github.com/AirWSW/onedrive/core/shortlink"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+// ShortLinkPayload is a short link as shown to admins, without the password
+type ShortLinkPayload struct {
+	Token        string                `json:"token"`
+	URL          string                `json:"url"`
+	Drive        string                `json:"drive,omitempty"`
+	Path         string                `json:"path"`
+	FileOnly     bool                  `json:"fileOnly"`
+	ExpiresAt    *time.Time            `json:"expiresAt,omitempty"`
+	MaxDownloads int64                 `json:"maxDownloads,omitempty"`
+	Downloads    int64                 `json:"downloads"`
+	HasPassword  bool                  `json:"hasPassword"`
+	CreatedAt    time.Time             `json:"createdAt"`
+	CreatedBy    string                `json:"createdBy,omitempty"`
+	AccessLogs   []shortlink.AccessLog `json:"accessLogs,omitempty"`
+}
+
+func newShortLinkPayload(c *gin.Context, link *shortlink.Link) ShortLinkPayload {
+	return ShortLinkPayload{
+		Token:        link.Token,
+		URL:          usePublicBaseURL(c) + "/s/" + link.Token,
+		Drive:        link.Drive,
+		Path:         link.Path,
+		FileOnly:     link.FileOnly,
+		ExpiresAt:    link.ExpiresAt,
+		MaxDownloads: link.MaxDownloads,
+		Downloads:    link.Downloads,
+		HasPassword:  link.HasPassword(),
+		CreatedAt:    link.CreatedAt,
+		CreatedBy:    link.CreatedBy,
+		AccessLogs:   link.AccessLogs,
+	}
+}
+
+// isShortLinkAdministered reports whether the user of the request administers
+// the drive of link
+func isShortLinkAdministered(c *gin.Context, link *shortlink.Link) bool {
+	user, _ := c.Get(AccessUserKey)
+	accessUser, _ := user.(*collection.AccessUser)
+	drive := link.Drive
+	if drive == "" {
+		_, drive = useAccessOneDrive(c)
+	}
+	return ODCollection.UseAccessRole(accessUser, drive) >= access.RoleAdmin
+}
+
+// handlePostShortLink mints a short link to the item at path, expiration,
+// maxDownloads and fileOnly are optional and so is the password form value
+func handlePostShortLink(c *gin.Context) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil || ODCollection.ShortLinks == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	expiresAt, err := core.ParseSharingExpiration(c.Query("expiration"), time.Now())
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	maxDownloads, err := strconv.ParseInt(c.DefaultQuery("maxDownloads", "0"), 10, 64)
+	if err != nil || maxDownloads < 0 {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	itemPath := utils.RegularPath(c.Query("path"))
+	driveItemCachePayload, err := od.GetMicrosoftGraphDriveItem(itemPath)
+	if err != nil || driveItemCachePayload == nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	fileOnly := c.Query("fileOnly") == "true"
+	if fileOnly && driveItemCachePayload.Folder != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	link := &shortlink.Link{
+		Drive:        drive,
+		Path:         itemPath,
+		FileOnly:     fileOnly,
+		ExpiresAt:    expiresAt,
+		MaxDownloads: maxDownloads,
+		CreatedAt:    time.Now(),
+	}
+	user, _ := c.Get(AccessUserKey)
+	if accessUser, ok := user.(*collection.AccessUser); ok && accessUser != nil {
+		link.CreatedBy = accessUser.Name
+	}
+	if err := link.SetPassword(c.PostForm("password")); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if err := ODCollection.ShortLinks.Create(link); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	responseShortLinks(c, newShortLinkPayload(c, link))
+}
+
+// handleGetShortLinks lists the short links of the drives the user
+// administers, the link of token is returned with its access logs
+func handleGetShortLinks(c *gin.Context) {
+	if ODCollection.ShortLinks == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if token := c.Query("token"); token != "" {
+		link, ok := ODCollection.ShortLinks.Get(token)
+		if !ok || !isShortLinkAdministered(c, link) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		responseShortLinks(c, newShortLinkPayload(c, link))
+		return
+	}
+	shortLinkPayloads := []ShortLinkPayload{}
+	for _, link := range ODCollection.ShortLinks.List() {
+		if isShortLinkAdministered(c, &link) {
+			shortLinkPayloads = append(shortLinkPayloads, newShortLinkPayload(c, &link))
+		}
+	}
+	responseShortLinks(c, shortLinkPayloads)
+}
+
+// handleDeleteShortLink revokes the short link of token
+func handleDeleteShortLink(c *gin.Context) {
+	if ODCollection.ShortLinks == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	link, ok := ODCollection.ShortLinks.Get(c.Query("token"))
+	if !ok || !isShortLinkAdministered(c, link) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err := ODCollection.ShortLinks.Delete(link.Token); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func responseShortLinks(c *gin.Context, v interface{}) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+// handleGetShortLink serves the item of a short link without any access role,
+// files through the proxy and folders as listings,
+// the items below a folder are reached by /s/{token}/{path}
+func handleGetShortLink(c *gin.Context) {
+	if ODCollection.ShortLinks == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	link, ok := ODCollection.ShortLinks.Get(c.Param("token"))
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	subPath := utils.RegularPath(c.Param("path"))
+	defer func() {
+		accessLog := shortlink.AccessLog{
+			Time:       time.Now(),
+			RemoteAddr: c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+			Path:       subPath,
+			Status:     c.Writer.Status(),
+		}
+		if err := ODCollection.ShortLinks.Log(link.Token, accessLog); err != nil {
+			log.Println(err)
+		}
+	}()
+	if link.IsExpired(time.Now()) || link.IsExhausted() {
+		c.AbortWithStatus(http.StatusGone)
+		return
+	}
+	if link.HasPassword() {
+		_, password, _ := c.Request.BasicAuth()
+		if password == "" {
+			password = c.GetHeader("X-OneDrive-Password")
+		}
+		if !link.VerifyPassword(password) {
+			abortAccessUnauthorized(c, "s/"+link.Token)
+			return
+		}
+	}
+	if link.FileOnly && subPath != "/" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	od := ODCollection.UseDefaultOneDrive()
+	if link.Drive != "" {
+		od = ODCollection.UseOneDriveByOneDriveName(link.Drive)
+	}
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	itemPath, ok := useShortLinkItemPath(link.Path, subPath)
+	if !ok {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	// The hidden paths and the locked volume mounts below the item of the link
+	// stay hidden and locked
+	isRootHidden := isShortLinkPathHidden(od, link.Path)
+	if !isRootHidden && isShortLinkPathHidden(od, itemPath) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if isShortLinkPathLocked(c, od, link.Path, itemPath) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	driveItemCachePayload, err := od.GetMicrosoftGraphDriveItem(itemPath)
+	if err != nil || driveItemCachePayload == nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if driveItemCachePayload.Folder != nil {
+		children := []core.DriveItemCachePayload{}
+		for _, child := range driveItemCachePayload.Children {
+			if isRootHidden || !isShortLinkPathHidden(od, path.Join(itemPath, child.Name)) {
+				// Download URLs would bypass the download count
+				child.DownloadURL = nil
+				children = append(children, child)
+			}
+		}
+		driveItemCachePayload.Children = children
+		driveItemCachePayload.DownloadURL = nil
+		responseShortLinks(c, driveItemCachePayload)
+		return
+	}
+	sourceOneDrive, sourcePath, ok := useDriveVolumeMountSource(c, od, itemPath, false)
+	if !ok {
+		return
+	}
+	// The content is always proxied as a download URL stays usable past the
+	// limits of the link, each request counts as a download
+	if c.Request.Method == http.MethodGet {
+		if err := ODCollection.ShortLinks.Download(link.Token, time.Now()); err != nil {
+			c.AbortWithStatus(http.StatusGone)
+			return
+		}
+	}
+	proxyMicrosoftGraphDriveItemContent(c, sourceOneDrive, sourcePath)
+}
+
+// useShortLinkItemPath joins the subpath of a request to the path of the link,
+// subpaths leaving the item of the link are refused
+func useShortLinkItemPath(linkPath, subPath string) (string, bool) {
+	for _, name := range strings.Split(subPath, "/") {
+		// The paths are unescaped again further on
+		unescapedName, _ := url.QueryUnescape(name)
+		if name == "." || name == ".." || unescapedName == "." || unescapedName == ".." {
+			return "", false
+		}
+	}
+	linkPath = utils.RegularPath(linkPath)
+	itemPath := linkPath
+	if subPath != "/" {
+		itemPath = strings.TrimSuffix(linkPath, "/") + subPath
+	}
+	if !core.IsSubPath(itemPath, linkPath) {
+		return "", false
+	}
+	return itemPath, true
+}
+
+// isShortLinkPathLocked reports whether the virtual path lies in a volume
+// mount with password the item of the link lies outside of, whose password
+// is still required
+func isShortLinkPathLocked(c *gin.Context, od *core.OneDrive, linkPath, itemPath string) bool {
+	linkHops, err := od.ResolveDriveVolumeMountHops(linkPath)
+	if err != nil {
+		return true
+	}
+	hops, err := od.ResolveDriveVolumeMountHops(itemPath)
+	if err != nil {
+		return true
+	}
+	for i, hop := range hops {
+		if i < len(linkHops) && linkHops[i].DriveVolumeMountRule == hop.DriveVolumeMountRule {
+			continue
+		}
+		hopDrive := ""
+		if hop.OneDrive.OneDriveDescription.OneDriveName != nil {
+			hopDrive = *hop.OneDrive.OneDriveDescription.OneDriveName
+		}
+		if !isDriveVolumeMountUnlocked(c, hopDrive, hop.DriveVolumeMountRule) {
+			return true
+		}
+	}
+	return false
+}
+
+// isShortLinkPathHidden reports whether the virtual path lies in a hidden path
+// on any drive it is mounted from
+func isShortLinkPathHidden(od *core.OneDrive, itemPath string) bool {
+	hops, err := od.ResolveDriveVolumeMountHops(itemPath)
+	if err != nil {
+		return true
+	}
+	for _, hop := range hops {
+		if hop.OneDrive.IsHiddenPath(hop.Path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AirWSW/onedrive/core/shortlink"
+)
+
+func TestGetShortLinkTraversal(t *testing.T) {
+	var graphRequests int32
+	_, cleanup := useTestODCollection(t, &graphRequests)
+	defer cleanup()
+	router := newTestRouter()
+	link := &shortlink.Link{Path: "/public", CreatedAt: time.Now()}
+	if err := ODCollection.ShortLinks.Create(link); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serveTestRequest(router, httptest.NewRequest(http.MethodGet, "/s/"+link.Token, nil)); w.Code != http.StatusOK {
+		t.Errorf("got %d", w.Code)
+	}
+	tests := []string{
+		"/%2e%2e/source/secret.txt",
+		"/%252e%252e/source/secret.txt",
+		"/x/%2e%2e/%2e%2e/source",
+		"/./../source",
+	}
+	for _, test := range tests {
+		if w := serveTestRequest(router, httptest.NewRequest(http.MethodGet, "/s/"+link.Token+test, nil)); w.Code != http.StatusNotFound {
+			t.Errorf("%s got %d %s", test, w.Code, w.Body)
+		}
+	}
+	if graphRequests != 0 {
+		t.Errorf("got %d requests to Microsoft Graph", graphRequests)
+	}
+}
+
+func TestUseShortLinkItemPath(t *testing.T) {
+	tests := []struct {
+		linkPath, subPath, itemPath string
+		ok                          bool
+	}{
+		{"/public", "/", "/public", true},
+		{"/public", "/a b.txt", "/public/a b.txt", true},
+		{"/", "/public", "/public", true},
+		{"/public", "/../source", "", false},
+		{"/public", "/x/../../source", "", false},
+		{"/public", "/%2e%2e/source", "", false},
+		{"/public", "/./a b.txt", "", false},
+	}
+	for _, test := range tests {
+		if itemPath, ok := useShortLinkItemPath(test.linkPath, test.subPath); itemPath != test.itemPath || ok != test.ok {
+			t.Errorf("%s %s got %s %v", test.linkPath, test.subPath, itemPath, ok)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+// handleGetMicrosoftGraphDriveItemThumbnail serves the thumbnail of size of
+// the item at path from the thumbnail cache, fetching it once expired
+func handleGetMicrosoftGraphDriveItemThumbnail(c *gin.Context) {
+	od, _ := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	size, err := core.ParseThumbnailSize(c.Query("size"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	od, sourcePath, ok := useDriveVolumeMountSource(c, od, c.Query("path"), false)
+	if !ok {
+		return
+	}
+	thumbnail, err := od.GetMicrosoftGraphDriveItemThumbnail(sourcePath, size)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(core.ThumbnailURLMaxAge.Seconds())))
+	if thumbnail.Width > 0 && thumbnail.Height > 0 {
+		c.Header("X-Thumbnail-Size", strconv.Itoa(int(thumbnail.Width))+"x"+strconv.Itoa(int(thumbnail.Height)))
+	}
+	c.Data(http.StatusOK, thumbnail.ContentType, thumbnail.Content)
+}
+
+// addThumbnailURLs sets the thumbnail URLs of size of the files of a listing
+// of the item at the virtual path
+func addThumbnailURLs(driveItemCachePayload *core.DriveItemCachePayload, drive, itemPath, size string) error {
+	size, err := core.ParseThumbnailSize(size)
+	if err != nil {
+		return err
+	}
+	itemPath = utils.RegularPath(itemPath)
+	if driveItemCachePayload.File != nil {
+		thumbnailURL := core.UseThumbnailURL(drive, itemPath, size)
+		driveItemCachePayload.ThumbnailURL = &thumbnailURL
+	}
+	for i := range driveItemCachePayload.Children {
+		if driveItemCachePayload.Children[i].File != nil {
+			thumbnailURL := core.UseThumbnailURL(drive, path.Join(itemPath, driveItemCachePayload.Children[i].Name), size)
+			driveItemCachePayload.Children[i].ThumbnailURL = &thumbnailURL
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/cache"
+)
+
+// handleGetDriveItemTombstones lists the items deleted lately below the folder
+// at path, the latest deleted first, items the user may NOT read are left out
+func handleGetDriveItemTombstones(c *gin.Context) {
+	od, drive := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	tombstones := []cache.Tombstone{}
+	for _, tombstone := range od.ListDriveItemTombstones(c.Query("path")) {
+		if isMicrosoftGraphDrivePathReadable(c, od, drive, tombstone.Path) {
+			tombstones = append(tombstones, tombstone)
+		}
+	}
+	bytes, err := json.Marshal(tombstones)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+// handlePostDriveItemTombstoneRestore restores the deleted item id, which had
+// the path, to its original location
+func handlePostDriveItemTombstoneRestore(c *gin.Context) {
+	od, _ := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	od, sourcePath, ok := useDriveVolumeMountSource(c, od, c.Query("path"), true)
+	if !ok {
+		return
+	}
+	microsoftGraphDriveItem, err := od.RestoreDriveItemTombstone(sourcePath, c.Query("id"))
+	if err == core.ErrTombstoneNotFound {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	responseMicrosoftGraphDriveItem(c, microsoftGraphDriveItem, err)
+}
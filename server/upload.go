@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/integrity"
+)
+
+func handlePutMicrosoftGraphDriveItemContent(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	od, path, ok := useDriveVolumeMountSource(c, od, c.Query("path"), true)
+	if !ok {
+		return
+	}
+	if c.Request.ContentLength <= 0 {
+		c.AbortWithStatus(http.StatusLengthRequired)
+		return
+	}
+	content, size, cleanup, err := useUploadContent(c, od)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	defer cleanup()
+	microsoftGraphDriveItem, err := od.UploadMicrosoftGraphDriveItem(path, size, content)
+	if err != nil {
+		log.Println(err)
+		if integrity.IsHashMismatch(err) {
+			c.AbortWithStatus(http.StatusBadGateway)
+			return
+		}
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	bytes, err := json.Marshal(microsoftGraphDriveItem)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+func handlePostMicrosoftGraphDriveItemCopy(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	path := c.Query("path")
+	destination := c.Query("destination")
+	if path == "" || destination == "" {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	sourceOneDrive, path, destination, ok := useDriveVolumeMountSourcePair(c, od, path, destination, false)
+	if !ok {
+		return
+	}
+	// Jobs are looked up on the drive of the request
+	if sourceOneDrive != od {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	uploader, err := od.CopyMicrosoftGraphDriveItem(path, destination)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	bytes, err := json.Marshal(uploader)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusAccepted, "%s", bytes)
+}
+
+func handlePostMicrosoftGraphDriveItemImport(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	path := c.Query("path")
+	sourceURL := c.Query("url")
+	if path == "" || sourceURL == "" {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	sourceOneDrive, path, ok := useDriveVolumeMountSource(c, od, path, true)
+	if !ok {
+		return
+	}
+	// Jobs are looked up on the drive of the request
+	if sourceOneDrive != od {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	uploader, err := od.ImportMicrosoftGraphDriveItem(path, sourceURL)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	bytes, err := json.Marshal(uploader)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusAccepted, "%s", bytes)
+}
+
+func handleGetUploader(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	uploader := od.UploaderCollection.Get(c.Query("id"))
+	if uploader == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	bytes, err := json.Marshal(uploader)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+func handleGetUploaderCollection(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	bytes, err := json.Marshal(od.UploaderCollection.List())
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+func handleDeleteUploader(c *gin.Context) {
+	drive := c.Query("drive")
+	od := ODCollection.UseDefaultOneDrive()
+	if len(drive) > 0 {
+		od = ODCollection.UseOneDriveByOneDriveName(drive)
+		if od == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+	}
+	if err := od.CancelUploader(c.Query("id")); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// useUploadContent returns the request body and its size, the body is spooled
+// to a temporary file first when its length is unknown or retrying needs a
+// seekable content, cleanup removes the temporary file
+func useUploadContent(c *gin.Context, od *core.OneDrive) (io.Reader, int64, func(), error) {
+	size := c.Request.ContentLength
+	hashVerification := od.OneDriveDescription.HashVerification
+	if size >= 0 && (hashVerification == nil || !hashVerification.Upload || hashVerification.Retry <= 0) {
+		return c.Request.Body, size, func() {}, nil
+	}
+	tempFile, err := ioutil.TempFile("", "onedrive-upload-")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+	}
+	size, err = io.Copy(tempFile, c.Request.Body)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	if c.Request.ContentLength >= 0 && size != c.Request.ContentLength {
+		cleanup()
+		return nil, 0, nil, errors.New("useUploadContent ContentLengthMismatch")
+	}
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return tempFile, size, cleanup, nil
+}
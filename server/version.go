@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AirWSW/onedrive/core"
+)
+
+// handleGetMicrosoftGraphDriveItemVersions lists the versions of the file at
+// path, the current version first
+func handleGetMicrosoftGraphDriveItemVersions(c *gin.Context) {
+	od, _ := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	od, sourcePath, ok := useDriveVolumeMountSource(c, od, c.Query("path"), false)
+	if !ok {
+		return
+	}
+	microsoftGraphDriveItemVersions, err := od.GetMicrosoftGraphDriveItemVersions(sourcePath)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	bytes, err := json.Marshal(microsoftGraphDriveItemVersions)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	AddDefalutHeaders(c)
+	c.String(http.StatusOK, "%s", bytes)
+}
+
+// handleGetMicrosoftGraphDriveItemVersionContent redirects to the content of
+// the version id of the file at path, or proxies it in the proxy content mode
+func handleGetMicrosoftGraphDriveItemVersionContent(c *gin.Context) {
+	od, _ := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	path := c.Query("path")
+	sourceOneDrive, sourcePath, ok := useDriveVolumeMountSource(c, od, path, false)
+	if !ok {
+		return
+	}
+	if od.UseContentMode(path) == "proxy" {
+		resp, err := sourceOneDrive.GetMicrosoftGraphDriveItemVersionContentResponse(sourcePath, c.Query("id"), c.Request.Header)
+		if err != nil {
+			log.Println(err)
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		responseMicrosoftGraphDownloadResponse(c, resp)
+		return
+	}
+	downloadURL, err := sourceOneDrive.GetMicrosoftGraphDriveItemVersionContentURL(sourcePath, c.Query("id"))
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Header("Cache-Control", "private")
+	c.Redirect(http.StatusFound, downloadURL)
+}
+
+// handlePostMicrosoftGraphDriveItemVersionRestore makes the version id the
+// current version of the file at path
+func handlePostMicrosoftGraphDriveItemVersionRestore(c *gin.Context) {
+	od, _ := useAccessOneDrive(c)
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	od, sourcePath, ok := useDriveVolumeMountSource(c, od, c.Query("path"), true)
+	if !ok {
+		return
+	}
+	microsoftGraphDriveItem, err := od.RestoreMicrosoftGraphDriveItemVersion(sourcePath, c.Query("id"))
+	if err == core.ErrVersionNotSupported {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	responseMicrosoftGraphDriveItem(c, microsoftGraphDriveItem, err)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/AirWSW/onedrive/core"
+	"github.com/AirWSW/onedrive/core/access"
+	"github.com/AirWSW/onedrive/core/cache"
+	"github.com/AirWSW/onedrive/core/integrity"
+	"github.com/AirWSW/onedrive/core/utils"
+)
+
+// WebDAVMethods are the methods served under /dav/:drive/*path
+var WebDAVMethods = "OPTIONS, PROPFIND, GET, HEAD, PUT, MKCOL, MOVE, COPY, DELETE, LOCK, UNLOCK"
+
+type webDAVMultiStatus struct {
+	XMLName   xml.Name         `xml:"D:multistatus"`
+	XMLNSD    string           `xml:"xmlns:D,attr"`
+	Responses []webDAVResponse `xml:"D:response"`
+}
+
+type webDAVResponse struct {
+	Href     string         `xml:"D:href"`
+	PropStat webDAVPropStat `xml:"D:propstat"`
+}
+
+type webDAVPropStat struct {
+	Prop   webDAVProp `xml:"D:prop"`
+	Status string     `xml:"D:status"`
+}
+
+type webDAVProp struct {
+	DisplayName      string             `xml:"D:displayname"`
+	ResourceType     webDAVResourceType `xml:"D:resourcetype"`
+	GetContentLength *int64             `xml:"D:getcontentlength,omitempty"`
+	GetContentType   string             `xml:"D:getcontenttype,omitempty"`
+	GetETag          string             `xml:"D:getetag,omitempty"`
+	GetLastModified  string             `xml:"D:getlastmodified"`
+	CreationDate     string             `xml:"D:creationdate"`
+}
+
+type webDAVResourceType struct {
+	Collection *struct{} `xml:"D:collection,omitempty"`
+}
+
+type webDAVLockDiscovery struct {
+	XMLName    xml.Name `xml:"D:prop"`
+	XMLNSD     string   `xml:"xmlns:D,attr"`
+	LockType   string   `xml:"D:lockdiscovery>D:activelock>D:locktype>D:write"`
+	LockScope  string   `xml:"D:lockdiscovery>D:activelock>D:lockscope>D:exclusive"`
+	Depth      string   `xml:"D:lockdiscovery>D:activelock>D:depth"`
+	Timeout    string   `xml:"D:lockdiscovery>D:activelock>D:timeout"`
+	LockToken  string   `xml:"D:lockdiscovery>D:activelock>D:locktoken>D:href"`
+	LockRooted string   `xml:"D:lockdiscovery>D:activelock>D:lockroot>D:href"`
+}
+
+// useWebDAVOneDrive resolves the drive and the virtual path of the request,
+// access is checked by requireAccessRole beforehand
+func useWebDAVOneDrive(c *gin.Context) (*core.OneDrive, string, bool) {
+	od := ODCollection.UseOneDriveByOneDriveName(c.Param("drive"))
+	if od == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return nil, "", false
+	}
+	return od, utils.RegularPath(c.Param("path")), true
+}
+
+// useWebDAVDestination resolves the Destination header of MOVE and COPY, which
+// must point into the same drive, to the virtual and the source destination
+func useWebDAVDestination(c *gin.Context, od, sourceOneDrive *core.OneDrive) (string, string, bool) {
+	destinationURL, err := url.Parse(c.GetHeader("Destination"))
+	if err != nil || destinationURL.Path == "" {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return "", "", false
+	}
+	drive := c.Param("drive")
+	prefix := "/dav/" + drive + "/"
+	if !strings.HasPrefix(destinationURL.Path, prefix) {
+		c.AbortWithStatus(http.StatusBadGateway)
+		return "", "", false
+	}
+	destination := utils.RegularPath(destinationURL.Path[len(prefix)-1:])
+	if !authorizeMicrosoftGraphDrivePath(c, od, drive, destination, access.RoleWrite) {
+		return "", "", false
+	}
+	destinationOneDrive, sourceDestination, ok := useDriveVolumeMountSource(c, od, destination, true)
+	if !ok {
+		return "", "", false
+	}
+	// Volume mounts of other drives are other servers to WebDAV clients
+	if destinationOneDrive != sourceOneDrive {
+		c.AbortWithStatus(http.StatusBadGateway)
+		return "", "", false
+	}
+	return destination, sourceDestination, true
+}
+
+func useWebDAVHref(drive, path string, isCollection bool) string {
+	href := (&url.URL{Path: "/dav/" + drive + path}).EscapedPath()
+	if isCollection && !strings.HasSuffix(href, "/") {
+		href += "/"
+	}
+	return href
+}
+
+func newWebDAVResponse(href, name string, microsoftGraphDriveItemCache *cache.MicrosoftGraphDriveItemCache) webDAVResponse {
+	prop := webDAVProp{
+		DisplayName:     name,
+		GetLastModified: time.Unix(microsoftGraphDriveItemCache.LastModifiedAt, 0).UTC().Format(http.TimeFormat),
+		CreationDate:    time.Unix(microsoftGraphDriveItemCache.CreatedAt, 0).UTC().Format(time.RFC3339),
+	}
+	if microsoftGraphDriveItemCache.Folder != nil {
+		prop.ResourceType.Collection = &struct{}{}
+	} else {
+		size := microsoftGraphDriveItemCache.Size
+		prop.GetContentLength = &size
+		if microsoftGraphDriveItemCache.File != nil {
+			prop.GetContentType = microsoftGraphDriveItemCache.File.MimeType
+		}
+		prop.GetETag = microsoftGraphDriveItemCache.ETag
+		if prop.GetETag != "" && !strings.HasPrefix(prop.GetETag, "\"") {
+			prop.GetETag = strconv.Quote(prop.GetETag)
+		}
+	}
+	return webDAVResponse{
+		Href: href,
+		PropStat: webDAVPropStat{
+			Prop:   prop,
+			Status: "HTTP/1.1 200 OK",
+		},
+	}
+}
+
+func handleWebDAVOptions(c *gin.Context) {
+	c.Header("Allow", WebDAVMethods)
+	c.Header("DAV", "1, 2")
+	c.Header("MS-Author-Via", "DAV")
+	c.Status(http.StatusOK)
+}
+
+// handleWebDAVPropfind answers allprop for the item and, unless Depth is 0, its
+// children, Depth infinity is treated as 1
+func handleWebDAVPropfind(c *gin.Context) {
+	od, path, ok := useWebDAVOneDrive(c)
+	if !ok {
+		return
+	}
+	microsoftGraphDriveItemCache, err := od.StatMicrosoftGraphDriveItem(path)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	drive := c.Param("drive")
+	_, name := utils.RegularPathToPathFilename(path)
+	if name == "" {
+		name = drive
+	}
+	isCollection := microsoftGraphDriveItemCache.Folder != nil
+	multiStatus := webDAVMultiStatus{
+		XMLNSD:    "DAV:",
+		Responses: []webDAVResponse{newWebDAVResponse(useWebDAVHref(drive, path, isCollection), name, microsoftGraphDriveItemCache)},
+	}
+	if isCollection && c.GetHeader("Depth") != "0" {
+		for i := range microsoftGraphDriveItemCache.Children {
+			children := &microsoftGraphDriveItemCache.Children[i]
+			childrenPath := utils.RegularPath(path + "/" + children.Name)
+			href := useWebDAVHref(drive, childrenPath, children.Folder != nil)
+			multiStatus.Responses = append(multiStatus.Responses, newWebDAVResponse(href, children.Name, children))
+		}
+	}
+	bytes, err := xml.Marshal(multiStatus)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", append([]byte(xml.Header), bytes...))
+}
+
+func handleWebDAVGet(c *gin.Context) {
+	od, path, ok := useWebDAVOneDrive(c)
+	if !ok {
+		return
+	}
+	sourceOneDrive, sourcePath, ok := useDriveVolumeMountSource(c, od, path, false)
+	if !ok {
+		return
+	}
+	microsoftGraphDriveItemCache, err := od.StatMicrosoftGraphDriveItem(path)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if microsoftGraphDriveItemCache.Folder != nil {
+		c.Header("Allow", WebDAVMethods)
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+	proxyMicrosoftGraphDriveItemContent(c, sourceOneDrive, sourcePath)
+}
+
+func handleWebDAVPut(c *gin.Context) {
+	od, path, ok := useWebDAVOneDrive(c)
+	if !ok {
+		return
+	}
+	od, sourcePath, ok := useDriveVolumeMountSource(c, od, path, true)
+	if !ok {
+		return
+	}
+	content, size, cleanup, err := useUploadContent(c, od)
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	defer cleanup()
+	if _, err := od.UploadMicrosoftGraphDriveItem(sourcePath, size, content); err != nil {
+		log.Println(err)
+		if integrity.IsHashMismatch(err) {
+			c.AbortWithStatus(http.StatusBadGateway)
+			return
+		}
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+func handleWebDAVMkcol(c *gin.Context) {
+	od, path, ok := useWebDAVOneDrive(c)
+	if !ok {
+		return
+	}
+	od, sourcePath, ok := useDriveVolumeMountSource(c, od, path, true)
+	if !ok {
+		return
+	}
+	if c.Request.ContentLength > 0 {
+		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+	if _, err := od.CreateMicrosoftGraphDriveFolder(sourcePath, "fail"); err != nil {
+		log.Println(err)
+		if err.Error() == http.StatusText(http.StatusConflict) {
+			c.AbortWithStatus(http.StatusMethodNotAllowed)
+			return
+		}
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	c.Status(http.StatusCreated)
+}
+
+// useWebDAVOverwrite removes an existing destination unless Overwrite is F,
+// the returned status tells whether the destination existed
+func useWebDAVOverwrite(c *gin.Context, od *core.OneDrive, destination string, sourceOneDrive *core.OneDrive, sourceDestination string) (int, bool) {
+	if _, err := od.StatMicrosoftGraphDriveItem(destination); err != nil {
+		return http.StatusCreated, true
+	}
+	if c.GetHeader("Overwrite") == "F" {
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return 0, false
+	}
+	if _, err := sourceOneDrive.DeleteMicrosoftGraphDriveItem(sourceDestination); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusConflict)
+		return 0, false
+	}
+	return http.StatusNoContent, true
+}
+
+func handleWebDAVMove(c *gin.Context) {
+	od, path, ok := useWebDAVOneDrive(c)
+	if !ok {
+		return
+	}
+	sourceOneDrive, sourcePath, ok := useDriveVolumeMountSource(c, od, path, true)
+	if !ok {
+		return
+	}
+	destination, sourceDestination, ok := useWebDAVDestination(c, od, sourceOneDrive)
+	if !ok {
+		return
+	}
+	if sourceDestination == sourcePath {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	status, ok := useWebDAVOverwrite(c, od, destination, sourceOneDrive, sourceDestination)
+	if !ok {
+		return
+	}
+	if _, err := sourceOneDrive.MoveMicrosoftGraphDriveItem(sourcePath, sourceDestination); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	c.Status(status)
+}
+
+// handleWebDAVCopy answers 202 as Microsoft Graph copies asynchronously
+func handleWebDAVCopy(c *gin.Context) {
+	od, path, ok := useWebDAVOneDrive(c)
+	if !ok {
+		return
+	}
+	sourceOneDrive, sourcePath, ok := useDriveVolumeMountSource(c, od, path, false)
+	if !ok {
+		return
+	}
+	destination, sourceDestination, ok := useWebDAVDestination(c, od, sourceOneDrive)
+	if !ok {
+		return
+	}
+	if sourceDestination == sourcePath {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	if _, ok := useWebDAVOverwrite(c, od, destination, sourceOneDrive, sourceDestination); !ok {
+		return
+	}
+	if _, err := sourceOneDrive.CopyMicrosoftGraphDriveItem(sourcePath, sourceDestination); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func handleWebDAVDelete(c *gin.Context) {
+	od, path, ok := useWebDAVOneDrive(c)
+	if !ok {
+		return
+	}
+	if path == "/" {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	od, sourcePath, ok := useDriveVolumeMountSource(c, od, path, true)
+	if !ok {
+		return
+	}
+	if _, err := od.DeleteMicrosoftGraphDriveItem(sourcePath); err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleWebDAVLock grants every lock without tracking it, which is enough for
+// clients refusing to write without locking first
+func handleWebDAVLock(c *gin.Context) {
+	if _, _, ok := useWebDAVOneDrive(c); !ok {
+		return
+	}
+	lockToken := "opaquelocktoken:" + uuid.Must(uuid.NewV4(), nil).String()
+	bytes, err := xml.Marshal(webDAVLockDiscovery{
+		XMLNSD:     "DAV:",
+		Depth:      "infinity",
+		Timeout:    "Second-3600",
+		LockToken:  lockToken,
+		LockRooted: c.Request.URL.EscapedPath(),
+	})
+	if err != nil {
+		log.Println(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Lock-Token", "<"+lockToken+">")
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), bytes...))
+}
+
+func handleWebDAVUnlock(c *gin.Context) {
+	if _, _, ok := useWebDAVOneDrive(c); !ok {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
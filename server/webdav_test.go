@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebDAVMoveEncodedDestination(t *testing.T) {
+	var graphRequests int32
+	_, cleanup := useTestODCollection(t, &graphRequests)
+	defer cleanup()
+	router := newTestRouter()
+
+	tests := []struct {
+		destination string
+		code        int
+	}{
+		// The destination is decoded, an existing one is NOT overwritten
+		{"http://example.com/dav/my%20media/public/a%20b.txt", http.StatusPreconditionFailed},
+		{"/dav/my%20media/public/a%20b.txt", http.StatusPreconditionFailed},
+		// Encoded hidden paths stay hidden
+		{"http://example.com/dav/my%20media/%73ource/a.txt", http.StatusNotFound},
+		{"http://example.com/dav/my%20media/%53OURCE/a.txt", http.StatusNotFound},
+		{"http://example.com/dav/other/public/a.txt", http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("MOVE", "/dav/my%20media/public/c.txt", nil)
+		r.Header.Set("Destination", test.destination)
+		r.Header.Set("Overwrite", "F")
+		if w := serveTestRequest(router, r); w.Code != test.code {
+			t.Errorf("%s got %d", test.destination, w.Code)
+		}
+	}
+	if graphRequests != 0 {
+		t.Errorf("got %d requests to Microsoft Graph", graphRequests)
+	}
+}